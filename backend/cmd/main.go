@@ -1,25 +1,58 @@
+// Command forum runs the real-time forum server.
+//
+// Build and run it with the sqlite_fts5 tag (make build, make run): full-text
+// search needs FTS5, and the server exits at startup without it.
 package main
 
 import (
+	"flag"
 	"log"
 	"net/http"
+	"os"
 
 	"github.com/Tomlee-abila/real_time_forum/backend/internal/api"
 	"github.com/Tomlee-abila/real_time_forum/backend/internal/database"
+	"github.com/Tomlee-abila/real_time_forum/backend/internal/storage"
 	"github.com/Tomlee-abila/real_time_forum/backend/internal/websocket"
 )
 
 func main() {
+	admin := flag.String("admin", os.Getenv("FORUM_ADMIN"), "nickname or email of a registered user to make an administrator")
+	flag.Parse()
+
 	//database initialization and migration
 	database.Init()
 
+	// Nobody becomes an administrator automatically; the operator names the first one
+	if *admin != "" {
+		if user, err := database.PromoteToAdmin(*admin); err != nil {
+			log.Printf("Could not make %s an administrator: %v; register the account and restart", *admin, err)
+		} else {
+			log.Printf("%s is an administrator", user.Nickname)
+		}
+	}
+
 	// Create and start WebSocket hub
 	hub := websocket.NewHub()
 	go hub.Run()
 
+	// Uploaded attachments are kept on the local disk
+	store, err := storage.NewLocalStorage("uploads")
+	if err != nil {
+		log.Fatalf("❌ Failed to set up attachment storage: %v", err)
+	}
+	database.AttachmentStore = store
+
+	// Clean up attachments left behind by content deleted before they were removed with it
+	if removed, err := database.RemoveOrphanedAttachments(); err != nil {
+		log.Printf("Error removing orphaned attachments: %v", err)
+	} else if removed > 0 {
+		log.Printf("Removed %d orphaned attachment(s)", removed)
+	}
+
 	// Register routes
 	mux := http.NewServeMux()
-	api.RegisterRoutes(mux, hub)
+	api.RegisterRoutes(mux, hub, store)
 
 	// Add WebSocket endpoint
 	mux.HandleFunc("/ws", websocket.CreateWebSocketHandler(hub))
@@ -1,25 +1,38 @@
 package api
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"mime"
 	"net/http"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
+	"unicode"
 
 	"github.com/Tomlee-abila/real_time_forum/backend/internal/database"
 	"github.com/Tomlee-abila/real_time_forum/backend/internal/models"
+	"github.com/Tomlee-abila/real_time_forum/backend/internal/storage"
 	"github.com/Tomlee-abila/real_time_forum/backend/internal/utils"
 	"github.com/Tomlee-abila/real_time_forum/backend/internal/websocket"
+	"github.com/google/uuid"
 )
 
 // Global WebSocket hub reference
 var wsHub *websocket.Hub
 
+// Storage for uploaded attachments
+var attachmentStore storage.Storage
+
 // RegisterRoutes adds all HTTP routes to the mux
-func RegisterRoutes(mux *http.ServeMux, hub *websocket.Hub) {
-	// Store hub reference for use in handlers
+func RegisterRoutes(mux *http.ServeMux, hub *websocket.Hub, store storage.Storage) {
+	// Store hub and storage references for use in handlers
 	wsHub = hub
+	attachmentStore = store
 	// Serve the Single page front-end
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		http.ServeFile(w, r, "frontend/static/index.html")
@@ -46,9 +59,36 @@ func RegisterRoutes(mux *http.ServeMux, hub *websocket.Hub) {
 	mux.HandleFunc("/api/messages/conversations", GetConversationsHandler)
 	mux.HandleFunc("/api/messages/history/", GetMessageHistoryHandler) // For /api/messages/history/{userID}
 	mux.HandleFunc("/api/messages", MessagesHandler)                   // GET all messages, POST new message
+	mux.HandleFunc("/api/messages/", MessageDetailHandler)             // PUT/DELETE /api/messages/{id}
 	mux.HandleFunc("/api/messages/read/", MarkMessagesReadHandler)     // PUT /api/messages/read/{userID}
+	mux.HandleFunc("/api/conversations", ConversationsHandler)
+	mux.HandleFunc("/api/conversations/", ConversationDetailHandler) // For /api/conversations/{id}/...
 	mux.HandleFunc("/api/users/online", GetOnlineUsersHandler)
 	mux.HandleFunc("/api/users/stats", GetUserStatsHandler)
+	mux.HandleFunc("/api/blocks", BlocksHandler)
+	mux.HandleFunc("/api/blocks/", UnblockUserHandler) // DELETE /api/blocks/{userID}
+
+	// Attachment endpoints
+	mux.HandleFunc("/api/attachments", AttachmentsHandler)
+	mux.HandleFunc("/api/attachments/", AttachmentDetailHandler) // For /api/attachments/{id} and /{id}/thumbnail
+
+	// Admin endpoints
+	mux.HandleFunc("/api/admin/categories", AdminCategoriesHandler)
+	mux.HandleFunc("/api/admin/categories/", AdminCategoryDetailHandler) // For /api/admin/categories/{slug}
+	mux.HandleFunc("/api/admin/users", AdminUsersHandler)
+	mux.HandleFunc("/api/admin/users/", AdminUserRoleHandler) // For /api/admin/users/{id}/role
+
+	// Report and moderation queue endpoints
+	mux.HandleFunc("/api/reports", CreateReportHandler)
+	mux.HandleFunc("/api/moderation/reports", ModerationReportsHandler)
+	mux.HandleFunc("/api/moderation/reports/", ModerationReportDetailHandler) // For /api/moderation/reports/{id}
+
+	// Mention endpoints
+	mux.HandleFunc("/api/mentions", GetMentionsHandler)
+	mux.HandleFunc("/api/mentions/read", MarkMentionsReadHandler) // PUT /api/mentions/read
+
+	// Search endpoint
+	mux.HandleFunc("/api/search", SearchHandler)
 }
 
 // PostsHandler handles GET /posts (get all posts) and POST /posts (create post)
@@ -79,18 +119,35 @@ func CreatePostHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Validate input
+	postData.Normalize()
 	if err := postData.Validate(); err != nil {
 		respondWithError(w, http.StatusBadRequest, err.Error())
 		return
 	}
+	for _, category := range postData.Categories {
+		if !database.IsValidCategory(category, false) {
+			respondWithError(w, http.StatusBadRequest, "invalid category: "+category)
+			return
+		}
+	}
 
 	// Create post
 	post, err := database.CreatePost(userID, &postData)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Failed to create post")
+		if strings.Contains(err.Error(), "attachment not found") {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+		} else {
+			respondWithError(w, http.StatusInternalServerError, "Failed to create post")
+		}
 		return
 	}
 
+	// Broadcast the new post to feed subscribers
+	if wsHub != nil {
+		wsHub.BroadcastMessageFromAPI(websocket.CreatePostCreatedEvent(post), "")
+	}
+	notifyMentions(database.CreatePostMentions(post))
+
 	respondWithJSON(w, http.StatusCreated, map[string]interface{}{
 		"message": "Post created successfully",
 		"post":    post,
@@ -110,6 +167,47 @@ func PostDetailHandler(w http.ResponseWriter, r *http.Request) {
 
 	postID := parts[0]
 
+	// Check if this is a reaction request: /posts/{id}/reactions or /posts/{id}/comments/{commentID}/reactions
+	if len(parts) == 2 && parts[1] == "reactions" {
+		ToggleReactionHandler(w, r, postID, models.ReactionTargetPost, postID)
+		return
+	}
+	if len(parts) == 4 && parts[1] == "comments" && parts[3] == "reactions" {
+		ToggleReactionHandler(w, r, postID, models.ReactionTargetComment, parts[2])
+		return
+	}
+
+	// Check if this is a lock request: /posts/{id}/lock
+	if len(parts) == 2 && parts[1] == "lock" {
+		LockPostHandler(w, r, postID)
+		return
+	}
+
+	// Check if this is a revisions request: /posts/{id}/revisions or /posts/{id}/comments/{commentID}/revisions
+	if len(parts) == 2 && parts[1] == "revisions" {
+		GetRevisionsHandler(w, r, postID, "")
+		return
+	}
+	if len(parts) == 4 && parts[1] == "comments" && parts[3] == "revisions" {
+		GetRevisionsHandler(w, r, postID, parts[2])
+		return
+	}
+
+	// Check if this is a comment thread request: /posts/{id}/comments/{commentID}
+	if len(parts) > 2 && parts[1] == "comments" && parts[2] != "" {
+		switch r.Method {
+		case http.MethodGet:
+			GetCommentThreadHandler(w, r, postID, parts[2])
+		case http.MethodPut:
+			UpdateCommentHandler(w, r, postID, parts[2])
+		case http.MethodDelete:
+			DeleteCommentHandler(w, r, postID, parts[2])
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
 	// Check if this is a comment request
 	if len(parts) > 1 && parts[1] == "comments" {
 		if r.Method == http.MethodPost {
@@ -124,6 +222,8 @@ func PostDetailHandler(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
 		GetPostDetailHandler(w, r, postID)
+	case http.MethodPut:
+		UpdatePostHandler(w, r, postID)
 	case http.MethodDelete:
 		DeletePostHandler(w, r, postID)
 	default:
@@ -133,7 +233,13 @@ func PostDetailHandler(w http.ResponseWriter, r *http.Request) {
 
 // GetPostDetailHandler handles GET /posts/{id} - get post with comments
 func GetPostDetailHandler(w http.ResponseWriter, r *http.Request, postID string) {
-	postWithComments, err := database.GetPostWithComments(postID)
+	limit, cursor, err := parsePageParams(r, 50)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	postWithComments, err := database.GetPostWithComments(postID, getOptionalUserID(r), limit, cursor)
 	if err != nil {
 		if strings.Contains(err.Error(), "not found") {
 			respondWithError(w, http.StatusNotFound, "Post not found")
@@ -161,6 +267,12 @@ func CreateCommentHandler(w http.ResponseWriter, r *http.Request, postID string)
 		return
 	}
 
+	// Resolve the parent comment for replies
+	if err := database.ResolveCommentParent(postID, &commentData); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	// Validate input
 	if err := commentData.Validate(); err != nil {
 		respondWithError(w, http.StatusBadRequest, err.Error())
@@ -172,262 +284,991 @@ func CreateCommentHandler(w http.ResponseWriter, r *http.Request, postID string)
 	if err != nil {
 		if strings.Contains(err.Error(), "not found") {
 			respondWithError(w, http.StatusNotFound, "Post not found")
+		} else if strings.Contains(err.Error(), "locked") {
+			respondWithError(w, http.StatusForbidden, err.Error())
 		} else {
 			respondWithError(w, http.StatusInternalServerError, "Failed to create comment")
 		}
 		return
 	}
 
+	// Broadcast the new comment to subscribers of the post and its category
+	if wsHub != nil {
+		if post, err := database.GetPostByID(postID); err == nil {
+			wsHub.BroadcastMessageFromAPI(websocket.CreateCommentCreatedEvent(post.Categories, comment), "")
+		}
+	}
+	notifyMentions(database.CreateCommentMentions(comment))
+
 	respondWithJSON(w, http.StatusCreated, map[string]interface{}{
 		"message": "Comment created successfully",
 		"comment": comment,
 	})
 }
 
-// DeletePostHandler handles DELETE /posts/{id} - delete post
-func DeletePostHandler(w http.ResponseWriter, r *http.Request, postID string) {
-	// Get user from session
-	userID, err := getUserIDFromSession(r)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Authentication required")
-		return
-	}
-
-	// Delete post
-	err = database.DeletePost(postID, userID)
+// GetCommentThreadHandler handles GET /posts/{id}/comments/{commentID} - get a comment with its replies
+func GetCommentThreadHandler(w http.ResponseWriter, r *http.Request, postID, commentID string) {
+	comment, err := database.GetCommentThread(postID, commentID, getOptionalUserID(r))
 	if err != nil {
 		if strings.Contains(err.Error(), "not found") {
-			respondWithError(w, http.StatusNotFound, "Post not found")
-		} else if strings.Contains(err.Error(), "unauthorized") {
-			respondWithError(w, http.StatusForbidden, err.Error())
+			respondWithError(w, http.StatusNotFound, "Comment not found")
 		} else {
-			respondWithError(w, http.StatusInternalServerError, "Failed to delete post")
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve comment thread")
 		}
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, map[string]string{
-		"message": "Post deleted successfully",
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"comment": comment,
 	})
 }
 
-// CategoriesHandler handles GET /categories - get available categories
-func CategoriesHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
+// ToggleReactionHandler handles POST /posts/{id}/reactions and
+// POST /posts/{id}/comments/{commentID}/reactions - toggle the caller's reaction
+func ToggleReactionHandler(w http.ResponseWriter, r *http.Request, postID, targetType, targetID string) {
+	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	categories := models.GetValidCategories()
-	respondWithJSON(w, http.StatusOK, map[string]interface{}{
-		"categories": categories,
-	})
-}
-
-// Helper function to get user ID from session
-func getUserIDFromSession(r *http.Request) (string, error) {
-	token, err := utils.GetSessionFromRequest(r)
+	// Get user from session
+	userID, err := getUserIDFromSession(r)
 	if err != nil {
-		return "", err
+		respondWithError(w, http.StatusUnauthorized, "Authentication required")
+		return
 	}
 
-	session, err := utils.GetSessionByToken(token)
-	if err != nil {
-		return "", err
+	var toggle models.ReactionToggle
+	if err := json.NewDecoder(r.Body).Decode(&toggle); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid JSON format")
+		return
 	}
 
-	return session.UserID, nil
-}
-
-// GetPostsHandler handles GET /posts - retrieve posts feed
-func GetPostsHandler(w http.ResponseWriter, r *http.Request) {
-	// Parse query parameters
-	limitStr := r.URL.Query().Get("limit")
-	offsetStr := r.URL.Query().Get("offset")
-	category := r.URL.Query().Get("category")
-
-	// Set default values
-	limit := 10
-	offset := 0
-
-	// Parse limit
-	if limitStr != "" {
-		if parsedLimit, err := strconv.Atoi(limitStr); err == nil && parsedLimit > 0 && parsedLimit <= 50 {
-			limit = parsedLimit
-		}
+	// Validate input
+	if err := toggle.Validate(); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
 	}
 
-	// Parse offset
-	if offsetStr != "" {
-		if parsedOffset, err := strconv.Atoi(offsetStr); err == nil && parsedOffset >= 0 {
-			offset = parsedOffset
+	// A comment can only be reacted to through the post it belongs to
+	if targetType == models.ReactionTargetComment {
+		comment, err := database.GetCommentByID(targetID)
+		if err != nil || comment.PostID != postID {
+			respondWithError(w, http.StatusNotFound, "Comment not found")
+			return
 		}
 	}
 
-	var posts []models.Post
-	var err error
-
-	// Get posts by category or all posts
-	if category != "" {
-		posts, err = database.GetPostsByCategory(category, limit, offset)
-	} else {
-		posts, err = database.GetAllPosts(limit, offset)
-	}
-
+	update, err := database.ToggleReaction(userID, targetType, targetID, &toggle)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve posts")
+		if strings.Contains(err.Error(), "not found") {
+			respondWithError(w, http.StatusNotFound, err.Error())
+		} else {
+			respondWithError(w, http.StatusInternalServerError, "Failed to update reaction")
+		}
 		return
 	}
 
-	// Get total count for pagination
-	var totalCount int
-	if category != "" {
-		totalCount, _ = database.GetPostCountByCategory(category)
-	} else {
-		totalCount, _ = database.GetPostCount()
+	// Broadcast the new totals to subscribers of the post and its category
+	if wsHub != nil {
+		if post, err := database.GetPostByID(update.PostID); err == nil {
+			wsHub.BroadcastMessageFromAPI(websocket.CreateReactionUpdatedEvent(post.Categories, update), "")
+		}
 	}
 
-	respondWithJSON(w, http.StatusOK, map[string]interface{}{
-		"posts":       posts,
-		"total_count": totalCount,
-		"limit":       limit,
-		"offset":      offset,
-	})
+	respondWithJSON(w, http.StatusOK, update)
 }
 
-// RegisterHandler handles user registration
-func RegisterHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+// UpdatePostHandler handles PUT /posts/{id} - edit post
+func UpdatePostHandler(w http.ResponseWriter, r *http.Request, postID string) {
+	// Get user from session
+	userID, err := getUserIDFromSession(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Authentication required")
 		return
 	}
 
-	var userReg models.UserRegistration
-	if err := json.NewDecoder(r.Body).Decode(&userReg); err != nil {
+	var updateData models.PostUpdate
+	if err := json.NewDecoder(r.Body).Decode(&updateData); err != nil {
 		respondWithError(w, http.StatusBadRequest, "Invalid JSON format")
 		return
 	}
 
 	// Validate input
-	if err := userReg.Validate(); err != nil {
+	if err := updateData.Validate(); err != nil {
 		respondWithError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	// Check if email already exists
-	emailExists, err := database.CheckEmailExists(userReg.Email)
+	// Update post
+	post, mentions, err := database.UpdatePost(postID, userID, &updateData)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Database error")
+		if strings.Contains(err.Error(), "not found") {
+			respondWithError(w, http.StatusNotFound, "Post not found")
+		} else if strings.Contains(err.Error(), "unauthorized") || strings.Contains(err.Error(), "locked") {
+			respondWithError(w, http.StatusForbidden, err.Error())
+		} else {
+			respondWithError(w, http.StatusInternalServerError, "Failed to update post")
+		}
 		return
 	}
-	if emailExists {
-		respondWithError(w, http.StatusConflict, "Email already exists")
-		return
+
+	// Broadcast the edit to feed subscribers
+	if wsHub != nil {
+		wsHub.BroadcastMessageFromAPI(websocket.CreatePostUpdatedEvent(post), "")
 	}
+	notifyMentions(mentions, nil)
 
-	// Check if nickname already exists
-	nicknameExists, err := database.CheckNicknameExists(userReg.Nickname)
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Post updated successfully",
+		"post":    post,
+	})
+}
+
+// UpdateCommentHandler handles PUT /posts/{id}/comments/{commentID} - edit comment
+func UpdateCommentHandler(w http.ResponseWriter, r *http.Request, postID, commentID string) {
+	// Get user from session
+	userID, err := getUserIDFromSession(r)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Database error")
+		respondWithError(w, http.StatusUnauthorized, "Authentication required")
 		return
 	}
-	if nicknameExists {
-		respondWithError(w, http.StatusConflict, "Nickname already exists")
+
+	var updateData models.CommentUpdate
+	if err := json.NewDecoder(r.Body).Decode(&updateData); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid JSON format")
 		return
 	}
 
-	// Create user
-	user, err := database.CreateUser(&userReg)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Failed to create user")
+	// Validate input
+	if err := updateData.Validate(); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	// Create session
-	session, err := utils.CreateSession(user.ID)
+	// Update comment
+	comment, mentions, err := database.UpdateComment(postID, commentID, userID, &updateData)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Failed to create session")
+		if strings.Contains(err.Error(), "not found") {
+			respondWithError(w, http.StatusNotFound, "Comment not found")
+		} else if strings.Contains(err.Error(), "unauthorized") || strings.Contains(err.Error(), "locked") {
+			respondWithError(w, http.StatusForbidden, err.Error())
+		} else {
+			respondWithError(w, http.StatusInternalServerError, "Failed to update comment")
+		}
 		return
 	}
 
-	// Set session cookie
-	utils.SetSessionCookie(w, session.Token)
+	// Broadcast the edit to subscribers of the post and its category
+	if wsHub != nil {
+		if post, err := database.GetPostByID(postID); err == nil {
+			wsHub.BroadcastMessageFromAPI(websocket.CreateCommentUpdatedEvent(post.Categories, comment), "")
+		}
+	}
+	notifyMentions(mentions, nil)
 
-	// Respond with user data
-	respondWithJSON(w, http.StatusCreated, map[string]interface{}{
-		"message": "User registered successfully",
-		"user":    user,
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Comment updated successfully",
+		"comment": comment,
 	})
 }
 
-// LoginHandler handles user login
-func LoginHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
+// GetRevisionsHandler handles GET /posts/{id}/revisions and
+// GET /posts/{id}/comments/{commentID}/revisions - list edit history with diffs
+func GetRevisionsHandler(w http.ResponseWriter, r *http.Request, postID, commentID string) {
+	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	var loginData models.UserLogin
-	if err := json.NewDecoder(r.Body).Decode(&loginData); err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid JSON format")
+	var revisions []models.Revision
+	var err error
+	if commentID == "" {
+		revisions, err = database.GetPostRevisions(postID)
+	} else {
+		revisions, err = database.GetCommentRevisions(postID, commentID)
+	}
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			respondWithError(w, http.StatusNotFound, err.Error())
+		} else {
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve revisions")
+		}
 		return
 	}
 
-	// Validate input
-	if err := loginData.Validate(); err != nil {
-		respondWithError(w, http.StatusBadRequest, err.Error())
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"revisions": revisions,
+		"count":     len(revisions),
+	})
+}
+
+// DeletePostHandler handles DELETE /posts/{id} - delete post (owner or moderator)
+func DeletePostHandler(w http.ResponseWriter, r *http.Request, postID string) {
+	// Get user from session
+	session, err := getSessionFromRequest(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Authentication required")
 		return
 	}
+	userID := session.UserID
 
-	// Validate credentials
-	user, err := database.ValidateUserCredentials(loginData.EmailOrNickname, loginData.Password)
+	// Look up the post first so the deletion can be routed by category
+	post, err := database.GetPostByID(postID)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Invalid credentials")
+		if strings.Contains(err.Error(), "not found") {
+			respondWithError(w, http.StatusNotFound, "Post not found")
+		} else {
+			respondWithError(w, http.StatusInternalServerError, "Failed to delete post")
+		}
 		return
 	}
 
-	// Create session
-	session, err := utils.CreateSession(user.ID)
+	// Delete post
+	err = database.DeletePost(postID, userID, session.Role)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Failed to create session")
+		if strings.Contains(err.Error(), "not found") {
+			respondWithError(w, http.StatusNotFound, "Post not found")
+		} else if strings.Contains(err.Error(), "unauthorized") {
+			respondWithError(w, http.StatusForbidden, err.Error())
+		} else {
+			respondWithError(w, http.StatusInternalServerError, "Failed to delete post")
+		}
 		return
 	}
 
-	// Set session cookie
-	utils.SetSessionCookie(w, session.Token)
+	// Broadcast the deletion to feed subscribers
+	if wsHub != nil {
+		wsHub.BroadcastMessageFromAPI(websocket.CreatePostDeletedEvent(post.Categories, postID, userID), "")
+	}
 
-	// Respond with user data
-	respondWithJSON(w, http.StatusOK, map[string]interface{}{
-		"message": "Login successful",
-		"user":    user,
+	respondWithJSON(w, http.StatusOK, map[string]string{
+		"message": "Post deleted successfully",
 	})
 }
 
-// LogoutHandler handles user logout
-func LogoutHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+// DeleteCommentHandler handles DELETE /posts/{id}/comments/{commentID} - delete
+// comment and its replies (owner or moderator)
+func DeleteCommentHandler(w http.ResponseWriter, r *http.Request, postID, commentID string) {
+	// Get user from session
+	session, err := getSessionFromRequest(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Authentication required")
 		return
 	}
 
-	// Get session token from cookie
-	token, err := utils.GetSessionFromRequest(r)
+	// Look up the post and comment first so the deletion can be routed by category
+	post, err := database.GetPostByID(postID)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "No active session")
+		respondWithError(w, http.StatusNotFound, "Post not found")
+		return
+	}
+	comment, err := database.GetCommentByID(commentID)
+	if err != nil || comment.PostID != postID {
+		respondWithError(w, http.StatusNotFound, "Comment not found")
 		return
 	}
 
-	// Delete session from database
-	if err := utils.DeleteSession(token); err != nil {
-		// Even if deletion fails, clear the cookie
-		fmt.Printf("Failed to delete session: %v\n", err)
+	// Delete comment
+	err = database.DeleteComment(commentID, session.UserID, session.Role)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			respondWithError(w, http.StatusNotFound, "Comment not found")
+		} else if strings.Contains(err.Error(), "unauthorized") {
+			respondWithError(w, http.StatusForbidden, err.Error())
+		} else {
+			respondWithError(w, http.StatusInternalServerError, "Failed to delete comment")
+		}
+		return
 	}
 
-	// Clear session cookie
-	utils.ClearSessionCookie(w)
+	// Broadcast the deletion to feed subscribers
+	if wsHub != nil {
+		wsHub.BroadcastMessageFromAPI(websocket.CreateCommentDeletedEvent(post.Categories, postID, commentID, session.UserID), "")
+	}
 
 	respondWithJSON(w, http.StatusOK, map[string]string{
-		"message": "Logout successful",
+		"message": "Comment deleted successfully",
+	})
+}
+
+// LockPostHandler handles POST /posts/{id}/lock - lock or unlock post (moderator)
+func LockPostHandler(w http.ResponseWriter, r *http.Request, postID string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	session, ok := requirePermission(w, r, models.PermLockPost)
+	if !ok {
+		return
+	}
+
+	var lockData models.PostLock
+	if err := json.NewDecoder(r.Body).Decode(&lockData); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid JSON format")
+		return
+	}
+
+	if err := database.LockPost(postID, session.UserID, session.Role, lockData.Locked); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			respondWithError(w, http.StatusNotFound, "Post not found")
+		} else {
+			respondWithError(w, http.StatusInternalServerError, "Failed to lock post")
+		}
+		return
+	}
+
+	post, err := database.GetPostByID(postID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve post")
+		return
+	}
+
+	// Broadcast the new lock state to feed subscribers
+	if wsHub != nil {
+		wsHub.BroadcastMessageFromAPI(websocket.CreatePostUpdatedEvent(post), "")
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Post lock updated successfully",
+		"post":    post,
+	})
+}
+
+// CategoriesHandler handles GET /categories - get available categories
+func CategoriesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	categories, err := database.GetCategoriesWithCounts(false)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve categories")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"categories": categories,
+	})
+}
+
+// AdminCategoriesHandler handles GET /api/admin/categories (list all, including
+// archived) and POST /api/admin/categories (create category)
+func AdminCategoriesHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requirePermission(w, r, models.PermManageCategories); !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		categories, err := database.GetCategoriesWithCounts(true)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve categories")
+			return
+		}
+		respondWithJSON(w, http.StatusOK, map[string]interface{}{
+			"categories": categories,
+		})
+
+	case http.MethodPost:
+		var categoryData models.CategoryCreation
+		if err := json.NewDecoder(r.Body).Decode(&categoryData); err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid JSON format")
+			return
+		}
+
+		// Validate input
+		if err := categoryData.Validate(); err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		category, err := database.CreateCategory(&categoryData)
+		if err != nil {
+			if strings.Contains(err.Error(), "already exists") {
+				respondWithError(w, http.StatusConflict, err.Error())
+			} else {
+				respondWithError(w, http.StatusInternalServerError, "Failed to create category")
+			}
+			return
+		}
+
+		respondWithJSON(w, http.StatusCreated, map[string]interface{}{
+			"message":  "Category created successfully",
+			"category": category,
+		})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// AdminCategoryDetailHandler handles PUT /api/admin/categories/{slug} (edit or
+// archive category) and DELETE /api/admin/categories/{slug} (delete unused category)
+func AdminCategoryDetailHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requirePermission(w, r, models.PermManageCategories); !ok {
+		return
+	}
+
+	slug := strings.TrimPrefix(r.URL.Path, "/api/admin/categories/")
+	if slug == "" || strings.Contains(slug, "/") {
+		respondWithError(w, http.StatusBadRequest, "Category slug required")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		var updateData models.CategoryUpdate
+		if err := json.NewDecoder(r.Body).Decode(&updateData); err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid JSON format")
+			return
+		}
+
+		// Validate input
+		if err := updateData.Validate(); err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		category, err := database.UpdateCategory(slug, &updateData)
+		if err != nil {
+			if strings.Contains(err.Error(), "not found") {
+				respondWithError(w, http.StatusNotFound, "Category not found")
+			} else {
+				respondWithError(w, http.StatusInternalServerError, "Failed to update category")
+			}
+			return
+		}
+
+		respondWithJSON(w, http.StatusOK, map[string]interface{}{
+			"message":  "Category updated successfully",
+			"category": category,
+		})
+
+	case http.MethodDelete:
+		if err := database.DeleteCategory(slug); err != nil {
+			if strings.Contains(err.Error(), "not found") {
+				respondWithError(w, http.StatusNotFound, "Category not found")
+			} else if strings.Contains(err.Error(), "still has posts") {
+				respondWithError(w, http.StatusConflict, err.Error())
+			} else {
+				respondWithError(w, http.StatusInternalServerError, "Failed to delete category")
+			}
+			return
+		}
+
+		respondWithJSON(w, http.StatusOK, map[string]string{
+			"message": "Category deleted successfully",
+		})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// AdminUsersHandler handles GET /api/admin/users - list users and their roles,
+// optionally filtered with ?role=
+func AdminUsersHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if _, ok := requirePermission(w, r, models.PermManageUsers); !ok {
+		return
+	}
+
+	role := models.Role(r.URL.Query().Get("role"))
+	if role != "" && !role.Valid() {
+		respondWithError(w, http.StatusBadRequest, "role must be user, moderator or admin")
+		return
+	}
+
+	users, err := database.GetUsersByRole(role)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve users")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"users": users,
+		"count": len(users),
+	})
+}
+
+// AdminUserRoleHandler handles PUT /api/admin/users/{id}/role - change a user's role
+func AdminUserRoleHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if _, ok := requirePermission(w, r, models.PermManageUsers); !ok {
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/api/admin/users/")
+	parts := strings.Split(path, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] != "role" {
+		respondWithError(w, http.StatusNotFound, "Not found")
+		return
+	}
+	userID := parts[0]
+
+	var roleData models.RoleUpdate
+	if err := json.NewDecoder(r.Body).Decode(&roleData); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid JSON format")
+		return
+	}
+
+	// Validate input
+	if err := roleData.Validate(); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := database.SetUserRole(userID, roleData.Role); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			respondWithError(w, http.StatusNotFound, "User not found")
+		} else if strings.Contains(err.Error(), "last administrator") {
+			respondWithError(w, http.StatusConflict, err.Error())
+		} else {
+			respondWithError(w, http.StatusInternalServerError, "Failed to update role")
+		}
+		return
+	}
+
+	// Connected clients pick up the new role immediately
+	if wsHub != nil {
+		wsHub.SetUserRole(userID, roleData.Role)
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Role updated successfully",
+		"user_id": userID,
+		"role":    roleData.Role,
+	})
+}
+
+// CreateReportHandler handles POST /api/reports - report a post, comment or message
+func CreateReportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Get user from session
+	userID, err := getUserIDFromSession(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	var reportData models.ReportCreation
+	if err := json.NewDecoder(r.Body).Decode(&reportData); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid JSON format")
+		return
+	}
+
+	// Validate input
+	if err := reportData.Validate(); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	report, err := database.CreateReport(userID, &reportData)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			respondWithError(w, http.StatusNotFound, err.Error())
+		} else if strings.Contains(err.Error(), "own content") {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+		} else if strings.Contains(err.Error(), "already open") {
+			respondWithError(w, http.StatusConflict, err.Error())
+		} else {
+			respondWithError(w, http.StatusInternalServerError, "Failed to create report")
+		}
+		return
+	}
+
+	// Let connected moderators know there is something new in the queue
+	if wsHub != nil {
+		wsHub.BroadcastToPermission(websocket.CreateReportCreatedEvent(report), models.PermReviewReports)
+	}
+
+	respondWithJSON(w, http.StatusCreated, map[string]interface{}{
+		"message": "Report submitted successfully",
+		"report": map[string]interface{}{
+			"id":          report.ID,
+			"target_type": report.TargetType,
+			"target_id":   report.TargetID,
+			"status":      report.Status,
+			"created_at":  report.CreatedAt,
+		},
+	})
+}
+
+// ModerationReportsHandler handles GET /api/moderation/reports - the moderation queue,
+// filtered with ?status= (open by default, or "all")
+func ModerationReportsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if _, ok := requirePermission(w, r, models.PermReviewReports); !ok {
+		return
+	}
+
+	status := models.ReportStatus(r.URL.Query().Get("status"))
+	switch {
+	case status == "":
+		status = models.ReportOpen
+	case status == "all":
+		status = ""
+	case !status.Valid():
+		respondWithError(w, http.StatusBadRequest, "status must be open, actioned, dismissed or all")
+		return
+	}
+
+	// Parse pagination parameters
+	limit, cursor, err := parsePageParams(r, 20)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	queue, err := database.GetReports(status, limit, cursor)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve reports")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, queue)
+}
+
+// ModerationReportDetailHandler handles GET /api/moderation/reports/{id} (report with
+// its audit trail) and PUT /api/moderation/reports/{id} (change its status)
+func ModerationReportDetailHandler(w http.ResponseWriter, r *http.Request) {
+	session, ok := requirePermission(w, r, models.PermReviewReports)
+	if !ok {
+		return
+	}
+
+	reportID := strings.TrimPrefix(r.URL.Path, "/api/moderation/reports/")
+	if reportID == "" || strings.Contains(reportID, "/") {
+		respondWithError(w, http.StatusBadRequest, "Report ID required")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		report, err := database.GetReportByID(reportID)
+		if err != nil {
+			if strings.Contains(err.Error(), "not found") {
+				respondWithError(w, http.StatusNotFound, "Report not found")
+			} else {
+				respondWithError(w, http.StatusInternalServerError, "Failed to retrieve report")
+			}
+			return
+		}
+
+		respondWithJSON(w, http.StatusOK, report)
+
+	case http.MethodPut:
+		var updateData models.ReportStatusUpdate
+		if err := json.NewDecoder(r.Body).Decode(&updateData); err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid JSON format")
+			return
+		}
+
+		// Validate input
+		if err := updateData.Validate(); err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		report, err := database.UpdateReportStatus(reportID, session.UserID, &updateData)
+		if err != nil {
+			if strings.Contains(err.Error(), "not found") {
+				respondWithError(w, http.StatusNotFound, "Report not found")
+			} else if strings.Contains(err.Error(), "invalid transition") || strings.Contains(err.Error(), "already open") {
+				respondWithError(w, http.StatusConflict, err.Error())
+			} else {
+				respondWithError(w, http.StatusInternalServerError, "Failed to update report")
+			}
+			return
+		}
+
+		respondWithJSON(w, http.StatusOK, map[string]interface{}{
+			"message": "Report updated successfully",
+			"report":  report,
+		})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// requirePermission checks that the request comes from a user whose role
+// grants the permission, writing the error response if it does not
+func requirePermission(w http.ResponseWriter, r *http.Request, permission models.Permission) (*utils.Session, bool) {
+	session, err := getSessionFromRequest(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Authentication required")
+		return nil, false
+	}
+
+	if !session.Role.Can(permission) {
+		respondWithError(w, http.StatusForbidden, "You do not have permission to do this")
+		return nil, false
+	}
+
+	return session, true
+}
+
+// getSessionFromRequest loads the session, including the user's role
+func getSessionFromRequest(r *http.Request) (*utils.Session, error) {
+	token, err := utils.GetSessionFromRequest(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return utils.GetSessionByToken(token)
+}
+
+// Helper function to get user ID from session
+func getUserIDFromSession(r *http.Request) (string, error) {
+	session, err := getSessionFromRequest(r)
+	if err != nil {
+		return "", err
+	}
+
+	return session.UserID, nil
+}
+
+// getOptionalUserID returns the session user ID, or "" for anonymous requests
+func getOptionalUserID(r *http.Request) string {
+	userID, err := getUserIDFromSession(r)
+	if err != nil {
+		return ""
+	}
+	return userID
+}
+
+// GetPostsHandler handles GET /posts - retrieve posts feed
+func GetPostsHandler(w http.ResponseWriter, r *http.Request) {
+	// Parse query parameters; category and tag take comma-separated lists
+	filter := models.TagFilter{
+		Categories: models.NormalizeTags(strings.Split(r.URL.Query().Get("category"), ",")),
+		Tags:       models.NormalizeTags(strings.Split(r.URL.Query().Get("tag"), ",")),
+	}
+	switch r.URL.Query().Get("match") {
+	case "", "any":
+	case "all":
+		filter.MatchAll = true
+	default:
+		respondWithError(w, http.StatusBadRequest, "match must be any or all")
+		return
+	}
+
+	limit, cursor, err := parsePageParams(r, 10)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	sort := r.URL.Query().Get("sort")
+	if sort == "" {
+		sort = models.PostSortNew
+	}
+	if sort != models.PostSortNew && sort != models.PostSortTop {
+		respondWithError(w, http.StatusBadRequest, "sort must be new or top")
+		return
+	}
+
+	var posts []models.Post
+	var page models.PageInfo
+	viewerID := getOptionalUserID(r)
+
+	// Get posts by category and tag or all posts
+	if len(filter.Categories) > 0 || len(filter.Tags) > 0 {
+		posts, page, err = database.GetPostsByTags(&filter, viewerID, sort, limit, cursor)
+	} else {
+		posts, page, err = database.GetAllPosts(viewerID, sort, limit, cursor)
+	}
+
+	if err != nil {
+		if strings.Contains(err.Error(), "invalid cursor") {
+			respondWithError(w, http.StatusBadRequest, "invalid cursor")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve posts")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"posts":       posts,
+		"sort":        sort,
+		"limit":       limit,
+		"next_cursor": page.NextCursor,
+		"prev_cursor": page.PrevCursor,
+		"has_more":    page.HasMore,
+	})
+}
+
+// parsePageParams parses the limit and cursor query parameters.
+// An invalid limit falls back to the default; an invalid cursor is an error.
+func parsePageParams(r *http.Request, defaultLimit int) (int, *models.Cursor, error) {
+	limit := defaultLimit
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if parsedLimit, err := strconv.Atoi(limitStr); err == nil && parsedLimit > 0 && parsedLimit <= 50 {
+			limit = parsedLimit
+		}
+	}
+
+	cursor, err := models.DecodeCursor(r.URL.Query().Get("cursor"))
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return limit, cursor, nil
+}
+
+// RegisterHandler handles user registration
+func RegisterHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var userReg models.UserRegistration
+	if err := json.NewDecoder(r.Body).Decode(&userReg); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid JSON format")
+		return
+	}
+
+	// Validate input
+	if err := userReg.Validate(); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Check if email already exists
+	emailExists, err := database.CheckEmailExists(userReg.Email)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if emailExists {
+		respondWithError(w, http.StatusConflict, "Email already exists")
+		return
+	}
+
+	// Check if nickname already exists
+	nicknameExists, err := database.CheckNicknameExists(userReg.Nickname)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if nicknameExists {
+		respondWithError(w, http.StatusConflict, "Nickname already exists")
+		return
+	}
+
+	// Create user
+	user, err := database.CreateUser(&userReg)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to create user")
+		return
+	}
+
+	// Create session
+	session, err := utils.CreateSession(user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to create session")
+		return
+	}
+
+	// Set session cookie
+	utils.SetSessionCookie(w, session.Token)
+
+	// Respond with user data
+	respondWithJSON(w, http.StatusCreated, map[string]interface{}{
+		"message": "User registered successfully",
+		"user":    user,
+	})
+}
+
+// LoginHandler handles user login
+func LoginHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var loginData models.UserLogin
+	if err := json.NewDecoder(r.Body).Decode(&loginData); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid JSON format")
+		return
+	}
+
+	// Validate input
+	if err := loginData.Validate(); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Validate credentials
+	user, err := database.ValidateUserCredentials(loginData.EmailOrNickname, loginData.Password)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Invalid credentials")
+		return
+	}
+
+	// Create session
+	session, err := utils.CreateSession(user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to create session")
+		return
+	}
+
+	// Set session cookie
+	utils.SetSessionCookie(w, session.Token)
+
+	// Respond with user data
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Login successful",
+		"user":    user,
+	})
+}
+
+// LogoutHandler handles user logout
+func LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Get session token from cookie
+	token, err := utils.GetSessionFromRequest(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "No active session")
+		return
+	}
+
+	// Delete session from database
+	if err := utils.DeleteSession(token); err != nil {
+		// Even if deletion fails, clear the cookie
+		fmt.Printf("Failed to delete session: %v\n", err)
+	}
+
+	// Clear session cookie
+	utils.ClearSessionCookie(w)
+
+	respondWithJSON(w, http.StatusOK, map[string]string{
+		"message": "Logout successful",
 	})
 }
 
@@ -438,68 +1279,773 @@ func GetCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get session token from cookie
-	token, err := utils.GetSessionFromRequest(r)
+	// Get session token from cookie
+	token, err := utils.GetSessionFromRequest(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "No active session")
+		return
+	}
+
+	// Get session from database
+	session, err := utils.GetSessionByToken(token)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Invalid or expired session")
+		return
+	}
+
+	// Get user data
+	user, err := database.GetUserByID(session.UserID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to get user data")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"user": user,
+	})
+}
+
+// Helper functions
+func respondWithError(w http.ResponseWriter, code int, message string) {
+	respondWithJSON(w, code, map[string]string{"error": message})
+}
+
+func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
+	response, _ := json.Marshal(payload)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(response)
+}
+
+// Middleware to check authentication (for future use)
+func RequireAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, err := utils.GetSessionFromRequest(r)
+		if err != nil {
+			respondWithError(w, http.StatusUnauthorized, "Authentication required")
+			return
+		}
+
+		session, err := utils.GetSessionByToken(token)
+		if err != nil {
+			respondWithError(w, http.StatusUnauthorized, "Invalid or expired session")
+			return
+		}
+
+		// Add user ID to request context for use in handlers
+		r.Header.Set("X-User-ID", session.UserID)
+		next(w, r)
+	}
+}
+
+// GetConversationsHandler handles GET /api/messages/conversations
+func GetConversationsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Get user from session
+	userID, err := getUserIDFromSession(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	// Get conversations from database
+	conversations, err := database.GetConversations(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to get conversations")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"conversations": conversations,
+	})
+}
+
+// GetMessageHistoryHandler handles GET /api/messages/history/{userID}
+func GetMessageHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Get user from session
+	currentUserID, err := getUserIDFromSession(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	// Extract other user ID from URL path
+	path := strings.TrimPrefix(r.URL.Path, "/api/messages/history/")
+	if path == "" {
+		respondWithError(w, http.StatusBadRequest, "User ID is required")
+		return
+	}
+	otherUserID := path
+
+	// Parse pagination parameters
+	limit, cursor, err := parsePageParams(r, 10)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Get message history from database
+	messageHistory, err := database.GetDirectMessageHistory(currentUserID, otherUserID, limit, cursor)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to get message history")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, messageHistory)
+}
+
+// MessagesHandler handles GET /api/messages and POST /api/messages
+func MessagesHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		CreateMessageHandler(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// CreateMessageHandler handles POST /api/messages - create new message
+func CreateMessageHandler(w http.ResponseWriter, r *http.Request) {
+	// Get user from session
+	userID, err := getUserIDFromSession(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	// Parse request body
+	var messageCreation models.MessageCreation
+	if err := json.Unmarshal([]byte(r.FormValue("data")), &messageCreation); err != nil {
+		// Try reading from request body if form data fails
+		decoder := json.NewDecoder(r.Body)
+		if err := decoder.Decode(&messageCreation); err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+	}
+
+	// Validate message
+	if err := messageCreation.Validate(); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Create message in database
+	message, err := database.CreateMessage(userID, &messageCreation)
+	if err != nil {
+		if strings.Contains(err.Error(), "attachment not found") {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+		} else if strings.Contains(err.Error(), "conversation not found") {
+			respondWithError(w, http.StatusNotFound, "Conversation not found")
+		} else if strings.Contains(err.Error(), "not found") {
+			respondWithError(w, http.StatusNotFound, "Receiver not found")
+		} else if strings.Contains(err.Error(), "blocked") {
+			respondWithError(w, http.StatusForbidden, "You cannot message this user")
+		} else {
+			respondWithError(w, http.StatusInternalServerError, "Failed to create message")
+		}
+		return
+	}
+
+	// Broadcast message via WebSocket to every member if hub is available
+	if wsHub != nil {
+		messageEvent := websocket.CreateMessageEvent(message)
+		wsHub.BroadcastToConversation(message.ConversationID, messageEvent)
+	}
+	notifyMentions(database.CreateMessageMentions(message))
+
+	respondWithJSON(w, http.StatusCreated, map[string]interface{}{
+		"message": "Message sent successfully",
+		"data":    message,
+	})
+}
+
+// MessageDetailHandler handles PUT /api/messages/{id} (edit a message) and
+// DELETE /api/messages/{id}?scope=me|everyone (delete it for yourself or for every member)
+func MessageDetailHandler(w http.ResponseWriter, r *http.Request) {
+	// Get user from session
+	userID, err := getUserIDFromSession(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	messageID := strings.TrimPrefix(r.URL.Path, "/api/messages/")
+	if messageID == "" || strings.Contains(messageID, "/") {
+		respondWithError(w, http.StatusBadRequest, "Message ID required")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		UpdateMessageHandler(w, r, messageID, userID)
+	case http.MethodDelete:
+		DeleteMessageHandler(w, r, messageID, userID)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// UpdateMessageHandler handles PUT /api/messages/{id} - edit a message within the edit window
+func UpdateMessageHandler(w http.ResponseWriter, r *http.Request, messageID, userID string) {
+	var updateData models.MessageUpdate
+	if err := json.NewDecoder(r.Body).Decode(&updateData); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid JSON format")
+		return
+	}
+
+	// Validate input
+	if err := updateData.Validate(); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	message, mentions, err := database.UpdateMessage(messageID, userID, &updateData)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			respondWithError(w, http.StatusNotFound, "Message not found")
+		} else if strings.Contains(err.Error(), "unauthorized") || strings.Contains(err.Error(), "edit window") {
+			respondWithError(w, http.StatusForbidden, err.Error())
+		} else if strings.Contains(err.Error(), "deleted") {
+			respondWithError(w, http.StatusConflict, err.Error())
+		} else {
+			respondWithError(w, http.StatusInternalServerError, "Failed to update message")
+		}
+		return
+	}
+
+	// Update every member's open clients
+	if wsHub != nil {
+		wsHub.BroadcastToConversation(message.ConversationID, websocket.CreateMessageEditedEvent(message))
+	}
+	notifyMentions(mentions, nil)
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Message updated successfully",
+		"data":    message,
+	})
+}
+
+// DeleteMessageHandler handles DELETE /api/messages/{id}?scope=me|everyone.
+// Deleting for everyone leaves a tombstone; deleting for me hides the message from the caller only.
+func DeleteMessageHandler(w http.ResponseWriter, r *http.Request, messageID, userID string) {
+	scope := r.URL.Query().Get("scope")
+	if scope == "" {
+		scope = models.DeleteForMe
+	}
+
+	var message *models.Message
+	var err error
+	switch scope {
+	case models.DeleteForMe:
+		message, err = database.HideMessage(messageID, userID)
+	case models.DeleteForEveryone:
+		message, err = database.DeleteMessageForEveryone(messageID, userID)
+	default:
+		respondWithError(w, http.StatusBadRequest, "Scope must be me or everyone")
+		return
+	}
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			respondWithError(w, http.StatusNotFound, "Message not found")
+		} else if strings.Contains(err.Error(), "unauthorized") {
+			respondWithError(w, http.StatusForbidden, err.Error())
+		} else {
+			respondWithError(w, http.StatusInternalServerError, "Failed to delete message")
+		}
+		return
+	}
+
+	// A tombstone goes to every member; a hidden message only to the caller's other sessions
+	if wsHub != nil {
+		deletedEvent := websocket.CreateMessageDeletedEvent(message, scope, userID)
+		if scope == models.DeleteForEveryone {
+			wsHub.BroadcastToConversation(message.ConversationID, deletedEvent)
+		} else {
+			wsHub.BroadcastMessageFromAPI(deletedEvent, userID)
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]string{
+		"message": "Message deleted successfully",
+	})
+}
+
+// MarkMessagesReadHandler handles PUT /api/messages/read/{userID}
+func MarkMessagesReadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Get user from session
+	currentUserID, err := getUserIDFromSession(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	// Extract sender user ID from URL path
+	path := strings.TrimPrefix(r.URL.Path, "/api/messages/read/")
+	if path == "" {
+		respondWithError(w, http.StatusBadRequest, "Sender user ID is required")
+		return
+	}
+	senderUserID := path
+
+	// Mark messages as read
+	read, err := database.MarkMessagesAsRead(currentUserID, senderUserID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to mark messages as read")
+		return
+	}
+
+	respondWithReadReceipts(w, currentUserID, read)
+}
+
+// respondWithReadReceipts pushes read receipts to the original senders and
+// replies with the IDs of the messages that were marked read
+func respondWithReadReceipts(w http.ResponseWriter, readerID string, read []models.Message) {
+	if wsHub != nil && len(read) > 0 {
+		wsHub.SendReadReceipts(read[0].ConversationID, readerID, read)
+	}
+
+	messageIDs := make([]string, 0, len(read))
+	for _, message := range read {
+		messageIDs = append(messageIDs, message.ID)
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"message":     "Messages marked as read",
+		"message_ids": messageIDs,
+	})
+}
+
+// ConversationsHandler handles GET /api/conversations (direct and group
+// conversations) and POST /api/conversations (create a group conversation)
+func ConversationsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		GetConversationsHandler(w, r)
+	case http.MethodPost:
+		CreateConversationHandler(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// CreateConversationHandler handles POST /api/conversations - create a group conversation
+func CreateConversationHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromSession(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	var conversationData models.ConversationCreation
+	if err := json.NewDecoder(r.Body).Decode(&conversationData); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid JSON format")
+		return
+	}
+
+	// Validate input
+	if err := conversationData.Validate(); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	conversation, err := database.CreateGroupConversation(userID, &conversationData)
+	if err != nil {
+		respondWithConversationError(w, err, "Failed to create conversation")
+		return
+	}
+
+	if wsHub != nil {
+		wsHub.NotifyConversationUpdated(conversation.ID)
+	}
+
+	respondWithJSON(w, http.StatusCreated, map[string]interface{}{
+		"message":      "Conversation created successfully",
+		"conversation": conversation,
+	})
+}
+
+// ConversationDetailHandler handles /api/conversations/{id}, /api/conversations/{id}/messages,
+// /api/conversations/{id}/read, /api/conversations/{id}/members and /api/conversations/{id}/members/{userID}
+func ConversationDetailHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromSession(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/api/conversations/")
+	parts := strings.Split(path, "/")
+	if parts[0] == "" {
+		respondWithError(w, http.StatusBadRequest, "Conversation ID required")
+		return
+	}
+	conversationID := parts[0]
+
+	switch {
+	case len(parts) == 1:
+		switch r.Method {
+		case http.MethodGet:
+			GetConversationHandler(w, r, conversationID, userID)
+		case http.MethodPut:
+			RenameConversationHandler(w, r, conversationID, userID)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+
+	case len(parts) == 2 && parts[1] == "messages":
+		switch r.Method {
+		case http.MethodGet:
+			GetConversationMessagesHandler(w, r, conversationID, userID)
+		case http.MethodPost:
+			CreateConversationMessageHandler(w, r, conversationID, userID)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+
+	case len(parts) == 2 && parts[1] == "read":
+		if r.Method != http.MethodPut {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		read, err := database.MarkConversationRead(conversationID, userID)
+		if err != nil {
+			respondWithConversationError(w, err, "Failed to mark messages as read")
+			return
+		}
+		respondWithReadReceipts(w, userID, read)
+
+	case len(parts) == 2 && parts[1] == "members":
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		AddConversationMembersHandler(w, r, conversationID, userID)
+
+	case len(parts) == 3 && parts[1] == "members" && parts[2] != "":
+		switch r.Method {
+		case http.MethodPut:
+			UpdateConversationMemberHandler(w, r, conversationID, userID, parts[2])
+		case http.MethodDelete:
+			RemoveConversationMemberHandler(w, r, conversationID, userID, parts[2])
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+
+	default:
+		respondWithError(w, http.StatusNotFound, "Not found")
+	}
+}
+
+// GetConversationHandler handles GET /api/conversations/{id}
+func GetConversationHandler(w http.ResponseWriter, r *http.Request, conversationID, userID string) {
+	conversation, err := database.GetConversation(conversationID, userID)
+	if err != nil {
+		respondWithConversationError(w, err, "Failed to get conversation")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, conversation)
+}
+
+// RenameConversationHandler handles PUT /api/conversations/{id} - rename a group conversation
+func RenameConversationHandler(w http.ResponseWriter, r *http.Request, conversationID, userID string) {
+	var updateData models.ConversationUpdate
+	if err := json.NewDecoder(r.Body).Decode(&updateData); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid JSON format")
+		return
+	}
+
+	// Validate input
+	if err := updateData.Validate(); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := database.RenameConversation(conversationID, userID, updateData.Name); err != nil {
+		respondWithConversationError(w, err, "Failed to rename conversation")
+		return
+	}
+
+	if wsHub != nil {
+		wsHub.NotifyConversationUpdated(conversationID)
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]string{
+		"message": "Conversation renamed successfully",
+	})
+}
+
+// GetConversationMessagesHandler handles GET /api/conversations/{id}/messages
+func GetConversationMessagesHandler(w http.ResponseWriter, r *http.Request, conversationID, userID string) {
+	// Parse pagination parameters
+	limit, cursor, err := parsePageParams(r, 10)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	messageHistory, err := database.GetMessageHistory(conversationID, userID, limit, cursor)
+	if err != nil {
+		respondWithConversationError(w, err, "Failed to get message history")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, messageHistory)
+}
+
+// CreateConversationMessageHandler handles POST /api/conversations/{id}/messages
+func CreateConversationMessageHandler(w http.ResponseWriter, r *http.Request, conversationID, userID string) {
+	var messageCreation models.MessageCreation
+	if err := json.NewDecoder(r.Body).Decode(&messageCreation); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid JSON format")
+		return
+	}
+
+	// The conversation comes from the path
+	messageCreation.ConversationID = conversationID
+	messageCreation.ReceiverID = ""
+	if err := messageCreation.Validate(); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	message, err := database.CreateMessage(userID, &messageCreation)
+	if err != nil {
+		if strings.Contains(err.Error(), "attachment not found") {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+		} else if strings.Contains(err.Error(), "blocked") {
+			respondWithError(w, http.StatusForbidden, "You cannot message this user")
+		} else {
+			respondWithConversationError(w, err, "Failed to create message")
+		}
+		return
+	}
+
+	if wsHub != nil {
+		wsHub.BroadcastToConversation(conversationID, websocket.CreateMessageEvent(message))
+	}
+	notifyMentions(database.CreateMessageMentions(message))
+
+	respondWithJSON(w, http.StatusCreated, map[string]interface{}{
+		"message": "Message sent successfully",
+		"data":    message,
+	})
+}
+
+// AddConversationMembersHandler handles POST /api/conversations/{id}/members
+func AddConversationMembersHandler(w http.ResponseWriter, r *http.Request, conversationID, userID string) {
+	var additionData models.MemberAddition
+	if err := json.NewDecoder(r.Body).Decode(&additionData); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid JSON format")
+		return
+	}
+
+	// Validate input
+	if err := additionData.Validate(); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	added, err := database.AddConversationMembers(conversationID, userID, additionData.UserIDs)
+	if err != nil {
+		respondWithConversationError(w, err, "Failed to add members")
+		return
+	}
+
+	if wsHub != nil && len(added) > 0 {
+		wsHub.NotifyConversationUpdated(conversationID)
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Members added successfully",
+		"added":   added,
+	})
+}
+
+// UpdateConversationMemberHandler handles PUT /api/conversations/{id}/members/{userID} - change a member's role
+func UpdateConversationMemberHandler(w http.ResponseWriter, r *http.Request, conversationID, userID, memberID string) {
+	var roleData models.MemberRoleUpdate
+	if err := json.NewDecoder(r.Body).Decode(&roleData); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid JSON format")
+		return
+	}
+
+	// Validate input
+	if err := roleData.Validate(); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := database.SetConversationMemberRole(conversationID, userID, memberID, roleData.Role); err != nil {
+		respondWithConversationError(w, err, "Failed to update member role")
+		return
+	}
+
+	if wsHub != nil {
+		wsHub.NotifyConversationUpdated(conversationID)
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]string{
+		"message": "Member role updated successfully",
+	})
+}
+
+// RemoveConversationMemberHandler handles DELETE /api/conversations/{id}/members/{userID}.
+// Members remove themselves to leave the conversation.
+func RemoveConversationMemberHandler(w http.ResponseWriter, r *http.Request, conversationID, userID, memberID string) {
+	if err := database.RemoveConversationMember(conversationID, userID, memberID); err != nil {
+		respondWithConversationError(w, err, "Failed to remove member")
+		return
+	}
+
+	if wsHub != nil {
+		wsHub.NotifyConversationRemoved(conversationID, memberID)
+		wsHub.NotifyConversationUpdated(conversationID)
+	}
+
+	message := "Member removed successfully"
+	if memberID == userID {
+		message = "Left conversation successfully"
+	}
+	respondWithJSON(w, http.StatusOK, map[string]string{
+		"message": message,
+	})
+}
+
+// respondWithConversationError maps a conversation error to a response.
+// Errors from the database itself are hidden behind the fallback message.
+func respondWithConversationError(w http.ResponseWriter, err error, fallback string) {
+	message := err.Error()
+	switch {
+	case strings.Contains(message, "not found"):
+		respondWithError(w, http.StatusNotFound, message)
+	case strings.Contains(message, "unauthorized"), strings.Contains(message, "blocked"):
+		respondWithError(w, http.StatusForbidden, message)
+	case strings.Contains(message, "failed to"):
+		respondWithError(w, http.StatusInternalServerError, fallback)
+	default:
+		respondWithError(w, http.StatusBadRequest, message)
+	}
+}
+
+// GetOnlineUsersHandler handles GET /api/users/online
+func GetOnlineUsersHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Get user from session (authentication required)
+	userID, err := getUserIDFromSession(r)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "No active session")
+		respondWithError(w, http.StatusUnauthorized, "Authentication required")
 		return
 	}
 
-	// Get session from database
-	session, err := utils.GetSessionByToken(token)
+	// Get online users from persisted presence (kept in sync by the WebSocket hub)
+	statuses, err := database.GetAllOnlineUsers()
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Invalid or expired session")
+		respondWithError(w, http.StatusInternalServerError, "Failed to get online users")
 		return
 	}
 
-	// Get user data
-	user, err := database.GetUserByID(session.UserID)
+	// Match the hub, which hides presence between users on either side of a block
+	blockedPeers, err := database.GetBlockedPeers(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to get online users")
+		return
+	}
+	onlineUsers := []models.UserStatus{}
+	for _, status := range statuses {
+		if !blockedPeers[status.UserID] {
+			onlineUsers = append(onlineUsers, status)
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"users": onlineUsers,
+		"count": len(onlineUsers),
+	})
+}
+
+// BlocksHandler handles GET /api/blocks (users I have blocked) and POST /api/blocks (block a user)
+func BlocksHandler(w http.ResponseWriter, r *http.Request) {
+	// Get user from session
+	userID, err := getUserIDFromSession(r)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Failed to get user data")
+		respondWithError(w, http.StatusUnauthorized, "Authentication required")
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, map[string]interface{}{
-		"user": user,
-	})
-}
+	switch r.Method {
+	case http.MethodGet:
+		blocked, err := database.GetBlockedUsers(userID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve blocked users")
+			return
+		}
 
-// Helper functions
-func respondWithError(w http.ResponseWriter, code int, message string) {
-	respondWithJSON(w, code, map[string]string{"error": message})
-}
+		respondWithJSON(w, http.StatusOK, map[string]interface{}{
+			"blocked": blocked,
+			"count":   len(blocked),
+		})
 
-func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
-	response, _ := json.Marshal(payload)
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(code)
-	w.Write(response)
-}
+	case http.MethodPost:
+		var blockData models.BlockCreation
+		if err := json.NewDecoder(r.Body).Decode(&blockData); err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid JSON format")
+			return
+		}
 
-// Middleware to check authentication (for future use)
-func RequireAuth(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		token, err := utils.GetSessionFromRequest(r)
-		if err != nil {
-			respondWithError(w, http.StatusUnauthorized, "Authentication required")
+		// Validate input
+		if err := blockData.Validate(); err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
 			return
 		}
 
-		session, err := utils.GetSessionByToken(token)
-		if err != nil {
-			respondWithError(w, http.StatusUnauthorized, "Invalid or expired session")
+		if err := database.BlockUser(userID, blockData.UserID); err != nil {
+			if strings.Contains(err.Error(), "not found") {
+				respondWithError(w, http.StatusNotFound, "User not found")
+			} else if strings.Contains(err.Error(), "yourself") {
+				respondWithError(w, http.StatusBadRequest, err.Error())
+			} else {
+				respondWithError(w, http.StatusInternalServerError, "Failed to block user")
+			}
 			return
 		}
 
-		// Add user ID to request context for use in handlers
-		r.Header.Set("X-User-ID", session.UserID)
-		next(w, r)
+		// Stop live typing and presence between the pair
+		if wsHub != nil {
+			wsHub.ApplyBlock(userID, blockData.UserID)
+		}
+
+		respondWithJSON(w, http.StatusOK, map[string]string{
+			"message": "User blocked successfully",
+		})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 	}
 }
 
-// GetConversationsHandler handles GET /api/messages/conversations
-func GetConversationsHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
+// UnblockUserHandler handles DELETE /api/blocks/{userID}
+func UnblockUserHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
@@ -511,242 +2057,384 @@ func GetConversationsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get conversations from database
-	conversations, err := database.GetConversations(userID)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Failed to get conversations")
+	blockedID := strings.TrimPrefix(r.URL.Path, "/api/blocks/")
+	if blockedID == "" || strings.Contains(blockedID, "/") {
+		respondWithError(w, http.StatusBadRequest, "User ID is required")
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, map[string]interface{}{
-		"conversations": conversations,
+	if err := database.UnblockUser(userID, blockedID); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			respondWithError(w, http.StatusNotFound, "Block not found")
+		} else {
+			respondWithError(w, http.StatusInternalServerError, "Failed to unblock user")
+		}
+		return
+	}
+
+	if wsHub != nil {
+		wsHub.ApplyUnblock(userID, blockedID)
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]string{
+		"message": "User unblocked successfully",
 	})
 }
 
-// GetMessageHistoryHandler handles GET /api/messages/history/{userID}
-func GetMessageHistoryHandler(w http.ResponseWriter, r *http.Request) {
+// GetUserStatsHandler handles GET /api/users/stats
+func GetUserStatsHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	// Get user from session
-	currentUserID, err := getUserIDFromSession(r)
+	// Authenticate user
+	_, err := getUserIDFromSession(r)
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, "Authentication required")
 		return
 	}
 
-	// Extract other user ID from URL path
-	path := strings.TrimPrefix(r.URL.Path, "/api/messages/history/")
-	if path == "" {
-		respondWithError(w, http.StatusBadRequest, "User ID is required")
+	// Get online user count from persisted presence
+	onlineCount, err := database.GetOnlineUserCount()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to get online user count")
 		return
 	}
-	otherUserID := path
 
-	// Parse pagination parameters
-	limitStr := r.URL.Query().Get("limit")
-	offsetStr := r.URL.Query().Get("offset")
+	// Get total registered users from database
+	totalUsers, err := database.GetTotalUserCount()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to get user statistics")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"total_users":   totalUsers,
+		"online_users":  onlineCount,
+		"offline_users": totalUsers - onlineCount,
+	})
+}
+
+// SearchHandler handles GET /api/search - ranked full-text search
+func SearchHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
 
-	limit := 10 // Default limit
-	if limitStr != "" {
+	params := r.URL.Query()
+	query := models.SearchQuery{
+		Query:    params.Get("q"),
+		Scope:    params.Get("scope"),
+		Category: params.Get("category"),
+		Author:   params.Get("author"),
+		Limit:    20,
+	}
+	if query.Scope == "" {
+		query.Scope = models.SearchScopeAll
+	}
+	if limitStr := params.Get("limit"); limitStr != "" {
 		if parsedLimit, err := strconv.Atoi(limitStr); err == nil && parsedLimit > 0 && parsedLimit <= 50 {
-			limit = parsedLimit
+			query.Limit = parsedLimit
 		}
 	}
 
-	offset := 0 // Default offset
-	if offsetStr != "" {
-		if parsedOffset, err := strconv.Atoi(offsetStr); err == nil && parsedOffset >= 0 {
-			offset = parsedOffset
-		}
+	// Parse the date range, where a bare "to" date includes that whole day
+	var err error
+	if query.From, err = parseSearchDate(params.Get("from"), false); err != nil {
+		respondWithError(w, http.StatusBadRequest, "from must be a date (YYYY-MM-DD) or RFC 3339 timestamp")
+		return
+	}
+	if query.To, err = parseSearchDate(params.Get("to"), true); err != nil {
+		respondWithError(w, http.StatusBadRequest, "to must be a date (YYYY-MM-DD) or RFC 3339 timestamp")
+		return
 	}
 
-	// Get message history from database
-	messageHistory, err := database.GetMessageHistory(currentUserID, otherUserID, limit, offset)
+	// Validate input
+	if err := query.Validate(); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Messages can only be searched by a participant
+	viewerID := getOptionalUserID(r)
+	if query.Scope == models.SearchScopeMessages && viewerID == "" {
+		respondWithError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	results, err := database.Search(&query, viewerID)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Failed to get message history")
+		respondWithError(w, http.StatusInternalServerError, "Failed to search")
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, messageHistory)
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"results": results,
+		"query":   query.Query,
+		"scope":   query.Scope,
+		"count":   len(results),
+	})
 }
 
-// MessagesHandler handles GET /api/messages and POST /api/messages
-func MessagesHandler(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-	case http.MethodPost:
-		CreateMessageHandler(w, r)
-	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+// parseSearchDate parses a search date filter, returning nil when it is empty
+func parseSearchDate(value string, endOfDay bool) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return nil, err
 	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return &t, nil
 }
 
-// CreateMessageHandler handles POST /api/messages - create new message
-func CreateMessageHandler(w http.ResponseWriter, r *http.Request) {
-	// Get user from session
+// AttachmentsHandler handles POST /api/attachments - upload a file as multipart field "file"
+func AttachmentsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
 	userID, err := getUserIDFromSession(r)
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, "Authentication required")
 		return
 	}
 
-	// Parse request body
-	var messageCreation models.MessageCreation
-	if err := json.Unmarshal([]byte(r.FormValue("data")), &messageCreation); err != nil {
-		// Try reading from request body if form data fails
-		decoder := json.NewDecoder(r.Body)
-		if err := decoder.Decode(&messageCreation); err != nil {
-			respondWithError(w, http.StatusBadRequest, "Invalid request body")
-			return
+	// Leave room for the multipart headers around the largest allowed file
+	r.Body = http.MaxBytesReader(w, r.Body, models.MaxAttachmentSize+1<<20)
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			respondWithError(w, http.StatusRequestEntityTooLarge, "file is too large")
+		} else {
+			respondWithError(w, http.StatusBadRequest, "A file is required")
 		}
+		return
 	}
+	defer file.Close()
 
-	// Validate message
-	if err := messageCreation.Validate(); err != nil {
-		respondWithError(w, http.StatusBadRequest, err.Error())
+	data, err := io.ReadAll(io.LimitReader(file, models.MaxAttachmentSize+1))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Failed to read file")
 		return
 	}
 
-	// Create message in database
-	message, err := database.CreateMessage(userID, &messageCreation)
+	// The declared content type is ignored; only the sniffed one is trusted
+	mimeType, err := models.ValidateAttachment(http.DetectContentType(data), int64(len(data)))
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Failed to create message")
+		if strings.Contains(err.Error(), "too large") {
+			respondWithError(w, http.StatusRequestEntityTooLarge, err.Error())
+		} else if strings.Contains(err.Error(), "unsupported") {
+			respondWithError(w, http.StatusUnsupportedMediaType, err.Error())
+		} else {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+		}
 		return
 	}
 
-	// Broadcast message via WebSocket if hub is available
-	if wsHub != nil {
-		messageEvent := websocket.CreateMessageEvent(message)
-		wsHub.BroadcastMessageFromAPI(messageEvent, message.ReceiverID)
+	key := uuid.New().String()
+	attachment := &models.Attachment{
+		UploaderID: userID,
+		Filename:   attachmentFilename(header.Filename),
+		MimeType:   mimeType,
+		Size:       int64(len(data)),
+		StorageKey: "attachments/" + key,
+	}
+
+	if strings.HasPrefix(mimeType, "image/") {
+		if width, height, err := utils.ImageSize(data); err == nil {
+			attachment.Width, attachment.Height = width, height
+		}
+		// Images the thumbnailer cannot handle, such as WebP, are stored without a thumbnail
+		if thumbnail, err := utils.GenerateThumbnail(data, models.ThumbnailSize); err == nil {
+			attachment.ThumbnailKey = "thumbnails/" + key + ".jpg"
+			if err := attachmentStore.Save(attachment.ThumbnailKey, bytes.NewReader(thumbnail)); err != nil {
+				respondWithError(w, http.StatusInternalServerError, "Failed to store file")
+				return
+			}
+		}
+	}
+
+	if err := attachmentStore.Save(attachment.StorageKey, bytes.NewReader(data)); err != nil {
+		database.DeleteAttachmentFiles(attachment)
+		respondWithError(w, http.StatusInternalServerError, "Failed to store file")
+		return
+	}
+
+	created, err := database.CreateAttachment(attachment)
+	if err != nil {
+		database.DeleteAttachmentFiles(attachment)
+		respondWithError(w, http.StatusInternalServerError, "Failed to save attachment")
+		return
 	}
 
 	respondWithJSON(w, http.StatusCreated, map[string]interface{}{
-		"message": "Message sent successfully",
-		"data":    message,
+		"message":    "File uploaded successfully",
+		"attachment": created,
 	})
 }
 
-// MarkMessagesReadHandler handles PUT /api/messages/read/{userID}
-func MarkMessagesReadHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPut {
+// AttachmentDetailHandler handles GET /api/attachments/{id} and /api/attachments/{id}/thumbnail
+func AttachmentDetailHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	// Get user from session
-	currentUserID, err := getUserIDFromSession(r)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Authentication required")
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/attachments/"), "/")
+	if parts[0] == "" || len(parts) > 2 || (len(parts) == 2 && parts[1] != "thumbnail") {
+		respondWithError(w, http.StatusNotFound, "Attachment not found")
 		return
 	}
+	thumbnail := len(parts) == 2
 
-	// Extract sender user ID from URL path
-	path := strings.TrimPrefix(r.URL.Path, "/api/messages/read/")
-	if path == "" {
-		respondWithError(w, http.StatusBadRequest, "Sender user ID is required")
+	// Files the user may not see are reported as missing
+	attachment, err := database.GetAttachment(parts[0], getOptionalUserID(r))
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			respondWithError(w, http.StatusNotFound, "Attachment not found")
+		} else {
+			respondWithError(w, http.StatusInternalServerError, "Failed to get attachment")
+		}
 		return
 	}
-	senderUserID := path
 
-	// Mark messages as read
-	err = database.MarkMessagesAsRead(currentUserID, senderUserID)
+	key, contentType := attachment.StorageKey, attachment.MimeType
+	if thumbnail {
+		if attachment.ThumbnailKey == "" {
+			respondWithError(w, http.StatusNotFound, "Thumbnail not found")
+			return
+		}
+		key, contentType = attachment.ThumbnailKey, "image/jpeg"
+	}
+
+	file, err := attachmentStore.Open(key)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Failed to mark messages as read")
+		if errors.Is(err, storage.ErrNotFound) {
+			respondWithError(w, http.StatusNotFound, "Attachment not found")
+		} else {
+			respondWithError(w, http.StatusInternalServerError, "Failed to get attachment")
+		}
 		return
 	}
+	defer file.Close()
 
-	respondWithJSON(w, http.StatusOK, map[string]interface{}{
-		"message": "Messages marked as read",
-	})
+	// Only images are shown inline; everything else downloads
+	disposition := "attachment"
+	if strings.HasPrefix(contentType, "image/") {
+		disposition = "inline"
+	}
+	if contentType == "text/plain" {
+		contentType = "text/plain; charset=utf-8"
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": attachment.Filename}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	if !thumbnail {
+		w.Header().Set("Content-Length", strconv.FormatInt(attachment.Size, 10))
+	}
+	w.WriteHeader(http.StatusOK)
+	io.Copy(w, file)
 }
 
-// GetOnlineUsersHandler handles GET /api/users/online
-func GetOnlineUsersHandler(w http.ResponseWriter, r *http.Request) {
+// attachmentFilename reduces an uploaded file name to a safe base name
+func attachmentFilename(name string) string {
+	name = strings.TrimSpace(filepath.Base(strings.ReplaceAll(name, "\\", "/")))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, name)
+	if runes := []rune(name); len(runes) > 255 {
+		name = string(runes[:255])
+	}
+	if name == "" || name == "." || name == "/" {
+		return "file"
+	}
+	return name
+}
+
+// GetMentionsHandler handles GET /api/mentions - the caller's unread mentions, newest first
+func GetMentionsHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	// Get user from session (authentication required)
-	_, err := getUserIDFromSession(r)
+	userID, err := getUserIDFromSession(r)
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, "Authentication required")
 		return
 	}
 
-	// Get online users from active sessions (users with valid sessions)
-	onlineUsers, err := database.GetActiveSessionUsers()
+	limit, cursor, err := parsePageParams(r, 20)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Failed to get online users")
+		respondWithError(w, http.StatusBadRequest, "Invalid cursor")
 		return
 	}
 
-	// Enhance with WebSocket connection status if hub is available
-	if wsHub != nil {
-		wsUsers := wsHub.GetOnlineUserDetails()
-		wsUserMap := make(map[string]bool)
-
-		// Create map of WebSocket connected users
-		for _, wsUser := range wsUsers {
-			if userID, ok := wsUser["user_id"].(string); ok {
-				wsUserMap[userID] = true
-			}
-		}
-
-		// Mark session users with WebSocket connection status
-		for i := range onlineUsers {
-			if userID, ok := onlineUsers[i]["user_id"].(string); ok {
-				onlineUsers[i]["websocket_connected"] = wsUserMap[userID]
-			} else {
-				onlineUsers[i]["websocket_connected"] = false
-			}
-		}
-	} else {
-		// If no WebSocket hub, mark all as not WebSocket connected
-		for i := range onlineUsers {
-			onlineUsers[i]["websocket_connected"] = false
-		}
+	mentions, err := database.GetUnreadMentions(userID, limit, cursor)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to get mentions")
+		return
 	}
 
-	respondWithJSON(w, http.StatusOK, map[string]interface{}{
-		"users": onlineUsers,
-		"count": len(onlineUsers),
-	})
+	respondWithJSON(w, http.StatusOK, mentions)
 }
 
-// GetUserStatsHandler handles GET /api/users/stats
-func GetUserStatsHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
+// MarkMentionsReadHandler handles PUT /api/mentions/read - mark the given mentions, or all of them, as read
+func MarkMentionsReadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	// Authenticate user
-	_, err := getUserIDFromSession(r)
+	userID, err := getUserIDFromSession(r)
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, "Authentication required")
 		return
 	}
 
-	// Get online user count from active sessions (users with valid sessions)
-	onlineCount, err := database.GetActiveSessionCount()
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Failed to get online user count")
+	// An empty body marks every mention as read
+	var read models.MentionsRead
+	if err := json.NewDecoder(r.Body).Decode(&read); err != nil && err != io.EOF {
+		respondWithError(w, http.StatusBadRequest, "Invalid JSON format")
+		return
+	}
+	if err := read.Validate(); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	// Get total registered users from database
-	totalUsers, err := database.GetTotalUserCount()
+	count, err := database.MarkMentionsRead(userID, read.IDs)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Failed to get user statistics")
+		respondWithError(w, http.StatusInternalServerError, "Failed to mark mentions as read")
 		return
 	}
 
 	respondWithJSON(w, http.StatusOK, map[string]interface{}{
-		"total_users":   totalUsers,
-		"online_users":  onlineCount,
-		"offline_users": totalUsers - onlineCount,
+		"message": "Mentions marked as read",
+		"count":   count,
 	})
 }
+
+// notifyMentions sends mention events for newly created mentions. Mentions are
+// best effort and never fail the request that created the content.
+func notifyMentions(mentions []models.Mention, err error) {
+	if err == nil && wsHub != nil {
+		wsHub.NotifyMentions(mentions)
+	}
+}
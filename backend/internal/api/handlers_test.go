@@ -0,0 +1,364 @@
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Tomlee-abila/real_time_forum/backend/internal/database"
+	"github.com/Tomlee-abila/real_time_forum/backend/internal/models"
+	"github.com/Tomlee-abila/real_time_forum/backend/internal/storage"
+	"github.com/Tomlee-abila/real_time_forum/backend/internal/utils"
+	"github.com/Tomlee-abila/real_time_forum/migrations"
+)
+
+func TestMain(m *testing.M) {
+	// Migrations log as they go, which only buries test failures
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// testUser is a registered user with a session cookie
+type testUser struct {
+	*models.User
+	cookie *http.Cookie
+}
+
+// newTestMux serves the API from a migrated in-memory database and a temporary attachment store
+func newTestMux(t *testing.T) (*http.ServeMux, storage.Storage) {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every connection to :memory: is a separate database
+	db.SetMaxOpenConns(1)
+	if err := database.Migrate(db, migrations.FS); err != nil {
+		t.Fatal(err)
+	}
+
+	previous := database.DB
+	database.DB = db
+	t.Cleanup(func() {
+		database.DB = previous
+		db.Close()
+	})
+
+	store, err := storage.NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	RegisterRoutes(mux, nil, store)
+	return mux, store
+}
+
+// newTestUser registers a user with the given role and signs them in
+func newTestUser(t *testing.T, nickname string, role models.Role) *testUser {
+	t.Helper()
+
+	user, err := database.CreateUser(&models.UserRegistration{
+		Nickname:  nickname,
+		Age:       30,
+		Gender:    "other",
+		FirstName: "Test",
+		LastName:  "Test",
+		Email:     nickname + "@example.com",
+		Password:  "password123",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if role != models.RoleUser {
+		if err := database.SetUserRole(user.ID, role); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	session, err := utils.CreateSession(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testUser{User: user, cookie: &http.Cookie{Name: "session_token", Value: session.Token}}
+}
+
+// serve sends a request, with a JSON body when body is not nil, as the user when set
+func serve(t *testing.T, mux *http.ServeMux, method, path string, body interface{}, user *testUser) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	r := httptest.NewRequest(method, path, reader)
+	if user != nil {
+		r.AddCookie(user.cookie)
+	}
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	return w
+}
+
+func TestPermissionChecks(t *testing.T) {
+	mux, _ := newTestMux(t)
+	users := map[string]*testUser{
+		"anonymous": nil,
+		"user":      newTestUser(t, "plain", models.RoleUser),
+		"moderator": newTestUser(t, "moderator", models.RoleModerator),
+		"admin":     newTestUser(t, "admin", models.RoleAdmin),
+	}
+
+	tests := []struct {
+		method string
+		path   string
+		want   map[string]int
+	}{
+		{http.MethodGet, "/api/moderation/reports", map[string]int{
+			"anonymous": http.StatusUnauthorized, "user": http.StatusForbidden,
+			"moderator": http.StatusOK, "admin": http.StatusOK,
+		}},
+		{http.MethodGet, "/api/admin/users", map[string]int{
+			"anonymous": http.StatusUnauthorized, "user": http.StatusForbidden,
+			"moderator": http.StatusForbidden, "admin": http.StatusOK,
+		}},
+	}
+
+	for _, tt := range tests {
+		for name, user := range users {
+			if got := serve(t, mux, tt.method, tt.path, nil, user).Code; got != tt.want[name] {
+				t.Errorf("%s %s as %s = %d, want %d", tt.method, tt.path, name, got, tt.want[name])
+			}
+		}
+	}
+}
+
+func TestAdminUserRoleHandler(t *testing.T) {
+	mux, _ := newTestMux(t)
+	admin := newTestUser(t, "admin", models.RoleAdmin)
+	user := newTestUser(t, "plain", models.RoleUser)
+
+	tests := []struct {
+		name   string
+		userID string
+		role   models.Role
+		want   int
+	}{
+		{"invalid role", user.ID, "owner", http.StatusBadRequest},
+		{"unknown user", "missing", models.RoleModerator, http.StatusNotFound},
+		{"last administrator", admin.ID, models.RoleUser, http.StatusConflict},
+		{"promote", user.ID, models.RoleModerator, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		w := serve(t, mux, http.MethodPut, "/api/admin/users/"+tt.userID+"/role", models.RoleUpdate{Role: tt.role}, admin)
+		if w.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d (%s)", tt.name, w.Code, tt.want, w.Body)
+		}
+	}
+
+	// The new role applies to the user's existing session
+	if got := serve(t, mux, http.MethodGet, "/api/moderation/reports", nil, user).Code; got != http.StatusOK {
+		t.Errorf("promoted moderator reading the queue = %d, want %d", got, http.StatusOK)
+	}
+}
+
+func TestModerationReportStatus(t *testing.T) {
+	mux, _ := newTestMux(t)
+	author := newTestUser(t, "author", models.RoleUser)
+	reporter := newTestUser(t, "reporter", models.RoleUser)
+	moderator := newTestUser(t, "moderator", models.RoleModerator)
+
+	post, err := database.CreatePost(author.ID, &models.PostCreation{Title: "Title", Content: "Body", Categories: []string{"general"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := models.ReportCreation{TargetType: models.ReportTargetPost, TargetID: post.ID, Reason: "spam"}
+
+	createReport := func() string {
+		t.Helper()
+		w := serve(t, mux, http.MethodPost, "/api/reports", report, reporter)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("create report = %d (%s)", w.Code, w.Body)
+		}
+		var response struct {
+			Report struct {
+				ID string `json:"id"`
+			} `json:"report"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+			t.Fatal(err)
+		}
+		return response.Report.ID
+	}
+
+	first := createReport()
+	if got := serve(t, mux, http.MethodPost, "/api/reports", report, reporter).Code; got != http.StatusConflict {
+		t.Errorf("second open report = %d, want %d", got, http.StatusConflict)
+	}
+
+	setStatus := func(reportID string, status models.ReportStatus) int {
+		t.Helper()
+		return serve(t, mux, http.MethodPut, "/api/moderation/reports/"+reportID,
+			models.ReportStatusUpdate{Status: status}, moderator).Code
+	}
+
+	steps := []struct {
+		name     string
+		reportID string
+		status   models.ReportStatus
+		want     int
+	}{
+		{"dismiss", first, models.ReportDismissed, http.StatusOK},
+		{"dismiss again", first, models.ReportDismissed, http.StatusConflict},
+		{"unknown status", first, "closed", http.StatusBadRequest},
+		{"unknown report", "missing", models.ReportOpen, http.StatusNotFound},
+	}
+	for _, step := range steps {
+		if got := setStatus(step.reportID, step.status); got != step.want {
+			t.Errorf("%s: status = %d, want %d", step.name, got, step.want)
+		}
+	}
+
+	// With a newer report open, the dismissed one cannot be reopened beside it
+	createReport()
+	if got := setStatus(first, models.ReportOpen); got != http.StatusConflict {
+		t.Errorf("reopen beside an open report = %d, want %d", got, http.StatusConflict)
+	}
+}
+
+func TestMessageEditHandler(t *testing.T) {
+	mux, _ := newTestMux(t)
+	alice := newTestUser(t, "alice", models.RoleUser)
+	bob := newTestUser(t, "bob", models.RoleUser)
+
+	send := func(content string) *models.Message {
+		t.Helper()
+		message, err := database.CreateMessage(alice.ID, &models.MessageCreation{
+			ReceiverID: bob.ID, Content: content, Format: models.MessageFormatPlain,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return message
+	}
+
+	recent := send("recent")
+	expired := send("expired")
+	if _, err := database.DB.Exec("UPDATE messages SET created_at = ? WHERE id = ?",
+		time.Now().Add(-models.MessageEditWindow-time.Minute), expired.ID); err != nil {
+		t.Fatal(err)
+	}
+	deleted := send("deleted")
+	if _, err := database.DeleteMessageForEveryone(deleted.ID, alice.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		messageID string
+		user      *testUser
+		content   string
+		want      int
+	}{
+		{"anonymous", recent.ID, nil, "x", http.StatusUnauthorized},
+		{"empty content", recent.ID, alice, "  ", http.StatusBadRequest},
+		{"unknown message", "missing", alice, "x", http.StatusNotFound},
+		{"not the sender", recent.ID, bob, "x", http.StatusForbidden},
+		{"edit window passed", expired.ID, alice, "x", http.StatusForbidden},
+		{"deleted", deleted.ID, alice, "x", http.StatusConflict},
+		{"sender within the window", recent.ID, alice, "edited", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		w := serve(t, mux, http.MethodPut, "/api/messages/"+tt.messageID, models.MessageUpdate{Content: tt.content}, tt.user)
+		if w.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d (%s)", tt.name, w.Code, tt.want, w.Body)
+		}
+	}
+
+	message, err := database.GetMessageByID(recent.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if message.Content != "edited" || message.EditedAt == nil {
+		t.Errorf("message = %+v, want it edited", message)
+	}
+}
+
+func TestAttachmentDownloadVisibility(t *testing.T) {
+	mux, store := newTestMux(t)
+	alice := newTestUser(t, "alice", models.RoleUser)
+	bob := newTestUser(t, "bob", models.RoleUser)
+	carol := newTestUser(t, "carol", models.RoleUser)
+
+	if err := store.Save("notes", strings.NewReader("hello")); err != nil {
+		t.Fatal(err)
+	}
+	attachment, err := database.CreateAttachment(&models.Attachment{
+		UploaderID: alice.ID, Filename: "notes.txt", MimeType: "text/plain", Size: 5, StorageKey: "notes",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := "/api/attachments/" + attachment.ID
+
+	// Before it is attached, only the uploader can fetch it
+	if got := serve(t, mux, http.MethodGet, path, nil, bob).Code; got != http.StatusNotFound {
+		t.Errorf("unattached file as another user = %d, want %d", got, http.StatusNotFound)
+	}
+
+	if _, err := database.CreateMessage(alice.ID, &models.MessageCreation{
+		ReceiverID: bob.ID, Content: "see attached", Format: models.MessageFormatPlain, AttachmentIDs: []string{attachment.ID},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		path string
+		user *testUser
+		want int
+	}{
+		{"sender", path, alice, http.StatusOK},
+		{"receiver", path, bob, http.StatusOK},
+		{"outsider", path, carol, http.StatusNotFound},
+		{"anonymous", path, nil, http.StatusNotFound},
+		{"missing thumbnail", path + "/thumbnail", bob, http.StatusNotFound},
+		{"unknown attachment", "/api/attachments/missing", alice, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		w := serve(t, mux, http.MethodGet, tt.path, nil, tt.user)
+		if w.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, w.Code, tt.want)
+			continue
+		}
+		if tt.want != http.StatusOK {
+			continue
+		}
+		if w.Body.String() != "hello" {
+			t.Errorf("%s: body = %q, want hello", tt.name, w.Body)
+		}
+		if got := w.Header().Get("Content-Disposition"); !strings.HasPrefix(got, "attachment;") {
+			t.Errorf("%s: Content-Disposition = %q, want a download", tt.name, got)
+		}
+		if got := w.Header().Get("X-Content-Type-Options"); got != "nosniff" {
+			t.Errorf("%s: X-Content-Type-Options = %q", tt.name, got)
+		}
+	}
+}
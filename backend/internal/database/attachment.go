@@ -0,0 +1,272 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Tomlee-abila/real_time_forum/backend/internal/models"
+	"github.com/Tomlee-abila/real_time_forum/backend/internal/storage"
+	"github.com/google/uuid"
+)
+
+// AttachmentStore holds the files of attachments. When it is set, deleting
+// attachments also deletes their files and thumbnails.
+var AttachmentStore storage.Storage
+
+// Columns of attachments that link them to what they are attached to
+const (
+	attachmentPostColumn    = "post_id"
+	attachmentMessageColumn = "message_id"
+)
+
+// attachmentColumns selects an attachment
+const attachmentColumns = `
+            a.id, a.uploader_id, a.filename, a.mime_type, a.size, a.width, a.height,
+            a.storage_key, a.thumbnail_key, COALESCE(a.post_id, ''), COALESCE(a.message_id, ''), a.created_at`
+
+// CreateAttachment records an uploaded file that is not attached to anything yet
+func CreateAttachment(attachment *models.Attachment) (*models.Attachment, error) {
+	attachment.ID = uuid.New().String()
+	attachment.CreatedAt = time.Now()
+
+	query := `
+        INSERT INTO attachments (id, uploader_id, filename, mime_type, size, width, height, storage_key, thumbnail_key, created_at)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+    `
+
+	_, err := DB.Exec(query, attachment.ID, attachment.UploaderID, attachment.Filename, attachment.MimeType,
+		attachment.Size, attachment.Width, attachment.Height, attachment.StorageKey, attachment.ThumbnailKey,
+		attachment.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create attachment: %w", err)
+	}
+
+	attachment.SetURLs()
+	return attachment, nil
+}
+
+// GetAttachment retrieves an attachment the user may download. Unattached files
+// are visible to their uploader, post attachments to everyone, and message
+// attachments to the members of the conversation while the message is not
+// deleted. Anything else is reported as not found.
+func GetAttachment(attachmentID, userID string) (*models.Attachment, error) {
+	query := `SELECT ` + attachmentColumns + `
+        FROM attachments a
+        LEFT JOIN posts p ON a.post_id = p.id
+        LEFT JOIN messages m ON a.message_id = m.id
+        WHERE a.id = ? AND (
+            (a.post_id IS NULL AND a.message_id IS NULL AND a.uploader_id = ?)
+            OR p.id IS NOT NULL
+            OR (m.deleted_at IS NULL AND EXISTS (
+                SELECT 1 FROM conversation_members cm
+                WHERE cm.conversation_id = m.conversation_id AND cm.user_id = ?
+            ))
+        )
+    `
+
+	rows, err := DB.Query(query, attachmentID, userID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get attachment: %w", err)
+	}
+	defer rows.Close()
+
+	attachments, err := scanAttachments(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(attachments) == 0 {
+		return nil, fmt.Errorf("attachment not found")
+	}
+
+	return &attachments[0], nil
+}
+
+// linkAttachments attaches a user's unattached uploads to a post or message
+func linkAttachments(tx *sql.Tx, column, targetID, uploaderID string, attachmentIDs []string) error {
+	query := `
+        UPDATE attachments SET ` + column + ` = ?
+        WHERE id = ? AND uploader_id = ? AND post_id IS NULL AND message_id IS NULL
+    `
+
+	for _, attachmentID := range attachmentIDs {
+		result, err := tx.Exec(query, targetID, attachmentID, uploaderID)
+		if err != nil {
+			return fmt.Errorf("failed to link attachment: %w", err)
+		}
+		if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+			return fmt.Errorf("attachment not found: %s", attachmentID)
+		}
+	}
+	return nil
+}
+
+// attachPostAttachments fills in the attachments of posts
+func attachPostAttachments(posts []models.Post) error {
+	ids := make([]string, len(posts))
+	for i := range posts {
+		ids[i] = posts[i].ID
+	}
+
+	attachments, err := getAttachmentsFor(attachmentPostColumn, ids)
+	if err != nil {
+		return err
+	}
+	for i := range posts {
+		posts[i].Attachments = attachments[posts[i].ID]
+	}
+	return nil
+}
+
+// attachMessageAttachments fills in the attachments of messages. Tombstones of
+// deleted messages get none.
+func attachMessageAttachments(messages []models.Message) error {
+	ids := make([]string, 0, len(messages))
+	for i := range messages {
+		if !messages[i].Deleted {
+			ids = append(ids, messages[i].ID)
+		}
+	}
+
+	attachments, err := getAttachmentsFor(attachmentMessageColumn, ids)
+	if err != nil {
+		return err
+	}
+	for i := range messages {
+		messages[i].Attachments = attachments[messages[i].ID]
+	}
+	return nil
+}
+
+// getAttachmentsFor retrieves the attachments linked to the given posts or messages, oldest first
+func getAttachmentsFor(column string, targetIDs []string) (map[string][]models.Attachment, error) {
+	byTarget := make(map[string][]models.Attachment)
+	if len(targetIDs) == 0 {
+		return byTarget, nil
+	}
+
+	args := make([]interface{}, len(targetIDs))
+	for i, id := range targetIDs {
+		args[i] = id
+	}
+
+	query := `SELECT ` + attachmentColumns + `
+        FROM attachments a
+        WHERE a.` + column + ` IN (` + queryPlaceholders(len(args)) + `)
+        ORDER BY a.created_at ASC, a.id ASC
+    `
+
+	rows, err := DB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get attachments: %w", err)
+	}
+	defer rows.Close()
+
+	attachments, err := scanAttachments(rows)
+	if err != nil {
+		return nil, err
+	}
+	for _, attachment := range attachments {
+		targetID := attachment.PostID
+		if column == attachmentMessageColumn {
+			targetID = attachment.MessageID
+		}
+		byTarget[targetID] = append(byTarget[targetID], attachment)
+	}
+	return byTarget, nil
+}
+
+// deleteAttachments removes the attachment rows linked to the given posts or
+// messages inside tx and returns them, so the caller can delete their files once
+// tx has committed.
+func deleteAttachments(tx *sql.Tx, column string, targetIDs []string) ([]models.Attachment, error) {
+	args := make([]interface{}, len(targetIDs))
+	for i, id := range targetIDs {
+		args[i] = id
+	}
+	condition := column + " IN (" + queryPlaceholders(len(args)) + ")"
+
+	rows, err := tx.Query(`SELECT `+attachmentColumns+` FROM attachments a WHERE a.`+condition, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get attachments: %w", err)
+	}
+	attachments, err := scanAttachments(rows)
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+	if len(attachments) == 0 {
+		return nil, nil
+	}
+
+	if _, err := tx.Exec("DELETE FROM attachments WHERE "+condition, args...); err != nil {
+		return nil, fmt.Errorf("failed to delete attachments: %w", err)
+	}
+	return attachments, nil
+}
+
+// RemoveOrphanedAttachments deletes attachments whose post is gone or whose
+// message was deleted for everyone, along with their files, and returns how many were removed
+func RemoveOrphanedAttachments() (int, error) {
+	query := `SELECT ` + attachmentColumns + `
+        FROM attachments a
+        LEFT JOIN posts p ON a.post_id = p.id
+        LEFT JOIN messages m ON a.message_id = m.id
+        WHERE (a.post_id IS NOT NULL AND p.id IS NULL)
+           OR (a.message_id IS NOT NULL AND (m.id IS NULL OR m.deleted_at IS NOT NULL))
+    `
+
+	rows, err := DB.Query(query)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get orphaned attachments: %w", err)
+	}
+	attachments, err := scanAttachments(rows)
+	rows.Close()
+	if err != nil {
+		return 0, err
+	}
+
+	for i := range attachments {
+		if _, err := DB.Exec("DELETE FROM attachments WHERE id = ?", attachments[i].ID); err != nil {
+			return i, fmt.Errorf("failed to delete attachment: %w", err)
+		}
+		DeleteAttachmentFiles(&attachments[i])
+	}
+	return len(attachments), nil
+}
+
+// DeleteAttachmentFiles removes an attachment's file and thumbnail from AttachmentStore
+func DeleteAttachmentFiles(attachment *models.Attachment) {
+	if AttachmentStore == nil {
+		return
+	}
+	for _, key := range []string{attachment.StorageKey, attachment.ThumbnailKey} {
+		if key == "" {
+			continue
+		}
+		if err := AttachmentStore.Delete(key); err != nil {
+			log.Printf("Error deleting attachment file %s: %v", key, err)
+		}
+	}
+}
+
+// scanAttachments scans rows selected with attachmentColumns
+func scanAttachments(rows *sql.Rows) ([]models.Attachment, error) {
+	var attachments []models.Attachment
+	for rows.Next() {
+		var attachment models.Attachment
+		err := rows.Scan(
+			&attachment.ID, &attachment.UploaderID, &attachment.Filename, &attachment.MimeType,
+			&attachment.Size, &attachment.Width, &attachment.Height,
+			&attachment.StorageKey, &attachment.ThumbnailKey, &attachment.PostID, &attachment.MessageID,
+			&attachment.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan attachment: %w", err)
+		}
+		attachment.SetURLs()
+		attachments = append(attachments, attachment)
+	}
+	return attachments, rows.Err()
+}
@@ -0,0 +1,173 @@
+package database
+
+import (
+	"io"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Tomlee-abila/real_time_forum/backend/internal/models"
+)
+
+// recordingStorage remembers which files were deleted
+type recordingStorage struct {
+	deleted []string
+}
+
+func (s *recordingStorage) Save(key string, r io.Reader) error     { return nil }
+func (s *recordingStorage) Open(key string) (io.ReadCloser, error) { return nil, io.EOF }
+func (s *recordingStorage) Delete(key string) error {
+	s.deleted = append(s.deleted, key)
+	return nil
+}
+
+// useRecordingStorage swaps AttachmentStore for a recordingStorage for the test
+func useRecordingStorage(t *testing.T) *recordingStorage {
+	t.Helper()
+
+	store := &recordingStorage{}
+	previous := AttachmentStore
+	AttachmentStore = store
+	t.Cleanup(func() { AttachmentStore = previous })
+	return store
+}
+
+// uploadTestAttachment records an unattached image with a thumbnail
+func uploadTestAttachment(t *testing.T, uploaderID, name string) *models.Attachment {
+	t.Helper()
+
+	attachment, err := CreateAttachment(&models.Attachment{
+		UploaderID:   uploaderID,
+		Filename:     name + ".png",
+		MimeType:     "image/png",
+		Size:         10,
+		StorageKey:   name,
+		ThumbnailKey: name + "-thumb",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return attachment
+}
+
+func TestGetAttachmentVisibility(t *testing.T) {
+	useTestDB(t)
+	useRecordingStorage(t)
+	alice := createTestUser(t, "alice")
+	bob := createTestUser(t, "bob")
+	carol := createTestUser(t, "carol")
+
+	unattached := uploadTestAttachment(t, alice.ID, "unattached")
+	postFile := uploadTestAttachment(t, alice.ID, "post")
+	messageFile := uploadTestAttachment(t, alice.ID, "message")
+
+	if _, err := CreatePost(alice.ID, &models.PostCreation{
+		Title: "Files", Content: "see attached", Categories: []string{"general"}, AttachmentIDs: []string{postFile.ID},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	message, err := CreateMessage(alice.ID, &models.MessageCreation{
+		ReceiverID: bob.ID, Content: "see attached", Format: models.MessageFormatPlain, AttachmentIDs: []string{messageFile.ID},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type check struct {
+		name         string
+		attachmentID string
+		userID       string
+		visible      bool
+	}
+	checks := []check{
+		{"uploader sees an unattached file", unattached.ID, alice.ID, true},
+		{"others cannot see an unattached file", unattached.ID, bob.ID, false},
+		{"anyone sees a post attachment", postFile.ID, carol.ID, true},
+		{"sender sees a message attachment", messageFile.ID, alice.ID, true},
+		{"receiver sees a message attachment", messageFile.ID, bob.ID, true},
+		{"non-members cannot see a message attachment", messageFile.ID, carol.ID, false},
+		{"unknown attachment", "missing", alice.ID, false},
+	}
+
+	run := func(checks []check) {
+		for _, c := range checks {
+			attachment, err := GetAttachment(c.attachmentID, c.userID)
+			if !c.visible {
+				if err == nil || !strings.Contains(err.Error(), "attachment not found") {
+					t.Errorf("%s: err = %v, want not found", c.name, err)
+				}
+				continue
+			}
+			if err != nil {
+				t.Errorf("%s: %v", c.name, err)
+				continue
+			}
+			if attachment.URL != "/api/attachments/"+c.attachmentID || attachment.ThumbnailURL == "" {
+				t.Errorf("%s: URLs = %q, %q", c.name, attachment.URL, attachment.ThumbnailURL)
+			}
+		}
+	}
+	run(checks)
+
+	// Deleting the message for everyone removes its attachment for everyone
+	if _, err := DeleteMessageForEveryone(message.ID, alice.ID); err != nil {
+		t.Fatal(err)
+	}
+	run([]check{
+		{"sender after deletion", messageFile.ID, alice.ID, false},
+		{"receiver after deletion", messageFile.ID, bob.ID, false},
+	})
+}
+
+func TestDeletingContentDeletesAttachmentFiles(t *testing.T) {
+	useTestDB(t)
+	alice := createTestUser(t, "alice")
+	bob := createTestUser(t, "bob")
+
+	tests := []struct {
+		name   string
+		delete func(attachmentID string) error
+	}{
+		{"post", func(attachmentID string) error {
+			post, err := CreatePost(alice.ID, &models.PostCreation{
+				Title: "Files", Content: "see attached", Categories: []string{"general"}, AttachmentIDs: []string{attachmentID},
+			})
+			if err != nil {
+				return err
+			}
+			return DeletePost(post.ID, alice.ID, models.RoleUser)
+		}},
+		{"message", func(attachmentID string) error {
+			message, err := CreateMessage(alice.ID, &models.MessageCreation{
+				ReceiverID: bob.ID, Content: "see attached", Format: models.MessageFormatPlain, AttachmentIDs: []string{attachmentID},
+			})
+			if err != nil {
+				return err
+			}
+			_, err = DeleteMessageForEveryone(message.ID, alice.ID)
+			return err
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := useRecordingStorage(t)
+			attachment := uploadTestAttachment(t, alice.ID, tt.name)
+
+			if err := tt.delete(attachment.ID); err != nil {
+				t.Fatal(err)
+			}
+
+			if want := []string{tt.name, tt.name + "-thumb"}; !slices.Equal(store.deleted, want) {
+				t.Errorf("deleted files = %v, want %v", store.deleted, want)
+			}
+			var count int
+			if err := DB.QueryRow("SELECT COUNT(*) FROM attachments WHERE id = ?", attachment.ID).Scan(&count); err != nil {
+				t.Fatal(err)
+			}
+			if count != 0 {
+				t.Error("attachment row was kept")
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Tomlee-abila/real_time_forum/backend/internal/models"
+)
+
+// blockedBetweenCondition matches when either of two users has blocked the other.
+// It takes the two user expressions twice: (a, b, b, a).
+const blockedBetweenCondition = `EXISTS (
+            SELECT 1 FROM user_blocks b
+            WHERE (b.blocker_id = %s AND b.blocked_id = %s)
+               OR (b.blocker_id = %s AND b.blocked_id = %s)
+        )`
+
+// BlockUser blocks a user. Blocking someone already blocked is a no-op.
+func BlockUser(blockerID, blockedID string) error {
+	if blockerID == blockedID {
+		return fmt.Errorf("cannot block yourself")
+	}
+
+	if _, err := GetUserByID(blockedID); err != nil {
+		return fmt.Errorf("user not found")
+	}
+
+	query := `
+        INSERT OR IGNORE INTO user_blocks (blocker_id, blocked_id, created_at)
+        VALUES (?, ?, ?)
+    `
+
+	_, err := DB.Exec(query, blockerID, blockedID, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to block user: %w", err)
+	}
+	return nil
+}
+
+// UnblockUser removes a block
+func UnblockUser(blockerID, blockedID string) error {
+	result, err := DB.Exec("DELETE FROM user_blocks WHERE blocker_id = ? AND blocked_id = ?", blockerID, blockedID)
+	if err != nil {
+		return fmt.Errorf("failed to unblock user: %w", err)
+	}
+	if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+		return fmt.Errorf("block not found")
+	}
+	return nil
+}
+
+// GetBlockedUsers retrieves the users a user has blocked, most recent first
+func GetBlockedUsers(blockerID string) ([]models.BlockedUser, error) {
+	query := `
+        SELECT b.blocked_id, u.nickname, b.created_at
+        FROM user_blocks b
+        JOIN users u ON b.blocked_id = u.id
+        WHERE b.blocker_id = ?
+        ORDER BY b.created_at DESC
+    `
+
+	rows, err := DB.Query(query, blockerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get blocked users: %w", err)
+	}
+	defer rows.Close()
+
+	blocked := []models.BlockedUser{}
+	for rows.Next() {
+		var user models.BlockedUser
+		if err := rows.Scan(&user.UserID, &user.Nickname, &user.BlockedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan blocked user: %w", err)
+		}
+		blocked = append(blocked, user)
+	}
+
+	return blocked, nil
+}
+
+// IsBlockedBetween reports whether either user has blocked the other
+func IsBlockedBetween(userID1, userID2 string) (bool, error) {
+	return isBlockedBetween(DB, userID1, userID2)
+}
+
+// isBlockedBetween is IsBlockedBetween on the database or inside a transaction
+func isBlockedBetween(q querier, userID1, userID2 string) (bool, error) {
+	query := "SELECT " + fmt.Sprintf(blockedBetweenCondition, "?", "?", "?", "?")
+
+	var blocked bool
+	err := q.QueryRow(query, userID1, userID2, userID2, userID1).Scan(&blocked)
+	if err != nil {
+		return false, fmt.Errorf("failed to check block: %w", err)
+	}
+	return blocked, nil
+}
+
+// GetBlockedPeers returns the users that a user has blocked or been blocked by
+func GetBlockedPeers(userID string) (map[string]bool, error) {
+	query := `
+        SELECT blocked_id FROM user_blocks WHERE blocker_id = ?
+        UNION
+        SELECT blocker_id FROM user_blocks WHERE blocked_id = ?
+    `
+
+	rows, err := DB.Query(query, userID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get blocked peers: %w", err)
+	}
+	defer rows.Close()
+
+	peers := make(map[string]bool)
+	for rows.Next() {
+		var peerID string
+		if err := rows.Scan(&peerID); err != nil {
+			return nil, fmt.Errorf("failed to scan blocked peer: %w", err)
+		}
+		peers[peerID] = true
+	}
+
+	return peers, nil
+}
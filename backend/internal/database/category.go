@@ -0,0 +1,216 @@
+package database
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/Tomlee-abila/real_time_forum/backend/internal/models"
+)
+
+// categoryCache keeps the categories table in memory, since every post
+// creation and category subscription validates against it
+var categoryCache struct {
+	sync.RWMutex
+	categories []models.Category
+	loaded     bool
+}
+
+// GetCategories returns the categories in display order, optionally
+// including archived ones
+func GetCategories(includeArchived bool) ([]models.Category, error) {
+	all, err := loadCategories()
+	if err != nil {
+		return nil, err
+	}
+
+	categories := make([]models.Category, 0, len(all))
+	for _, category := range all {
+		if includeArchived || !category.Archived {
+			categories = append(categories, category)
+		}
+	}
+	return categories, nil
+}
+
+// GetCategoriesWithCounts returns the categories with their post counts
+func GetCategoriesWithCounts(includeArchived bool) ([]models.Category, error) {
+	categories, err := GetCategories(includeArchived)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range categories {
+		count, err := GetPostCountByCategory(categories[i].Slug)
+		if err != nil {
+			return nil, err
+		}
+		categories[i].PostCount = count
+	}
+	return categories, nil
+}
+
+// IsValidCategory reports whether a category exists. Archived categories
+// only count when includeArchived is set, since new posts cannot use them.
+func IsValidCategory(slug string, includeArchived bool) bool {
+	categories, err := loadCategories()
+	if err != nil {
+		return false
+	}
+
+	slug = strings.ToLower(slug)
+	return slices.ContainsFunc(categories, func(category models.Category) bool {
+		return category.Slug == slug && (includeArchived || !category.Archived)
+	})
+}
+
+// CreateCategory creates a new category
+func CreateCategory(category *models.CategoryCreation) (*models.Category, error) {
+	exists, err := categoryExists(category.Slug)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, fmt.Errorf("category already exists")
+	}
+
+	query := `
+        INSERT INTO categories (slug, name, description, sort_order)
+        VALUES (?, ?, ?, ?)
+    `
+
+	_, err = DB.Exec(query, category.Slug, category.Name, category.Description, category.SortOrder)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create category: %w", err)
+	}
+	invalidateCategories()
+
+	return &models.Category{
+		Slug:        category.Slug,
+		Name:        category.Name,
+		Description: category.Description,
+		SortOrder:   category.SortOrder,
+	}, nil
+}
+
+// UpdateCategory edits a category's details or archives it
+func UpdateCategory(slug string, update *models.CategoryUpdate) (*models.Category, error) {
+	query := `
+        UPDATE categories
+        SET name = ?, description = ?, sort_order = ?, archived = ?
+        WHERE slug = ?
+    `
+
+	result, err := DB.Exec(query, update.Name, update.Description, update.SortOrder, update.Archived, slug)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update category: %w", err)
+	}
+	if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+		return nil, fmt.Errorf("category not found")
+	}
+	invalidateCategories()
+
+	count, err := GetPostCountByCategory(slug)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.Category{
+		Slug:        slug,
+		Name:        update.Name,
+		Description: update.Description,
+		SortOrder:   update.SortOrder,
+		Archived:    update.Archived,
+		PostCount:   count,
+	}, nil
+}
+
+// DeleteCategory deletes a category that has no posts. Categories in use
+// have to be archived instead.
+func DeleteCategory(slug string) error {
+	exists, err := categoryExists(slug)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("category not found")
+	}
+
+	count, err := GetPostCountByCategory(slug)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return fmt.Errorf("category still has posts, archive it instead")
+	}
+
+	_, err = DB.Exec("DELETE FROM categories WHERE slug = ?", slug)
+	if err != nil {
+		return fmt.Errorf("failed to delete category: %w", err)
+	}
+	invalidateCategories()
+
+	return nil
+}
+
+// categoryExists checks if a category slug is taken, archived or not
+func categoryExists(slug string) (bool, error) {
+	var count int
+	err := DB.QueryRow("SELECT COUNT(*) FROM categories WHERE slug = ?", slug).Scan(&count)
+	if err != nil {
+		return false, fmt.Errorf("failed to check category: %w", err)
+	}
+	return count > 0, nil
+}
+
+// loadCategories returns the cached categories, reading them from the
+// database on first use or after a change
+func loadCategories() ([]models.Category, error) {
+	categoryCache.RLock()
+	if categoryCache.loaded {
+		categories := slices.Clone(categoryCache.categories)
+		categoryCache.RUnlock()
+		return categories, nil
+	}
+	categoryCache.RUnlock()
+
+	query := `
+        SELECT slug, name, description, sort_order, archived
+        FROM categories
+        ORDER BY sort_order ASC, name ASC
+    `
+
+	rows, err := DB.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get categories: %w", err)
+	}
+	defer rows.Close()
+
+	var categories []models.Category
+	for rows.Next() {
+		var category models.Category
+		err := rows.Scan(&category.Slug, &category.Name, &category.Description, &category.SortOrder, &category.Archived)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan category: %w", err)
+		}
+		categories = append(categories, category)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get categories: %w", err)
+	}
+
+	categoryCache.Lock()
+	categoryCache.categories = categories
+	categoryCache.loaded = true
+	categoryCache.Unlock()
+
+	return slices.Clone(categories), nil
+}
+
+// invalidateCategories makes the next lookup reload categories from the database
+func invalidateCategories() {
+	categoryCache.Lock()
+	categoryCache.loaded = false
+	categoryCache.Unlock()
+}
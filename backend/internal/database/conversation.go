@@ -0,0 +1,478 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/Tomlee-abila/real_time_forum/backend/internal/models"
+	"github.com/google/uuid"
+)
+
+// querier runs single-row queries on the database or inside a transaction
+type querier interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// conversationAccess describes a member's view of a conversation
+type conversationAccess struct {
+	Kind string
+	Role string
+	// PeerID is the other member of a direct conversation
+	PeerID string
+}
+
+// directKey returns the key shared by both members of a direct conversation
+func directKey(userID1, userID2 string) string {
+	if userID1 > userID2 {
+		userID1, userID2 = userID2, userID1
+	}
+	return userID1 + ":" + userID2
+}
+
+// getConversationAccess checks that a user is a member of a conversation.
+// Conversations the user is not in are reported as not found.
+func getConversationAccess(q querier, conversationID, userID string) (*conversationAccess, error) {
+	query := `
+        SELECT c.kind, me.role, COALESCE((
+            SELECT o.user_id FROM conversation_members o
+            WHERE o.conversation_id = c.id AND o.user_id != me.user_id
+            LIMIT 1
+        ), '')
+        FROM conversations c
+        JOIN conversation_members me ON me.conversation_id = c.id AND me.user_id = ?
+        WHERE c.id = ?
+    `
+
+	var access conversationAccess
+	err := q.QueryRow(query, userID, conversationID).Scan(&access.Kind, &access.Role, &access.PeerID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("conversation not found")
+		}
+		return nil, fmt.Errorf("failed to check conversation membership: %w", err)
+	}
+
+	return &access, nil
+}
+
+// GetDirectConversationID returns the ID of the direct conversation between two users
+func GetDirectConversationID(userID1, userID2 string) (string, error) {
+	var conversationID string
+	err := DB.QueryRow("SELECT id FROM conversations WHERE direct_key = ?", directKey(userID1, userID2)).Scan(&conversationID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", fmt.Errorf("conversation not found")
+		}
+		return "", fmt.Errorf("failed to get direct conversation: %w", err)
+	}
+	return conversationID, nil
+}
+
+// getOrCreateDirectConversation returns the direct conversation between two
+// users, creating it on their first message
+func getOrCreateDirectConversation(tx *sql.Tx, senderID, receiverID string) (string, error) {
+	key := directKey(senderID, receiverID)
+
+	var conversationID string
+	err := tx.QueryRow("SELECT id FROM conversations WHERE direct_key = ?", key).Scan(&conversationID)
+	if err == nil {
+		return conversationID, nil
+	}
+	if err != sql.ErrNoRows {
+		return "", fmt.Errorf("failed to get direct conversation: %w", err)
+	}
+
+	conversationID = uuid.New().String()
+	now := time.Now()
+	_, err = tx.Exec(`
+        INSERT INTO conversations (id, kind, created_by, direct_key, created_at)
+        VALUES (?, ?, ?, ?, ?)
+    `, conversationID, models.ConversationDirect, senderID, key, now)
+	if err != nil {
+		return "", fmt.Errorf("failed to create direct conversation: %w", err)
+	}
+
+	for _, userID := range []string{senderID, receiverID} {
+		if err := insertConversationMember(tx, conversationID, userID, models.MemberRoleMember, now); err != nil {
+			return "", err
+		}
+	}
+
+	return conversationID, nil
+}
+
+// CreateGroupConversation creates a group conversation with the creator and the given members
+func CreateGroupConversation(creatorID string, conversation *models.ConversationCreation) (*models.Conversation, error) {
+	others := 0
+	for _, userID := range conversation.MemberIDs {
+		if userID == creatorID {
+			continue
+		}
+		if err := checkCanAddMember(DB, creatorID, userID); err != nil {
+			return nil, err
+		}
+		others++
+	}
+	if others == 0 {
+		return nil, fmt.Errorf("at least one other member is required")
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	conversationID := uuid.New().String()
+	now := time.Now()
+
+	_, err = tx.Exec(`
+        INSERT INTO conversations (id, kind, name, created_by, created_at)
+        VALUES (?, ?, ?, ?, ?)
+    `, conversationID, models.ConversationGroup, conversation.Name, creatorID, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create conversation: %w", err)
+	}
+
+	if err := insertConversationMember(tx, conversationID, creatorID, models.MemberRoleCreator, now); err != nil {
+		return nil, err
+	}
+	for _, userID := range conversation.MemberIDs {
+		if userID == creatorID {
+			continue
+		}
+		if err := insertConversationMember(tx, conversationID, userID, models.MemberRoleMember, now); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit conversation: %w", err)
+	}
+
+	return GetConversation(conversationID, creatorID)
+}
+
+// GetConversation retrieves a conversation as seen by one of its members
+func GetConversation(conversationID, userID string) (*models.Conversation, error) {
+	conversations, err := queryConversations("c.id = ?", []interface{}{conversationID}, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(conversations) == 0 {
+		return nil, fmt.Errorf("conversation not found")
+	}
+	return &conversations[0], nil
+}
+
+// GetConversationMembers retrieves the members of a conversation, creator and admins first
+func GetConversationMembers(conversationID string) ([]models.ConversationMember, error) {
+	query := `
+        SELECT cm.user_id, COALESCE(u.nickname, ''), cm.role, cm.joined_at
+        FROM conversation_members cm
+        LEFT JOIN users u ON cm.user_id = u.id
+        WHERE cm.conversation_id = ?
+        ORDER BY CASE cm.role WHEN 'creator' THEN 0 WHEN 'admin' THEN 1 ELSE 2 END, cm.joined_at, u.nickname
+    `
+
+	rows, err := DB.Query(query, conversationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get conversation members: %w", err)
+	}
+	defer rows.Close()
+
+	members := []models.ConversationMember{}
+	for rows.Next() {
+		var member models.ConversationMember
+		if err := rows.Scan(&member.UserID, &member.Nickname, &member.Role, &member.JoinedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan conversation member: %w", err)
+		}
+		members = append(members, member)
+	}
+
+	return members, nil
+}
+
+// GetConversationMemberIDs returns the user IDs of a conversation's members
+func GetConversationMemberIDs(conversationID string) ([]string, error) {
+	return getConversationMemberIDs(DB, conversationID)
+}
+
+// getConversationMemberIDs is GetConversationMemberIDs on the database or inside a transaction
+func getConversationMemberIDs(q execer, conversationID string) ([]string, error) {
+	rows, err := q.Query("SELECT user_id FROM conversation_members WHERE conversation_id = ?", conversationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get conversation members: %w", err)
+	}
+	defer rows.Close()
+
+	var userIDs []string
+	for rows.Next() {
+		var userID string
+		if err := rows.Scan(&userID); err != nil {
+			return nil, fmt.Errorf("failed to scan conversation member: %w", err)
+		}
+		userIDs = append(userIDs, userID)
+	}
+
+	return userIDs, rows.Err()
+}
+
+// AddConversationMembers adds users to a group conversation. Only the creator
+// and admins can add members; users who are already members are skipped.
+// It returns the IDs of the users that were added.
+func AddConversationMembers(conversationID, actorID string, userIDs []string) ([]string, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	access, err := getConversationAccess(tx, conversationID, actorID)
+	if err != nil {
+		return nil, err
+	}
+	if access.Kind != models.ConversationGroup {
+		return nil, fmt.Errorf("members can only be added to group conversations")
+	}
+	if !models.CanManageMembers(access.Role) {
+		return nil, fmt.Errorf("unauthorized: only the creator and admins can add members")
+	}
+
+	var memberCount int
+	err = tx.QueryRow("SELECT COUNT(*) FROM conversation_members WHERE conversation_id = ?", conversationID).Scan(&memberCount)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count conversation members: %w", err)
+	}
+
+	now := time.Now()
+	added := []string{}
+	for _, userID := range userIDs {
+		if _, err := getConversationAccess(tx, conversationID, userID); err == nil {
+			continue
+		}
+		if err := checkCanAddMember(tx, actorID, userID); err != nil {
+			return nil, err
+		}
+		if memberCount >= models.MaxGroupMembers {
+			return nil, fmt.Errorf("conversation is full")
+		}
+		if err := insertConversationMember(tx, conversationID, userID, models.MemberRoleMember, now); err != nil {
+			return nil, err
+		}
+		memberCount++
+		added = append(added, userID)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit conversation members: %w", err)
+	}
+
+	return added, nil
+}
+
+// RemoveConversationMember removes a member from a group conversation. Members
+// can leave on their own; the creator and admins can remove members, and only
+// the creator can remove admins. The creator cannot leave or be removed.
+func RemoveConversationMember(conversationID, actorID, userID string) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	actor, err := getConversationAccess(tx, conversationID, actorID)
+	if err != nil {
+		return err
+	}
+	if actor.Kind != models.ConversationGroup {
+		return fmt.Errorf("members can only be removed from group conversations")
+	}
+
+	target, err := getConversationAccess(tx, conversationID, userID)
+	if err != nil {
+		return fmt.Errorf("member not found")
+	}
+
+	if target.Role == models.MemberRoleCreator {
+		return fmt.Errorf("the creator cannot leave or be removed from the conversation")
+	}
+	if actorID != userID {
+		if !models.CanManageMembers(actor.Role) {
+			return fmt.Errorf("unauthorized: only the creator and admins can remove members")
+		}
+		if target.Role == models.MemberRoleAdmin && actor.Role != models.MemberRoleCreator {
+			return fmt.Errorf("unauthorized: only the creator can remove admins")
+		}
+	}
+
+	_, err = tx.Exec("DELETE FROM conversation_members WHERE conversation_id = ? AND user_id = ?", conversationID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to remove conversation member: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit member removal: %w", err)
+	}
+	return nil
+}
+
+// SetConversationMemberRole makes a group member an admin or a plain member. Only the creator can do this.
+func SetConversationMemberRole(conversationID, actorID, userID, role string) error {
+	actor, err := getConversationAccess(DB, conversationID, actorID)
+	if err != nil {
+		return err
+	}
+	if actor.Kind != models.ConversationGroup {
+		return fmt.Errorf("roles only apply to group conversations")
+	}
+	if actor.Role != models.MemberRoleCreator {
+		return fmt.Errorf("unauthorized: only the creator can change member roles")
+	}
+
+	target, err := getConversationAccess(DB, conversationID, userID)
+	if err != nil {
+		return fmt.Errorf("member not found")
+	}
+	if target.Role == models.MemberRoleCreator {
+		return fmt.Errorf("the creator's role cannot be changed")
+	}
+
+	_, err = DB.Exec("UPDATE conversation_members SET role = ? WHERE conversation_id = ? AND user_id = ?",
+		role, conversationID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to update member role: %w", err)
+	}
+	return nil
+}
+
+// RenameConversation changes a group conversation's name. Only the creator and admins can do this.
+func RenameConversation(conversationID, actorID, name string) error {
+	actor, err := getConversationAccess(DB, conversationID, actorID)
+	if err != nil {
+		return err
+	}
+	if actor.Kind != models.ConversationGroup {
+		return fmt.Errorf("only group conversations can be renamed")
+	}
+	if !models.CanManageMembers(actor.Role) {
+		return fmt.Errorf("unauthorized: only the creator and admins can rename the conversation")
+	}
+
+	_, err = DB.Exec("UPDATE conversations SET name = ? WHERE id = ?", name, conversationID)
+	if err != nil {
+		return fmt.Errorf("failed to rename conversation: %w", err)
+	}
+	return nil
+}
+
+// checkCanAddMember checks that a user exists and that neither side has blocked the other
+func checkCanAddMember(q querier, actorID, userID string) error {
+	var exists int
+	if err := q.QueryRow("SELECT 1 FROM users WHERE id = ?", userID).Scan(&exists); err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("user not found: %s", userID)
+		}
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+
+	blocked, err := isBlockedBetween(q, actorID, userID)
+	if err != nil {
+		return err
+	}
+	if blocked {
+		return fmt.Errorf("blocked: you cannot add this user")
+	}
+	return nil
+}
+
+// insertConversationMember adds a member who has read everything before joining
+func insertConversationMember(tx *sql.Tx, conversationID, userID, role string, joinedAt time.Time) error {
+	query := `
+        INSERT OR IGNORE INTO conversation_members (conversation_id, user_id, role, joined_at, last_read_at)
+        VALUES (?, ?, ?, ?, ?)
+    `
+
+	_, err := tx.Exec(query, conversationID, userID, role, joinedAt, joinedAt)
+	if err != nil {
+		return fmt.Errorf("failed to add conversation member: %w", err)
+	}
+	return nil
+}
+
+// queryConversations retrieves the conversations matching a filter that the
+// user is a member of, most recently active first. Direct conversations with
+// users on either side of a block are left out.
+func queryConversations(filter string, filterArgs []interface{}, userID string) ([]models.Conversation, error) {
+	query := fmt.Sprintf(`
+        SELECT
+            c.id, c.kind, c.name, c.created_by, c.created_at, me.role,
+            COALESCE(peer.user_id, ''), COALESCE(pu.nickname, ''),
+            COALESCE(us.is_online, 0), us.last_seen
+        FROM conversations c
+        JOIN conversation_members me ON me.conversation_id = c.id AND me.user_id = ?
+        LEFT JOIN conversation_members peer ON c.kind = 'direct' AND peer.conversation_id = c.id AND peer.user_id != me.user_id
+        LEFT JOIN users pu ON peer.user_id = pu.id
+        LEFT JOIN user_status us ON peer.user_id = us.user_id
+        WHERE %s
+          AND NOT (c.kind = 'direct' AND %s)
+        ORDER BY COALESCE((SELECT MAX(m.created_at) FROM messages m WHERE m.conversation_id = c.id), c.created_at) DESC
+    `, filter, fmt.Sprintf(blockedBetweenCondition, "me.user_id", "peer.user_id", "peer.user_id", "me.user_id"))
+
+	args := append([]interface{}{userID}, filterArgs...)
+	rows, err := DB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get conversations: %w", err)
+	}
+	defer rows.Close()
+
+	conversations := []models.Conversation{}
+	for rows.Next() {
+		var conv models.Conversation
+		var lastSeen sql.NullTime
+
+		err := rows.Scan(
+			&conv.ID, &conv.Kind, &conv.Name, &conv.CreatedBy, &conv.CreatedAt, &conv.MyRole,
+			&conv.UserID, &conv.UserNickname, &conv.IsOnline, &lastSeen,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan conversation: %w", err)
+		}
+		if lastSeen.Valid {
+			conv.LastSeen = lastSeen.Time
+		}
+		conversations = append(conversations, conv)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get conversations: %w", err)
+	}
+
+	for i := range conversations {
+		conv := &conversations[i]
+
+		if conv.Kind == models.ConversationGroup {
+			conv.Members, err = GetConversationMembers(conv.ID)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			// Roles only mean something in groups
+			conv.MyRole = ""
+		}
+
+		// Get last message
+		lastMessage, err := GetLastMessage(conv.ID, userID)
+		if err == nil {
+			conv.LastMessage = lastMessage
+		}
+
+		// Get unread count
+		unreadCount, err := GetUnreadMessageCount(conv.ID, userID)
+		if err == nil {
+			conv.UnreadCount = unreadCount
+		}
+	}
+
+	return conversations, nil
+}
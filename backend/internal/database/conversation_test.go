@@ -0,0 +1,143 @@
+package database
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Tomlee-abila/real_time_forum/backend/internal/models"
+)
+
+// memberIDs returns the members of a conversation, sorted
+func memberIDs(t *testing.T, conversationID string) []string {
+	t.Helper()
+
+	ids, err := GetConversationMemberIDs(conversationID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func TestGroupConversationMembership(t *testing.T) {
+	useTestDB(t)
+	owner := createTestUser(t, "owner")
+	admin := createTestUser(t, "admin")
+	member := createTestUser(t, "member")
+	newcomer := createTestUser(t, "newcomer")
+	blocker := createTestUser(t, "blocker")
+	if err := BlockUser(blocker.ID, admin.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := CreateGroupConversation(owner.ID, &models.ConversationCreation{Name: "solo", MemberIDs: []string{owner.ID}}); err == nil {
+		t.Fatal("created a group without other members")
+	}
+	group, err := CreateGroupConversation(owner.ID, &models.ConversationCreation{Name: "team", MemberIDs: []string{admin.ID, member.ID}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if group.MyRole != models.MemberRoleCreator {
+		t.Errorf("creator's role = %q", group.MyRole)
+	}
+
+	steps := []struct {
+		name    string
+		run     func() error
+		wantErr string
+	}{
+		{"members cannot appoint admins", func() error {
+			return SetConversationMemberRole(group.ID, member.ID, admin.ID, models.MemberRoleAdmin)
+		}, "unauthorized"},
+		{"creator appoints an admin", func() error {
+			return SetConversationMemberRole(group.ID, owner.ID, admin.ID, models.MemberRoleAdmin)
+		}, ""},
+		{"members cannot add", func() error {
+			_, err := AddConversationMembers(group.ID, member.ID, []string{newcomer.ID})
+			return err
+		}, "unauthorized"},
+		{"admins cannot add users who blocked them", func() error {
+			_, err := AddConversationMembers(group.ID, admin.ID, []string{blocker.ID})
+			return err
+		}, "blocked"},
+		{"admins cannot add unknown users", func() error {
+			_, err := AddConversationMembers(group.ID, admin.ID, []string{"missing"})
+			return err
+		}, "user not found"},
+		{"admins add members, skipping existing ones", func() error {
+			added, err := AddConversationMembers(group.ID, admin.ID, []string{member.ID, newcomer.ID})
+			if err == nil && !slices.Equal(added, []string{newcomer.ID}) {
+				t.Errorf("added = %v, want only the newcomer", added)
+			}
+			return err
+		}, ""},
+		{"admins cannot remove the creator", func() error {
+			return RemoveConversationMember(group.ID, admin.ID, owner.ID)
+		}, "creator cannot leave"},
+		{"members cannot remove others", func() error {
+			return RemoveConversationMember(group.ID, member.ID, newcomer.ID)
+		}, "unauthorized"},
+		{"admins remove members", func() error {
+			return RemoveConversationMember(group.ID, admin.ID, newcomer.ID)
+		}, ""},
+		{"members leave on their own", func() error {
+			return RemoveConversationMember(group.ID, member.ID, member.ID)
+		}, ""},
+		{"former members lose access", func() error {
+			_, err := GetConversation(group.ID, member.ID)
+			return err
+		}, "conversation not found"},
+		{"admins rename", func() error {
+			return RenameConversation(group.ID, admin.ID, "renamed")
+		}, ""},
+	}
+
+	for _, step := range steps {
+		err := step.run()
+		if step.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), step.wantErr) {
+				t.Fatalf("%s: err = %v, want %q", step.name, err, step.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+	}
+
+	want := []string{owner.ID, admin.ID}
+	slices.Sort(want)
+	if got := memberIDs(t, group.ID); !slices.Equal(got, want) {
+		t.Errorf("members = %v, want %v", got, want)
+	}
+	conversation, err := GetConversation(group.ID, admin.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conversation.Name != "renamed" || conversation.MyRole != models.MemberRoleAdmin {
+		t.Errorf("conversation = %+v", conversation)
+	}
+}
+
+func TestDirectConversationsStayDirect(t *testing.T) {
+	useTestDB(t)
+	alice := createTestUser(t, "alice")
+	bob := createTestUser(t, "bob")
+	carol := createTestUser(t, "carol")
+
+	message := sendTestMessage(t, alice.ID, bob.ID, "hi")
+	if again := sendTestMessage(t, bob.ID, alice.ID, "hello"); again.ConversationID != message.ConversationID {
+		t.Errorf("reply went to conversation %s, want %s", again.ConversationID, message.ConversationID)
+	}
+
+	if _, err := AddConversationMembers(message.ConversationID, alice.ID, []string{carol.ID}); err == nil || !strings.Contains(err.Error(), "group conversations") {
+		t.Errorf("adding to a direct conversation: err = %v", err)
+	}
+	if err := RenameConversation(message.ConversationID, alice.ID, "pair"); err == nil || !strings.Contains(err.Error(), "group conversations") {
+		t.Errorf("renaming a direct conversation: err = %v", err)
+	}
+	if _, err := GetConversation(message.ConversationID, carol.ID); err == nil {
+		t.Error("an outsider can see the direct conversation")
+	}
+}
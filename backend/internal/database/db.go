@@ -2,10 +2,9 @@ package database
 
 import (
 	"database/sql"
-	"fmt"
 	"log"
-	"os"
 
+	"github.com/Tomlee-abila/real_time_forum/migrations"
 	_ "github.com/mattn/go-sqlite3"
 )
 
@@ -14,6 +13,9 @@ var DB *sql.DB
 func Init() {
 	var openErr error
 
+	// Foreign key enforcement stays off, SQLite's default, so the REFERENCES
+	// clauses in the migrations only document relationships. Code that deletes
+	// a row deletes the rows that depend on it in the same transaction.
 	DB, openErr = sql.Open("sqlite3", "forum.db")
 
 	if openErr != nil {
@@ -30,30 +32,14 @@ func Init() {
 	}
 
 	//Run migrations
-	migrations := []string{
-		"migrations/001_init.sql",
-		"migrations/002_add_user_status.sql",
+	if migrateErr := Migrate(DB, migrations.FS); migrateErr != nil {
+		log.Fatalf("Failed to run migrations: %v", migrateErr)
 	}
 
-	for _, migrationFile := range migrations {
-		if migrateErr := runMigrations(migrationFile); migrateErr != nil {
-			log.Fatalf("Failed to run migration %s: %v", migrationFile, migrateErr)
-		}
+	//Full-text search uses FTS5 when it is compiled into the driver
+	if searchErr := setupSearchIndex(DB); searchErr != nil {
+		log.Fatalf("Failed to set up search index: %v", searchErr)
 	}
 
 	log.Println("Database initialized and migrations applied successfully.")
 }
-
-func runMigrations(filepath string) error {
-
-	content, readErr := os.ReadFile(filepath)
-	if readErr != nil {
-		return fmt.Errorf("failed to read migration file: %w", readErr)
-	}
-
-	_, execErr := DB.Exec(string(content))
-	if execErr != nil {
-		return fmt.Errorf("migration execution failed: %w", execErr)
-	}
-	return nil
-}
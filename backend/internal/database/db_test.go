@@ -0,0 +1,83 @@
+package database
+
+import (
+	"database/sql"
+	"io"
+	"log"
+	"os"
+	"testing"
+
+	"github.com/Tomlee-abila/real_time_forum/backend/internal/models"
+	"github.com/Tomlee-abila/real_time_forum/migrations"
+)
+
+func TestMain(m *testing.M) {
+	// Migrations and fallbacks log as they go, which only buries test failures
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// openTestDB opens a private in-memory database
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every connection to :memory: is a separate database
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// useTestDB points DB at a migrated in-memory database for the rest of the test
+func useTestDB(t *testing.T) {
+	t.Helper()
+
+	db := openTestDB(t)
+	if err := Migrate(db, migrations.FS); err != nil {
+		t.Fatal(err)
+	}
+	if err := setupSearchIndex(db); err != nil {
+		t.Fatal(err)
+	}
+
+	previous := DB
+	DB = db
+	t.Cleanup(func() { DB = previous })
+}
+
+// createTestUser registers a user with the given nickname
+func createTestUser(t *testing.T, nickname string) *models.User {
+	t.Helper()
+
+	user, err := CreateUser(&models.UserRegistration{
+		Nickname:  nickname,
+		Age:       30,
+		Gender:    "other",
+		FirstName: nickname,
+		LastName:  "Test",
+		Email:     nickname + "@example.com",
+		Password:  "password123",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// createTestPost creates a post in the general category
+func createTestPost(t *testing.T, userID, title, content string) *models.Post {
+	t.Helper()
+
+	post, err := CreatePost(userID, &models.PostCreation{
+		Title:      title,
+		Content:    content,
+		Categories: []string{"general"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return post
+}
@@ -0,0 +1,291 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/Tomlee-abila/real_time_forum/backend/internal/models"
+	"github.com/google/uuid"
+)
+
+// mentionColumns selects a mention with its author and the content it appears in
+const mentionColumns = `
+            mn.id, mn.user_id, mn.author_id, COALESCE(u.nickname, ''), mn.target_type,
+            COALESCE(mn.post_id, ''), COALESCE(mn.comment_id, ''), COALESCE(mn.message_id, ''),
+            COALESCE(m.conversation_id, ''), COALESCE(c.content, m.content, p.content, ''),
+            mn.created_at, mn.read_at`
+
+// mentionJoins are the joins used by mentionColumns
+const mentionJoins = `
+        FROM mentions mn
+        LEFT JOIN users u ON mn.author_id = u.id
+        LEFT JOIN posts p ON mn.post_id = p.id
+        LEFT JOIN comments c ON mn.comment_id = c.id
+        LEFT JOIN messages m ON mn.message_id = m.id`
+
+// mentionVisibleCondition leaves out mentions in messages the user can no
+// longer see and by authors on either side of a block. Mentions in deleted
+// content are deleted along with it.
+const mentionVisibleCondition = `(
+            mn.target_type != 'message'
+            OR (EXISTS (
+                    SELECT 1 FROM conversation_members cm
+                    WHERE cm.conversation_id = m.conversation_id AND cm.user_id = mn.user_id
+                )
+                AND NOT EXISTS (
+                    SELECT 1 FROM hidden_messages h WHERE h.message_id = m.id AND h.user_id = mn.user_id
+                ))
+        )
+        AND NOT EXISTS (
+            SELECT 1 FROM user_blocks b
+            WHERE (b.blocker_id = mn.user_id AND b.blocked_id = mn.author_id)
+               OR (b.blocker_id = mn.author_id AND b.blocked_id = mn.user_id)
+        )`
+
+// execer runs statements and queries on the database or inside a transaction
+type execer interface {
+	querier
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// CreatePostMentions records the users mentioned in a new post
+func CreatePostMentions(post *models.Post) ([]models.Mention, error) {
+	return syncMentions(DB, postMentionTarget(post.ID, post.UserID, post.UserNickname), post.Content, nil)
+}
+
+// CreateCommentMentions records the users mentioned in a new comment
+func CreateCommentMentions(comment *models.Comment) ([]models.Mention, error) {
+	return syncMentions(DB, commentMentionTarget(comment.PostID, comment.ID, comment.UserID, comment.UserNickname), comment.Content, nil)
+}
+
+// CreateMessageMentions records the users mentioned in a new message. Only
+// members of the conversation can be mentioned in it.
+func CreateMessageMentions(message *models.Message) ([]models.Mention, error) {
+	return syncMessageMentions(DB, message.ID, message.ConversationID, message.SenderID, message.SenderNickname, message.Content)
+}
+
+// postMentionTarget is the template of mentions in a post
+func postMentionTarget(postID, authorID, authorNickname string) models.Mention {
+	return models.Mention{
+		AuthorID:       authorID,
+		AuthorNickname: authorNickname,
+		TargetType:     models.MentionTargetPost,
+		PostID:         postID,
+	}
+}
+
+// commentMentionTarget is the template of mentions in a comment
+func commentMentionTarget(postID, commentID, authorID, authorNickname string) models.Mention {
+	return models.Mention{
+		AuthorID:       authorID,
+		AuthorNickname: authorNickname,
+		TargetType:     models.MentionTargetComment,
+		PostID:         postID,
+		CommentID:      commentID,
+	}
+}
+
+// syncMessageMentions brings the mentions of a message in line with its
+// content. Only members of the conversation can be mentioned in it.
+func syncMessageMentions(q execer, messageID, conversationID, senderID, senderNickname, content string) ([]models.Mention, error) {
+	memberIDs, err := getConversationMemberIDs(q, conversationID)
+	if err != nil {
+		return nil, err
+	}
+
+	return syncMentions(q, models.Mention{
+		AuthorID:       senderID,
+		AuthorNickname: senderNickname,
+		TargetType:     models.MentionTargetMessage,
+		MessageID:      messageID,
+		ConversationID: conversationID,
+	}, content, memberIDs)
+}
+
+// mentionTargetColumn returns the column and ID identifying what a mention is in
+func mentionTargetColumn(target models.Mention) (column, id string) {
+	switch target.TargetType {
+	case models.MentionTargetComment:
+		return "comment_id", target.CommentID
+	case models.MentionTargetMessage:
+		return "message_id", target.MessageID
+	}
+	return "post_id", target.PostID
+}
+
+// syncMentions brings the mentions in a post, comment or message, described by
+// the target template, in line with its content. Mentions of users no longer
+// mentioned are deleted and new ones recorded; existing ones keep their read
+// state. Unknown nicknames, the author, users outside allowedIDs (when set) and
+// users on either side of a block with the author are skipped. It returns the
+// newly recorded mentions, which are the ones to notify.
+func syncMentions(q execer, target models.Mention, content string, allowedIDs []string) ([]models.Mention, error) {
+	var userIDs []string
+	for _, nickname := range models.ParseMentions(content) {
+		var userID string
+		err := q.QueryRow("SELECT id FROM users WHERE nickname = ?", nickname).Scan(&userID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				continue
+			}
+			return nil, fmt.Errorf("failed to get user: %w", err)
+		}
+		if userID == target.AuthorID || (allowedIDs != nil && !slices.Contains(allowedIDs, userID)) || slices.Contains(userIDs, userID) {
+			continue
+		}
+		blocked, err := isBlockedBetween(q, target.AuthorID, userID)
+		if err != nil {
+			return nil, err
+		}
+		if !blocked {
+			userIDs = append(userIDs, userID)
+		}
+	}
+
+	column, targetID := mentionTargetColumn(target)
+	existing, err := q.Query("SELECT user_id FROM mentions WHERE target_type = ? AND "+column+" = ?", target.TargetType, targetID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get mentions: %w", err)
+	}
+	mentioned := make(map[string]bool)
+	for existing.Next() {
+		var userID string
+		if err := existing.Scan(&userID); err != nil {
+			existing.Close()
+			return nil, fmt.Errorf("failed to scan mention: %w", err)
+		}
+		mentioned[userID] = true
+	}
+	existing.Close()
+	if err := existing.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get mentions: %w", err)
+	}
+
+	args := []interface{}{target.TargetType, targetID}
+	stale := "DELETE FROM mentions WHERE target_type = ? AND " + column + " = ?"
+	if len(userIDs) > 0 {
+		stale += " AND user_id NOT IN (" + queryPlaceholders(len(userIDs)) + ")"
+		for _, userID := range userIDs {
+			args = append(args, userID)
+		}
+	}
+	if _, err := q.Exec(stale, args...); err != nil {
+		return nil, fmt.Errorf("failed to delete mentions: %w", err)
+	}
+
+	query := `
+        INSERT INTO mentions (id, user_id, author_id, target_type, post_id, comment_id, message_id, created_at)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+    `
+
+	mentions := []models.Mention{}
+	for _, userID := range userIDs {
+		if mentioned[userID] {
+			continue
+		}
+
+		mention := target
+		mention.ID = uuid.New().String()
+		mention.UserID = userID
+		mention.Excerpt = models.MentionExcerpt(content)
+		mention.CreatedAt = time.Now()
+
+		_, err = q.Exec(query, mention.ID, mention.UserID, mention.AuthorID, mention.TargetType,
+			nullIfEmpty(mention.PostID), nullIfEmpty(mention.CommentID), nullIfEmpty(mention.MessageID), mention.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create mention: %w", err)
+		}
+		mentions = append(mentions, mention)
+	}
+	return mentions, nil
+}
+
+// GetUnreadMentions retrieves a page of a user's unread mentions, newest first
+func GetUnreadMentions(userID string, limit int, cursor *models.Cursor) (*models.MentionList, error) {
+	condition, orderBy, cursorArgs, reversed := keyset("mn", cursor, true)
+
+	query := fmt.Sprintf(`SELECT `+mentionColumns+mentionJoins+`
+        WHERE mn.user_id = ? AND mn.read_at IS NULL
+          AND `+mentionVisibleCondition+`
+          AND %s
+        ORDER BY %s
+        LIMIT ?
+    `, condition, orderBy)
+
+	args := append([]interface{}{userID}, cursorArgs...)
+	rows, err := DB.Query(query, append(args, limit+1)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get mentions: %w", err)
+	}
+	defer rows.Close()
+
+	mentions, err := scanMentions(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	// Fetch one extra row to know whether another page exists
+	hasExtra := len(mentions) > limit
+	if hasExtra {
+		mentions = mentions[:limit]
+	}
+	if reversed {
+		slices.Reverse(mentions)
+	}
+
+	var first, last *models.Cursor
+	if len(mentions) > 0 {
+		first = cursorAt(mentions[0].CreatedAt, mentions[0].ID)
+		last = cursorAt(mentions[len(mentions)-1].CreatedAt, mentions[len(mentions)-1].ID)
+	}
+
+	return &models.MentionList{
+		Mentions: mentions,
+		PageInfo: buildPageInfo(cursor, first, last, len(mentions), hasExtra),
+	}, nil
+}
+
+// MarkMentionsRead marks a user's unread mentions as read, either the given
+// ones or all of them, and returns how many were marked
+func MarkMentionsRead(userID string, mentionIDs []string) (int64, error) {
+	query := `UPDATE mentions SET read_at = ? WHERE user_id = ? AND read_at IS NULL`
+	args := []interface{}{time.Now(), userID}
+	if len(mentionIDs) > 0 {
+		query += ` AND id IN (` + queryPlaceholders(len(mentionIDs)) + `)`
+		for _, id := range mentionIDs {
+			args = append(args, id)
+		}
+	}
+
+	result, err := DB.Exec(query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to mark mentions as read: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// scanMentions scans rows selected with mentionColumns
+func scanMentions(rows *sql.Rows) ([]models.Mention, error) {
+	mentions := []models.Mention{}
+	for rows.Next() {
+		var mention models.Mention
+		var content string
+		var readAt sql.NullTime
+		err := rows.Scan(
+			&mention.ID, &mention.UserID, &mention.AuthorID, &mention.AuthorNickname, &mention.TargetType,
+			&mention.PostID, &mention.CommentID, &mention.MessageID,
+			&mention.ConversationID, &content,
+			&mention.CreatedAt, &readAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan mention: %w", err)
+		}
+		mention.Excerpt = models.MentionExcerpt(content)
+		mention.ReadAt = timePtr(readAt)
+		mentions = append(mentions, mention)
+	}
+	return mentions, rows.Err()
+}
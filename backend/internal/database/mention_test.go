@@ -0,0 +1,102 @@
+package database
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/Tomlee-abila/real_time_forum/backend/internal/models"
+)
+
+// mentionedUsers returns the users mentioned in a post, comment or message, sorted
+func mentionedUsers(t *testing.T, target models.Mention) []string {
+	t.Helper()
+
+	column, targetID := mentionTargetColumn(target)
+	rows, err := DB.Query("SELECT user_id FROM mentions WHERE target_type = ? AND "+column+" = ? ORDER BY user_id",
+		target.TargetType, targetID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var userIDs []string
+	for rows.Next() {
+		var userID string
+		if err := rows.Scan(&userID); err != nil {
+			t.Fatal(err)
+		}
+		userIDs = append(userIDs, userID)
+	}
+	return userIDs
+}
+
+func TestPostAndCommentEditsSyncMentions(t *testing.T) {
+	useTestDB(t)
+	alice := createTestUser(t, "alice")
+	bob := createTestUser(t, "bob")
+	carol := createTestUser(t, "carol")
+
+	post := createTestPost(t, alice.ID, "Hello", "hi @bob")
+	if _, err := CreatePostMentions(post); err != nil {
+		t.Fatal(err)
+	}
+	comment, err := CreateComment(alice.ID, post.ID, &models.CommentCreation{Content: "hi @bob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CreateCommentMentions(comment); err != nil {
+		t.Fatal(err)
+	}
+
+	targets := []struct {
+		name   string
+		target models.Mention
+		edit   func(content string) ([]models.Mention, error)
+	}{
+		{"post", postMentionTarget(post.ID, alice.ID, ""), func(content string) ([]models.Mention, error) {
+			_, mentions, err := UpdatePost(post.ID, alice.ID, &models.PostUpdate{Title: "Hello", Content: content})
+			return mentions, err
+		}},
+		{"comment", commentMentionTarget(post.ID, comment.ID, alice.ID, ""), func(content string) ([]models.Mention, error) {
+			_, mentions, err := UpdateComment(post.ID, comment.ID, alice.ID, &models.CommentUpdate{Content: content})
+			return mentions, err
+		}},
+	}
+
+	steps := []struct {
+		name          string
+		content       string
+		wantMentioned []string
+		wantNotified  []string
+	}{
+		{"added mention notifies", "hi @bob and @carol", []string{bob.ID, carol.ID}, []string{carol.ID}},
+		{"removed mention is deleted", "hi @carol", []string{carol.ID}, nil},
+		{"no mentions", "hi all", nil, nil},
+	}
+
+	for _, tt := range targets {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, step := range steps {
+				notified, err := tt.edit(step.content)
+				if err != nil {
+					t.Fatalf("%s: %v", step.name, err)
+				}
+
+				want := slices.Sorted(slices.Values(step.wantMentioned))
+				if got := mentionedUsers(t, tt.target); !slices.Equal(got, want) {
+					t.Errorf("%s: mentioned = %v, want %v", step.name, got, want)
+				}
+				var notifiedIDs []string
+				for _, mention := range notified {
+					notifiedIDs = append(notifiedIDs, mention.UserID)
+					if mention.AuthorNickname != "alice" {
+						t.Errorf("%s: AuthorNickname = %q, want alice", step.name, mention.AuthorNickname)
+					}
+				}
+				if !slices.Equal(notifiedIDs, step.wantNotified) {
+					t.Errorf("%s: notified = %v, want %v", step.name, notifiedIDs, step.wantNotified)
+				}
+			}
+		})
+	}
+}
@@ -3,234 +3,349 @@ package database
 import (
 	"database/sql"
 	"fmt"
+	"slices"
 	"time"
 
+	"github.com/Tomlee-abila/real_time_forum/backend/internal/markdown"
 	"github.com/Tomlee-abila/real_time_forum/backend/internal/models"
 	"github.com/google/uuid"
 )
 
-// CreateMessage creates a new private message
+// messageColumns selects a message with its sender, the receiver of a direct
+// message, and whether every other member has read it
+const messageColumns = `
+            m.id, m.conversation_id, m.sender_id, m.content, m.format, m.created_at, m.edited_at, m.deleted_at,
+            COALESCE(s.nickname, ''), COALESCE(r.user_id, ''), COALESCE(ru.nickname, ''),
+            NOT EXISTS (
+                SELECT 1 FROM conversation_members o
+                WHERE o.conversation_id = m.conversation_id AND o.user_id != m.sender_id
+                  AND (o.last_read_at IS NULL OR o.last_read_at < m.created_at)
+            )`
+
+// messageJoins are the joins used by messageColumns
+const messageJoins = `
+        FROM messages m
+        JOIN conversations c ON m.conversation_id = c.id
+        LEFT JOIN users s ON m.sender_id = s.id
+        LEFT JOIN conversation_members r ON c.kind = 'direct' AND r.conversation_id = m.conversation_id AND r.user_id != m.sender_id
+        LEFT JOIN users ru ON r.user_id = ru.id`
+
+// notHiddenCondition leaves out messages the member bound to it deleted for themselves
+const notHiddenCondition = `NOT EXISTS (
+            SELECT 1 FROM hidden_messages h WHERE h.message_id = m.id AND h.user_id = ?
+        )`
+
+// scanMessages scans rows selected with messageColumns
+func scanMessages(rows *sql.Rows) ([]models.Message, error) {
+	messages := []models.Message{}
+	for rows.Next() {
+		var message models.Message
+		var editedAt, deletedAt sql.NullTime
+		err := rows.Scan(
+			&message.ID, &message.ConversationID, &message.SenderID, &message.Content, &message.Format, &message.CreatedAt,
+			&editedAt, &deletedAt,
+			&message.SenderNickname, &message.ReceiverID, &message.ReceiverNickname, &message.IsRead,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan message: %w", err)
+		}
+		message.EditedAt = timePtr(editedAt)
+		message.DeletedAt = timePtr(deletedAt)
+		message.Deleted = deletedAt.Valid
+		if message.Format == models.MessageFormatMarkdown {
+			message.ContentHTML = markdown.Render(message.Content)
+		}
+		messages = append(messages, message)
+	}
+	return messages, rows.Err()
+}
+
+// CreateMessage creates a new private message. A message with a receiver goes
+// to the direct conversation with that user, which is created on first use.
 func CreateMessage(senderID string, message *models.MessageCreation) (*models.Message, error) {
-	messageID := uuid.New().String()
-	createdAt := time.Now()
+	conversationID := message.ConversationID
+	peerID := message.ReceiverID
 
-	// Check if receiver exists
-	_, err := GetUserByID(message.ReceiverID)
+	if peerID != "" {
+		// Check if receiver exists
+		if _, err := GetUserByID(peerID); err != nil {
+			return nil, fmt.Errorf("receiver not found")
+		}
+	} else {
+		access, err := getConversationAccess(DB, conversationID, senderID)
+		if err != nil {
+			return nil, err
+		}
+		if access.Kind == models.ConversationDirect {
+			peerID = access.PeerID
+		}
+	}
+
+	// Neither side of a block can message the other
+	if peerID != "" {
+		blocked, err := IsBlockedBetween(senderID, peerID)
+		if err != nil {
+			return nil, err
+		}
+		if blocked {
+			return nil, fmt.Errorf("blocked: you cannot message this user")
+		}
+	}
+
+	tx, err := DB.Begin()
 	if err != nil {
-		return nil, fmt.Errorf("receiver not found")
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
 	}
+	defer tx.Rollback()
 
+	if conversationID == "" {
+		conversationID, err = getOrCreateDirectConversation(tx, senderID, peerID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	messageID := uuid.New().String()
 	query := `
-        INSERT INTO messages (id, sender_id, receiver_id, content, created_at, is_read)
+        INSERT INTO messages (id, conversation_id, sender_id, content, format, created_at)
         VALUES (?, ?, ?, ?, ?, ?)
     `
 
-	_, err = DB.Exec(query, messageID, senderID, message.ReceiverID, message.Content, createdAt, false)
+	_, err = tx.Exec(query, messageID, conversationID, senderID, message.Content, message.Format, time.Now())
 	if err != nil {
 		return nil, fmt.Errorf("failed to create message: %w", err)
 	}
 
-	// Get sender and receiver info for response
-	sender, err := GetUserByID(senderID)
+	if err := linkAttachments(tx, attachmentMessageColumn, messageID, senderID, message.AttachmentIDs); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit message: %w", err)
+	}
+
+	return GetMessageByID(messageID)
+}
+
+// GetMessageByID retrieves a single message
+func GetMessageByID(messageID string) (*models.Message, error) {
+	query := `SELECT ` + messageColumns + messageJoins + `
+        WHERE m.id = ?
+    `
+
+	rows, err := DB.Query(query, messageID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get sender info: %w", err)
+		return nil, fmt.Errorf("failed to get message: %w", err)
 	}
+	defer rows.Close()
 
-	receiver, err := GetUserByID(message.ReceiverID)
+	messages, err := scanMessages(rows)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get receiver info: %w", err)
-	}
-
-	return &models.Message{
-		ID:               messageID,
-		SenderID:         senderID,
-		ReceiverID:       message.ReceiverID,
-		Content:          message.Content,
-		CreatedAt:        createdAt,
-		IsRead:           false,
-		SenderNickname:   sender.Nickname,
-		ReceiverNickname: receiver.Nickname,
-	}, nil
+		return nil, err
+	}
+	if err := attachMessageAttachments(messages); err != nil {
+		return nil, err
+	}
+	if len(messages) == 0 {
+		return nil, fmt.Errorf("message not found")
+	}
+
+	return &messages[0], nil
 }
 
-// GetMessageHistory retrieves paginated message history between two users
-func GetMessageHistory(userID1, userID2 string, limit, offset int) (*models.MessageHistory, error) {
-	// Get messages between the two users
-	query := `
-        SELECT 
-            m.id, m.sender_id, m.receiver_id, m.content, m.created_at, m.is_read,
-            s.nickname as sender_nickname, r.nickname as receiver_nickname
-        FROM messages m
-        LEFT JOIN users s ON m.sender_id = s.id
-        LEFT JOIN users r ON m.receiver_id = r.id
-        WHERE (m.sender_id = ? AND m.receiver_id = ?) OR (m.sender_id = ? AND m.receiver_id = ?)
-        ORDER BY m.created_at DESC
-        LIMIT ? OFFSET ?
-    `
+// GetMessageHistory retrieves a page of a conversation's history for one of its members.
+// Pages move from the latest messages towards older ones; each page is returned oldest first.
+// Messages deleted for everyone appear as tombstones; those the member deleted for
+// themselves are left out.
+func GetMessageHistory(conversationID, userID string, limit int, cursor *models.Cursor) (*models.MessageHistory, error) {
+	if _, err := getConversationAccess(DB, conversationID, userID); err != nil {
+		return nil, err
+	}
+
+	condition, orderBy, cursorArgs, reversed := keyset("m", cursor, true)
 
-	rows, err := DB.Query(query, userID1, userID2, userID2, userID1, limit, offset)
+	query := fmt.Sprintf(`SELECT `+messageColumns+messageJoins+`
+        WHERE m.conversation_id = ?
+          AND `+notHiddenCondition+`
+          AND %s
+        ORDER BY %s
+        LIMIT ?
+    `, condition, orderBy)
+
+	args := append(append([]interface{}{conversationID, userID}, cursorArgs...), limit+1)
+	rows, err := DB.Query(query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get message history: %w", err)
 	}
 	defer rows.Close()
 
-	var messages []models.Message
-	for rows.Next() {
-		var message models.Message
-		err := rows.Scan(
-			&message.ID, &message.SenderID, &message.ReceiverID, &message.Content,
-			&message.CreatedAt, &message.IsRead, &message.SenderNickname, &message.ReceiverNickname,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan message: %w", err)
-		}
-		messages = append(messages, message)
+	messages, err := scanMessages(rows)
+	if err != nil {
+		return nil, err
+	}
+	if err := attachMessageAttachments(messages); err != nil {
+		return nil, err
 	}
 
-	// Reverse the order to show oldest first (since we queried DESC for pagination)
-	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
-		messages[i], messages[j] = messages[j], messages[i]
+	// Fetch one extra row to know whether another page exists, instead of counting
+	hasExtra := len(messages) > limit
+	if hasExtra {
+		messages = messages[:limit]
+	}
+	if reversed {
+		slices.Reverse(messages)
 	}
 
-	// Get total count
-	totalCount, err := GetMessageCount(userID1, userID2)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get message count: %w", err)
+	var first, last *models.Cursor
+	if len(messages) > 0 {
+		first = cursorAt(messages[0].CreatedAt, messages[0].ID)
+		last = cursorAt(messages[len(messages)-1].CreatedAt, messages[len(messages)-1].ID)
 	}
+	page := buildPageInfo(cursor, first, last, len(messages), hasExtra)
 
-	// Check if there are more messages
-	hasMore := offset+len(messages) < totalCount
+	// Reverse the order to show oldest first (since we queried newest first for pagination)
+	slices.Reverse(messages)
 
 	return &models.MessageHistory{
-		Messages:    messages,
-		HasMore:     hasMore,
-		TotalCount:  totalCount,
-		CurrentPage: (offset / limit) + 1,
+		Messages: messages,
+		PageInfo: page,
 	}, nil
 }
 
-// GetConversations retrieves all conversations for a user
+// GetDirectMessageHistory retrieves a page of the direct conversation between two users.
+// Users who have never messaged each other have an empty history.
+func GetDirectMessageHistory(userID, otherUserID string, limit int, cursor *models.Cursor) (*models.MessageHistory, error) {
+	conversationID, err := GetDirectConversationID(userID, otherUserID)
+	if err != nil {
+		if err.Error() == "conversation not found" {
+			return &models.MessageHistory{Messages: []models.Message{}}, nil
+		}
+		return nil, err
+	}
+	return GetMessageHistory(conversationID, userID, limit, cursor)
+}
+
+// GetConversations retrieves all conversations for a user, leaving out
+// direct conversations with users on either side of a block
 func GetConversations(userID string) ([]models.Conversation, error) {
-	query := `
-        SELECT DISTINCT
-            CASE 
-                WHEN m.sender_id = ? THEN m.receiver_id 
-                ELSE m.sender_id 
-            END as other_user_id,
-            u.nickname as other_user_nickname,
-            us.is_online,
-            us.last_seen
-        FROM messages m
-        LEFT JOIN users u ON (
-            CASE 
-                WHEN m.sender_id = ? THEN m.receiver_id = u.id
-                ELSE m.sender_id = u.id
-            END
-        )
-        LEFT JOIN user_status us ON u.id = us.user_id
-        WHERE m.sender_id = ? OR m.receiver_id = ?
-        ORDER BY (
-            SELECT MAX(created_at) 
-            FROM messages m2 
-            WHERE (m2.sender_id = ? AND m2.receiver_id = other_user_id) 
-               OR (m2.sender_id = other_user_id AND m2.receiver_id = ?)
-        ) DESC
+	return queryConversations("1 = 1", nil, userID)
+}
+
+// GetLastMessage gets the last message in a conversation that a member has not deleted for themselves
+func GetLastMessage(conversationID, userID string) (*models.Message, error) {
+	query := `SELECT ` + messageColumns + messageJoins + `
+        WHERE m.conversation_id = ?
+          AND ` + notHiddenCondition + `
+        ORDER BY m.created_at DESC, m.id DESC
+        LIMIT 1
     `
 
-	rows, err := DB.Query(query, userID, userID, userID, userID, userID, userID)
+	rows, err := DB.Query(query, conversationID, userID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get conversations: %w", err)
+		return nil, fmt.Errorf("failed to get last message: %w", err)
 	}
 	defer rows.Close()
 
-	var conversations []models.Conversation
-	for rows.Next() {
-		var conv models.Conversation
-		var lastSeen sql.NullTime
-
-		err := rows.Scan(&conv.UserID, &conv.UserNickname, &conv.IsOnline, &lastSeen)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan conversation: %w", err)
-		}
-
-		if lastSeen.Valid {
-			conv.LastSeen = lastSeen.Time
-		}
-
-		// Get last message
-		lastMessage, err := GetLastMessage(userID, conv.UserID)
-		if err == nil {
-			conv.LastMessage = lastMessage
-		}
+	messages, err := scanMessages(rows)
+	if err != nil {
+		return nil, err
+	}
+	if err := attachMessageAttachments(messages); err != nil {
+		return nil, err
+	}
+	if len(messages) == 0 {
+		return nil, fmt.Errorf("no messages found")
+	}
 
-		// Get unread count
-		unreadCount, err := GetUnreadMessageCount(userID, conv.UserID)
-		if err == nil {
-			conv.UnreadCount = unreadCount
-		}
+	return &messages[0], nil
+}
 
-		conversations = append(conversations, conv)
+// MarkConversationRead marks every message from other members as read for a
+// member and returns the messages that were unread, oldest first
+func MarkConversationRead(conversationID, userID string) ([]models.Message, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
 	}
+	defer tx.Rollback()
 
-	return conversations, nil
-}
+	if _, err := getConversationAccess(tx, conversationID, userID); err != nil {
+		return nil, err
+	}
 
-// GetLastMessage gets the last message between two users
-func GetLastMessage(userID1, userID2 string) (*models.Message, error) {
 	query := `
-        SELECT 
-            m.id, m.sender_id, m.receiver_id, m.content, m.created_at, m.is_read,
-            s.nickname as sender_nickname, r.nickname as receiver_nickname
+        SELECT m.id, m.sender_id, m.created_at
         FROM messages m
-        LEFT JOIN users s ON m.sender_id = s.id
-        LEFT JOIN users r ON m.receiver_id = r.id
-        WHERE (m.sender_id = ? AND m.receiver_id = ?) OR (m.sender_id = ? AND m.receiver_id = ?)
-        ORDER BY m.created_at DESC
-        LIMIT 1
+        JOIN conversation_members me ON me.conversation_id = m.conversation_id AND me.user_id = ?
+        WHERE m.conversation_id = ? AND m.sender_id != me.user_id
+          AND (me.last_read_at IS NULL OR m.created_at > me.last_read_at)
+        ORDER BY m.created_at ASC, m.id ASC
     `
 
-	var message models.Message
-	err := DB.QueryRow(query, userID1, userID2, userID2, userID1).Scan(
-		&message.ID, &message.SenderID, &message.ReceiverID, &message.Content,
-		&message.CreatedAt, &message.IsRead, &message.SenderNickname, &message.ReceiverNickname,
-	)
-
+	rows, err := tx.Query(query, userID, conversationID)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("no messages found")
+		return nil, fmt.Errorf("failed to mark messages as read: %w", err)
+	}
+
+	var unread []models.Message
+	for rows.Next() {
+		message := models.Message{ConversationID: conversationID, IsRead: true}
+		if err := rows.Scan(&message.ID, &message.SenderID, &message.CreatedAt); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan message ID: %w", err)
 		}
-		return nil, fmt.Errorf("failed to get last message: %w", err)
+		unread = append(unread, message)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to mark messages as read: %w", err)
+	}
+	if len(unread) == 0 {
+		return nil, nil
 	}
 
-	return &message, nil
-}
+	// Only the messages seen here become read, even if newer ones arrive meanwhile
+	_, err = tx.Exec("UPDATE conversation_members SET last_read_at = ? WHERE conversation_id = ? AND user_id = ?",
+		unread[len(unread)-1].CreatedAt, conversationID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to mark messages as read: %w", err)
+	}
 
-// MarkMessagesAsRead marks all messages from a specific user as read
-func MarkMessagesAsRead(receiverID, senderID string) error {
-	query := `
-        UPDATE messages 
-        SET is_read = true 
-        WHERE receiver_id = ? AND sender_id = ? AND is_read = false
-    `
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to mark messages as read: %w", err)
+	}
+
+	return unread, nil
+}
 
-	_, err := DB.Exec(query, receiverID, senderID)
+// MarkMessagesAsRead marks the direct messages a user received from another
+// user as read and returns the messages that were unread
+func MarkMessagesAsRead(receiverID, senderID string) ([]models.Message, error) {
+	conversationID, err := GetDirectConversationID(receiverID, senderID)
 	if err != nil {
-		return fmt.Errorf("failed to mark messages as read: %w", err)
+		if err.Error() == "conversation not found" {
+			return nil, nil
+		}
+		return nil, err
 	}
-
-	return nil
+	return MarkConversationRead(conversationID, receiverID)
 }
 
-// GetUnreadMessageCount gets the count of unread messages from a specific user
-func GetUnreadMessageCount(receiverID, senderID string) (int, error) {
+// GetUnreadMessageCount gets the number of messages from other members a member has not read.
+// Deleted messages are not counted.
+func GetUnreadMessageCount(conversationID, userID string) (int, error) {
 	query := `
-        SELECT COUNT(*) 
-        FROM messages 
-        WHERE receiver_id = ? AND sender_id = ? AND is_read = false
+        SELECT COUNT(*)
+        FROM messages m
+        JOIN conversation_members me ON me.conversation_id = m.conversation_id AND me.user_id = ?
+        WHERE m.conversation_id = ? AND m.sender_id != me.user_id
+          AND (me.last_read_at IS NULL OR m.created_at > me.last_read_at)
+          AND m.deleted_at IS NULL
+          AND NOT EXISTS (SELECT 1 FROM hidden_messages h WHERE h.message_id = m.id AND h.user_id = me.user_id)
     `
 
 	var count int
-	err := DB.QueryRow(query, receiverID, senderID).Scan(&count)
+	err := DB.QueryRow(query, userID, conversationID).Scan(&count)
 	if err != nil {
 		return 0, fmt.Errorf("failed to get unread message count: %w", err)
 	}
@@ -238,16 +353,16 @@ func GetUnreadMessageCount(receiverID, senderID string) (int, error) {
 	return count, nil
 }
 
-// GetMessageCount gets the total count of messages between two users
-func GetMessageCount(userID1, userID2 string) (int, error) {
+// GetMessageCount gets the total count of messages in a conversation
+func GetMessageCount(conversationID string) (int, error) {
 	query := `
         SELECT COUNT(*) 
         FROM messages 
-        WHERE (sender_id = ? AND receiver_id = ?) OR (sender_id = ? AND receiver_id = ?)
+        WHERE conversation_id = ?
     `
 
 	var count int
-	err := DB.QueryRow(query, userID1, userID2, userID2, userID1).Scan(&count)
+	err := DB.QueryRow(query, conversationID).Scan(&count)
 	if err != nil {
 		return 0, fmt.Errorf("failed to get message count: %w", err)
 	}
@@ -255,6 +370,142 @@ func GetMessageCount(userID1, userID2 string) (int, error) {
 	return count, nil
 }
 
+// messageAccess describes a message as seen by a member of its conversation
+type messageAccess struct {
+	ConversationID string
+	SenderID       string
+	CreatedAt      time.Time
+	Deleted        bool
+}
+
+// getMessageAccess looks up a message in one of the user's conversations.
+// Messages in conversations the user is not in are reported as not found.
+func getMessageAccess(q querier, messageID, userID string) (*messageAccess, error) {
+	query := `
+        SELECT m.conversation_id, m.sender_id, m.created_at, m.deleted_at IS NOT NULL
+        FROM messages m
+        JOIN conversation_members me ON me.conversation_id = m.conversation_id AND me.user_id = ?
+        WHERE m.id = ?
+    `
+
+	var access messageAccess
+	err := q.QueryRow(query, userID, messageID).Scan(&access.ConversationID, &access.SenderID, &access.CreatedAt, &access.Deleted)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("message not found")
+		}
+		return nil, fmt.Errorf("failed to get message: %w", err)
+	}
+	return &access, nil
+}
+
+// UpdateMessage edits a message. Only its sender can edit it, and only within
+// models.MessageEditWindow of sending it. Mentions follow the new content; the
+// newly mentioned users are returned so they can be notified.
+func UpdateMessage(messageID, userID string, update *models.MessageUpdate) (*models.Message, []models.Mention, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	access, err := getMessageAccess(tx, messageID, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if access.SenderID != userID {
+		return nil, nil, fmt.Errorf("unauthorized: you can only edit your own messages")
+	}
+	if access.Deleted {
+		return nil, nil, fmt.Errorf("message has been deleted")
+	}
+	if time.Since(access.CreatedAt) > models.MessageEditWindow {
+		return nil, nil, fmt.Errorf("edit window has passed: messages can only be edited for %v", models.MessageEditWindow)
+	}
+
+	_, err = tx.Exec("UPDATE messages SET content = ?, edited_at = ? WHERE id = ?", update.Content, time.Now(), messageID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to update message: %w", err)
+	}
+
+	mentions, err := syncMessageMentions(tx, messageID, access.ConversationID, userID, "", update.Content)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, nil, fmt.Errorf("failed to commit message update: %w", err)
+	}
+
+	message, err := GetMessageByID(messageID)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i := range mentions {
+		mentions[i].AuthorNickname = message.SenderNickname
+	}
+	return message, mentions, nil
+}
+
+// DeleteMessageForEveryone replaces a message with a tombstone. Only its sender
+// can do this. The content, attachments and mentions are cleared, which also
+// drops the message from the search index.
+func DeleteMessageForEveryone(messageID, userID string) (*models.Message, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	access, err := getMessageAccess(tx, messageID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if access.SenderID != userID {
+		return nil, fmt.Errorf("unauthorized: you can only delete your own messages for everyone")
+	}
+
+	var attachments []models.Attachment
+	if !access.Deleted {
+		_, err = tx.Exec("UPDATE messages SET content = '', deleted_at = ? WHERE id = ?", time.Now(), messageID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to delete message: %w", err)
+		}
+		attachments, err = deleteAttachments(tx, attachmentMessageColumn, []string{messageID})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := tx.Exec("DELETE FROM mentions WHERE message_id = ?", messageID); err != nil {
+			return nil, fmt.Errorf("failed to delete mentions: %w", err)
+		}
+		// hidden_messages rows are kept, so members who hid the message do not see its tombstone
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit message deletion: %w", err)
+	}
+
+	for i := range attachments {
+		DeleteAttachmentFiles(&attachments[i])
+	}
+	return GetMessageByID(messageID)
+}
+
+// HideMessage deletes a message for one member only. Any member can hide any message.
+func HideMessage(messageID, userID string) (*models.Message, error) {
+	if _, err := getMessageAccess(DB, messageID, userID); err != nil {
+		return nil, err
+	}
+
+	_, err := DB.Exec("INSERT OR IGNORE INTO hidden_messages (message_id, user_id, hidden_at) VALUES (?, ?, ?)",
+		messageID, userID, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete message: %w", err)
+	}
+
+	return GetMessageByID(messageID)
+}
+
 // UpdateUserStatus updates or creates user online status
 func UpdateUserStatus(userID string, isOnline bool) error {
 	now := time.Now()
@@ -337,19 +588,75 @@ func GetAllOnlineUsers() ([]models.UserStatus, error) {
 }
 
 // CleanupOfflineUsers marks users as offline if they haven't been active recently
-func CleanupOfflineUsers(timeoutMinutes int) error {
-	cutoffTime := time.Now().Add(-time.Duration(timeoutMinutes) * time.Minute)
+// and returns the IDs of the users it marked
+func CleanupOfflineUsers(timeoutMinutes int) ([]string, error) {
+	now := time.Now()
+	cutoffTime := now.Add(-time.Duration(timeoutMinutes) * time.Minute)
 
 	query := `
         UPDATE user_status 
-        SET is_online = false 
+        SET is_online = false, last_seen = ? 
         WHERE last_active < ? AND is_online = true
+        RETURNING user_id
+    `
+
+	rows, err := DB.Query(query, now, cutoffTime)
+	if err != nil {
+		return nil, fmt.Errorf("failed to cleanup offline users: %w", err)
+	}
+	defer rows.Close()
+
+	var userIDs []string
+	for rows.Next() {
+		var userID string
+		if err := rows.Scan(&userID); err != nil {
+			return nil, fmt.Errorf("failed to scan user ID: %w", err)
+		}
+		userIDs = append(userIDs, userID)
+	}
+
+	return userIDs, rows.Err()
+}
+
+// TouchUserActivity refreshes a connected user's last_active heartbeat
+func TouchUserActivity(userID string) error {
+	query := `
+        UPDATE user_status 
+        SET last_active = ?, is_online = true 
+        WHERE user_id = ?
+    `
+
+	_, err := DB.Exec(query, time.Now(), userID)
+	if err != nil {
+		return fmt.Errorf("failed to update user activity: %w", err)
+	}
+
+	return nil
+}
+
+// MarkAllUsersOffline resets presence, used at startup before any client connects
+func MarkAllUsersOffline() error {
+	query := `
+        UPDATE user_status 
+        SET is_online = false, last_seen = ? 
+        WHERE is_online = true
     `
 
-	_, err := DB.Exec(query, cutoffTime)
+	_, err := DB.Exec(query, time.Now())
 	if err != nil {
-		return fmt.Errorf("failed to cleanup offline users: %w", err)
+		return fmt.Errorf("failed to reset user status: %w", err)
 	}
 
 	return nil
 }
+
+// GetOnlineUserCount returns the number of users marked online
+func GetOnlineUserCount() (int, error) {
+	query := "SELECT COUNT(*) FROM user_status WHERE is_online = true"
+	var count int
+	err := DB.QueryRow(query).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get online user count: %w", err)
+	}
+	return count, nil
+}
@@ -0,0 +1,317 @@
+package database
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Tomlee-abila/real_time_forum/backend/internal/models"
+)
+
+// sendTestMessage sends a plain direct message
+func sendTestMessage(t *testing.T, senderID, receiverID, content string) *models.Message {
+	t.Helper()
+
+	message, err := CreateMessage(senderID, &models.MessageCreation{
+		ReceiverID: receiverID,
+		Content:    content,
+		Format:     models.MessageFormatPlain,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return message
+}
+
+func TestUpdateMessageSyncsMentions(t *testing.T) {
+	useTestDB(t)
+	alice := createTestUser(t, "alice")
+	bob := createTestUser(t, "bob")
+	carol := createTestUser(t, "carol")
+
+	group, err := CreateGroupConversation(alice.ID, &models.ConversationCreation{Name: "trio", MemberIDs: []string{bob.ID, carol.ID}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	message, err := CreateMessage(alice.ID, &models.MessageCreation{ConversationID: group.ID, Content: "hi @bob", Format: models.MessageFormatPlain})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CreateMessageMentions(message); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := MarkMentionsRead(bob.ID, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		name          string
+		content       string
+		wantMentioned []string
+		wantNotified  []string
+	}{
+		{"unchanged mention is kept", "hello @bob", []string{bob.ID}, nil},
+		{"added mention notifies", "hello @bob and @carol", []string{bob.ID, carol.ID}, []string{carol.ID}},
+		{"removed mention is deleted", "hello @carol", []string{carol.ID}, nil},
+		{"no mentions", "hello all", nil, nil},
+		{"self mention is ignored", "note to @alice", nil, nil},
+	}
+
+	for _, step := range steps {
+		_, notified, err := UpdateMessage(message.ID, alice.ID, &models.MessageUpdate{Content: step.content})
+		if err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+
+		want := slices.Sorted(slices.Values(step.wantMentioned))
+		if got := mentionedUsers(t, models.Mention{TargetType: models.MentionTargetMessage, MessageID: message.ID}); !slices.Equal(got, want) {
+			t.Errorf("%s: mentioned = %v, want %v", step.name, got, want)
+		}
+		var notifiedIDs []string
+		for _, mention := range notified {
+			notifiedIDs = append(notifiedIDs, mention.UserID)
+			if mention.AuthorNickname != "alice" || mention.ConversationID != group.ID {
+				t.Errorf("%s: mention = %+v", step.name, mention)
+			}
+		}
+		if !slices.Equal(notifiedIDs, step.wantNotified) {
+			t.Errorf("%s: notified = %v, want %v", step.name, notifiedIDs, step.wantNotified)
+		}
+	}
+
+	// bob's mention was kept through the first edit, so it stayed read
+	list, err := GetUnreadMentions(bob.ID, 10, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Mentions) != 0 {
+		t.Errorf("bob has %d unread mentions, want 0", len(list.Mentions))
+	}
+}
+
+func TestCleanupOfflineUsers(t *testing.T) {
+	useTestDB(t)
+	idle := createTestUser(t, "idle")
+	active := createTestUser(t, "active")
+
+	for _, user := range []*models.User{idle, active} {
+		if err := UpdateUserStatus(user.ID, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stale := time.Now().Add(-time.Hour)
+	if _, err := DB.Exec("UPDATE user_status SET last_active = ?, last_seen = ? WHERE user_id = ?", stale, stale, idle.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	before := time.Now()
+	userIDs, err := CleanupOfflineUsers(5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(userIDs, []string{idle.ID}) {
+		t.Fatalf("swept %v, want [%s]", userIDs, idle.ID)
+	}
+
+	status, err := GetUserStatus(idle.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.IsOnline {
+		t.Error("idle user is still online")
+	}
+	// last_seen records when the user was swept, not when they were last online
+	if status.LastSeen.Before(before.Add(-time.Second)) {
+		t.Errorf("LastSeen = %v, want at least %v", status.LastSeen, before)
+	}
+
+	if status, err := GetUserStatus(active.ID); err != nil || !status.IsOnline {
+		t.Errorf("active user status = %+v, %v; want online", status, err)
+	}
+
+	// A second sweep finds nobody new
+	if userIDs, err := CleanupOfflineUsers(5); err != nil || len(userIDs) != 0 {
+		t.Errorf("second sweep = %v, %v; want none", userIDs, err)
+	}
+}
+
+func TestMessageEditAndDeleteRules(t *testing.T) {
+	useTestDB(t)
+	alice := createTestUser(t, "alice")
+	bob := createTestUser(t, "bob")
+	carol := createTestUser(t, "carol")
+
+	message := sendTestMessage(t, alice.ID, bob.ID, "first @bob")
+	if _, err := CreateMessageMentions(message); err != nil {
+		t.Fatal(err)
+	}
+	expired := sendTestMessage(t, alice.ID, bob.ID, "old")
+	if _, err := DB.Exec("UPDATE messages SET created_at = ? WHERE id = ?",
+		time.Now().Add(-models.MessageEditWindow-time.Minute), expired.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	edits := []struct {
+		name      string
+		messageID string
+		userID    string
+		wantErr   string
+	}{
+		{"receiver cannot edit", message.ID, bob.ID, "unauthorized"},
+		{"non-member cannot see it", message.ID, carol.ID, "message not found"},
+		{"after the edit window", expired.ID, alice.ID, "edit window has passed"},
+		{"sender within the window", message.ID, alice.ID, ""},
+	}
+
+	for _, edit := range edits {
+		edited, _, err := UpdateMessage(edit.messageID, edit.userID, &models.MessageUpdate{Content: "edited"})
+		if edit.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), edit.wantErr) {
+				t.Errorf("%s: err = %v, want %q", edit.name, err, edit.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", edit.name, err)
+		}
+		if edited.Content != "edited" || edited.EditedAt == nil {
+			t.Errorf("%s: message = %+v", edit.name, edited)
+		}
+	}
+
+	if _, err := DeleteMessageForEveryone(message.ID, bob.ID); err == nil || !strings.Contains(err.Error(), "unauthorized") {
+		t.Fatalf("receiver deleting for everyone: err = %v", err)
+	}
+
+	// The tombstone keeps the message in place without its content or mentions
+	for i := 0; i < 2; i++ {
+		tombstone, err := DeleteMessageForEveryone(message.ID, alice.ID)
+		if err != nil {
+			t.Fatalf("delete %d: %v", i+1, err)
+		}
+		if !tombstone.Deleted || tombstone.DeletedAt == nil || tombstone.Content != "" {
+			t.Errorf("delete %d: tombstone = %+v", i+1, tombstone)
+		}
+	}
+	if got := mentionedUsers(t, models.Mention{TargetType: models.MentionTargetMessage, MessageID: message.ID}); len(got) != 0 {
+		t.Errorf("tombstone still mentions %v", got)
+	}
+	if _, _, err := UpdateMessage(message.ID, alice.ID, &models.MessageUpdate{Content: "again"}); err == nil || !strings.Contains(err.Error(), "message has been deleted") {
+		t.Errorf("editing a tombstone: err = %v", err)
+	}
+
+	history, err := GetDirectMessageHistory(bob.ID, alice.ID, 10, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history.Messages) != 2 || history.Messages[1].ID != message.ID || !history.Messages[1].Deleted {
+		t.Errorf("history = %+v, want both messages with the tombstone last", history.Messages)
+	}
+}
+
+func TestHideMessage(t *testing.T) {
+	useTestDB(t)
+	alice := createTestUser(t, "alice")
+	bob := createTestUser(t, "bob")
+	carol := createTestUser(t, "carol")
+
+	kept := sendTestMessage(t, alice.ID, bob.ID, "kept")
+	hidden := sendTestMessage(t, alice.ID, bob.ID, "hidden")
+
+	if _, err := HideMessage(hidden.ID, carol.ID); err == nil || !strings.Contains(err.Error(), "message not found") {
+		t.Fatalf("non-member hiding: err = %v", err)
+	}
+	// Any member can hide any message, and hiding twice is harmless
+	for i := 0; i < 2; i++ {
+		if _, err := HideMessage(hidden.ID, bob.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		userID  string
+		otherID string
+		wantIDs []string
+	}{
+		{"hidden for the member who hid it", bob.ID, alice.ID, []string{kept.ID}},
+		{"still shown to the other member", alice.ID, bob.ID, []string{kept.ID, hidden.ID}},
+	}
+
+	for _, tt := range tests {
+		history, err := GetDirectMessageHistory(tt.userID, tt.otherID, 10, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		for _, message := range history.Messages {
+			ids = append(ids, message.ID)
+		}
+		if !slices.Equal(ids, tt.wantIDs) {
+			t.Errorf("%s: ids = %v, want %v", tt.name, ids, tt.wantIDs)
+		}
+	}
+}
+
+func TestMessageHistoryPaging(t *testing.T) {
+	useTestDB(t)
+	alice := createTestUser(t, "alice")
+	bob := createTestUser(t, "bob")
+
+	// m0 is the oldest message; m3 and m4 share a timestamp
+	base := time.Now().Add(-time.Hour)
+	var ids []string
+	for i := 0; i < 5; i++ {
+		message := sendTestMessage(t, alice.ID, bob.ID, fmt.Sprintf("m%d", i))
+		createdAt := base.Add(time.Duration(min(i, 3)) * time.Minute)
+		if _, err := DB.Exec("UPDATE messages SET created_at = ? WHERE id = ?", createdAt, message.ID); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, message.ID)
+	}
+	// Ties are broken by ID, so the later of m3 and m4 is the one with the larger ID
+	newest, other := ids[4], ids[3]
+	if newest < other {
+		newest, other = other, newest
+	}
+
+	steps := []struct {
+		name     string
+		cursor   func(models.PageInfo) string
+		wantIDs  []string
+		wantNext bool
+		wantPrev bool
+	}{
+		{"newest page", func(models.PageInfo) string { return "" }, []string{other, newest}, true, false},
+		{"older page", func(p models.PageInfo) string { return p.NextCursor }, []string{ids[1], ids[2]}, true, true},
+		{"oldest page", func(p models.PageInfo) string { return p.NextCursor }, []string{ids[0]}, false, true},
+		{"back to older page", func(p models.PageInfo) string { return p.PrevCursor }, []string{ids[1], ids[2]}, true, true},
+		{"back to newest page", func(p models.PageInfo) string { return p.PrevCursor }, []string{other, newest}, true, false},
+	}
+
+	var page models.PageInfo
+	for _, step := range steps {
+		cursor, err := models.DecodeCursor(step.cursor(page))
+		if err != nil {
+			t.Fatal(err)
+		}
+		history, err := GetDirectMessageHistory(bob.ID, alice.ID, 2, cursor)
+		if err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+
+		var got []string
+		for _, message := range history.Messages {
+			got = append(got, message.ID)
+		}
+		if !slices.Equal(got, step.wantIDs) {
+			t.Fatalf("%s: ids = %v, want %v", step.name, got, step.wantIDs)
+		}
+		page = history.PageInfo
+		if (page.NextCursor != "") != step.wantNext || (page.PrevCursor != "") != step.wantPrev {
+			t.Fatalf("%s: page = %+v, want next %v prev %v", step.name, page, step.wantNext, step.wantPrev)
+		}
+	}
+}
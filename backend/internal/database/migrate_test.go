@@ -0,0 +1,193 @@
+package database
+
+import (
+	"database/sql"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/Tomlee-abila/real_time_forum/migrations"
+)
+
+func appliedVersions(t *testing.T, db *sql.DB) []int {
+	t.Helper()
+
+	rows, err := db.Query("SELECT version FROM schema_migrations ORDER BY version")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var versions []int
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			t.Fatal(err)
+		}
+		versions = append(versions, version)
+	}
+	return versions
+}
+
+func TestLoadMigrations(t *testing.T) {
+	file := func(sql string) *fstest.MapFile { return &fstest.MapFile{Data: []byte(sql)} }
+
+	tests := []struct {
+		name      string
+		fsys      fstest.MapFS
+		wantNames []string
+		wantErr   string
+	}{
+		{
+			name: "sorted by version",
+			fsys: fstest.MapFS{
+				"010_ten.sql": file("SELECT 10"),
+				"002_two.sql": file("SELECT 2"),
+				"001_one.sql": file("SELECT 1"),
+			},
+			wantNames: []string{"001_one.sql", "002_two.sql", "010_ten.sql"},
+		},
+		{
+			name: "skips other files and directories",
+			fsys: fstest.MapFS{
+				"001_one.sql":     file("SELECT 1"),
+				"migrations.go":   file("package migrations"),
+				"README":          file("notes"),
+				"old/002_two.sql": file("SELECT 2"),
+			},
+			wantNames: []string{"001_one.sql"},
+		},
+		{
+			name:    "missing version",
+			fsys:    fstest.MapFS{"init.sql": file("SELECT 1")},
+			wantErr: "invalid migration file name: init.sql",
+		},
+		{
+			name:    "non-numeric version",
+			fsys:    fstest.MapFS{"v1_init.sql": file("SELECT 1")},
+			wantErr: "invalid migration file name: v1_init.sql",
+		},
+		{
+			name: "duplicate version",
+			fsys: fstest.MapFS{
+				"003_a.sql": file("SELECT 1"),
+				"3_b.sql":   file("SELECT 2"),
+			},
+			wantErr: "duplicate migration version 3",
+		},
+		{
+			name: "empty",
+			fsys: fstest.MapFS{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loaded, err := LoadMigrations(tt.fsys)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var names []string
+			for _, migration := range loaded {
+				names = append(names, migration.Name)
+			}
+			if !slices.Equal(names, tt.wantNames) {
+				t.Errorf("names = %v, want %v", names, tt.wantNames)
+			}
+		})
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	db := openTestDB(t)
+	fsys := fstest.MapFS{
+		"001_create.sql": {Data: []byte("CREATE TABLE notes (id INTEGER PRIMARY KEY, body TEXT);")},
+		"002_seed.sql":   {Data: []byte("INSERT INTO notes (body) VALUES ('a'); INSERT INTO notes (body) VALUES ('b');")},
+	}
+
+	if err := Migrate(db, fsys); err != nil {
+		t.Fatalf("first run: %v", err)
+	}
+	// A second run must not apply anything again
+	if err := Migrate(db, fsys); err != nil {
+		t.Fatalf("second run: %v", err)
+	}
+
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM notes").Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("notes = %d, want 2", count)
+	}
+	if versions := appliedVersions(t, db); !slices.Equal(versions, []int{1, 2}) {
+		t.Errorf("applied = %v, want [1 2]", versions)
+	}
+
+	// New migrations are picked up on the next run
+	fsys["003_more.sql"] = &fstest.MapFile{Data: []byte("INSERT INTO notes (body) VALUES ('c');")}
+	if err := Migrate(db, fsys); err != nil {
+		t.Fatalf("third run: %v", err)
+	}
+	if versions := appliedVersions(t, db); !slices.Equal(versions, []int{1, 2, 3}) {
+		t.Errorf("applied = %v, want [1 2 3]", versions)
+	}
+}
+
+func TestMigrateRollsBackFailedMigration(t *testing.T) {
+	db := openTestDB(t)
+	fsys := fstest.MapFS{
+		"001_create.sql": {Data: []byte("CREATE TABLE notes (id INTEGER PRIMARY KEY, body TEXT NOT NULL);")},
+		"002_broken.sql": {Data: []byte("INSERT INTO notes (body) VALUES ('kept?'); INSERT INTO notes (body) VALUES (NULL);")},
+		"003_after.sql":  {Data: []byte("INSERT INTO notes (body) VALUES ('never');")},
+	}
+
+	err := Migrate(db, fsys)
+	if err == nil || !strings.Contains(err.Error(), "migration 002_broken.sql failed") {
+		t.Fatalf("err = %v, want failure in 002_broken.sql", err)
+	}
+
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM notes").Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Errorf("notes = %d, want 0 after rollback", count)
+	}
+	if versions := appliedVersions(t, db); !slices.Equal(versions, []int{1}) {
+		t.Errorf("applied = %v, want [1]", versions)
+	}
+
+	// Once fixed, the migration and those after it apply
+	fsys["002_broken.sql"] = &fstest.MapFile{Data: []byte("INSERT INTO notes (body) VALUES ('fixed');")}
+	if err := Migrate(db, fsys); err != nil {
+		t.Fatalf("rerun: %v", err)
+	}
+	if versions := appliedVersions(t, db); !slices.Equal(versions, []int{1, 2, 3}) {
+		t.Errorf("applied = %v, want [1 2 3]", versions)
+	}
+}
+
+func TestMigrateEmbeddedMigrations(t *testing.T) {
+	db := openTestDB(t)
+
+	if err := Migrate(db, migrations.FS); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadMigrations(migrations.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if applied := appliedVersions(t, db); len(applied) != len(loaded) {
+		t.Errorf("applied %d migrations, want %d", len(applied), len(loaded))
+	}
+}
@@ -0,0 +1,88 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Tomlee-abila/real_time_forum/backend/internal/models"
+)
+
+// keyset builds the WHERE condition and ORDER BY clause for keyset pagination
+// over (alias.created_at, alias.id). newestFirst is the listing's natural order.
+// When the returned reversed flag is set, the caller must reverse the scanned
+// rows to restore the natural order.
+func keyset(alias string, cursor *models.Cursor, newestFirst bool) (condition, orderBy string, args []interface{}, reversed bool) {
+	backward := cursor != nil && cursor.Backward
+	descending := newestFirst != backward
+
+	direction, comparison := "ASC", ">"
+	if descending {
+		direction, comparison = "DESC", "<"
+	}
+
+	condition = "1 = 1"
+	if cursor != nil {
+		condition = fmt.Sprintf("(%s.created_at, %s.id) %s (?, ?)", alias, alias, comparison)
+		args = []interface{}{cursor.CreatedAt, cursor.ID}
+	}
+	orderBy = fmt.Sprintf("%s.created_at %s, %s.id %s", alias, direction, alias, direction)
+
+	return condition, orderBy, args, backward
+}
+
+// scoreKeyset builds the WHERE condition and ORDER BY clause for keyset pagination
+// over (alias.score, alias.created_at, alias.id), highest score first
+func scoreKeyset(alias string, cursor *models.Cursor) (condition, orderBy string, args []interface{}, reversed bool, err error) {
+	if cursor != nil && cursor.Score == nil {
+		return "", "", nil, false, fmt.Errorf("invalid cursor")
+	}
+
+	backward := cursor != nil && cursor.Backward
+	direction, comparison := "DESC", "<"
+	if backward {
+		direction, comparison = "ASC", ">"
+	}
+
+	condition = "1 = 1"
+	if cursor != nil {
+		condition = fmt.Sprintf("(%s.score, %s.created_at, %s.id) %s (?, ?, ?)", alias, alias, alias, comparison)
+		args = []interface{}{*cursor.Score, cursor.CreatedAt, cursor.ID}
+	}
+	orderBy = fmt.Sprintf("%s.score %s, %s.created_at %s, %s.id %s", alias, direction, alias, direction, alias, direction)
+
+	return condition, orderBy, args, backward, nil
+}
+
+// buildPageInfo computes the cursors for a page already in natural order.
+// hasExtra reports whether the query returned a row beyond the page limit.
+func buildPageInfo(cursor *models.Cursor, first, last *models.Cursor, count int, hasExtra bool) models.PageInfo {
+	page := models.PageInfo{HasMore: hasExtra}
+	if count == 0 {
+		return page
+	}
+
+	last.Backward = false
+	first.Backward = true
+
+	if cursor != nil && cursor.Backward {
+		// Came from further along the listing, so it can always be resumed there
+		page.NextCursor = last.Encode()
+		if hasExtra {
+			page.PrevCursor = first.Encode()
+		}
+		return page
+	}
+
+	if hasExtra {
+		page.NextCursor = last.Encode()
+	}
+	if cursor != nil {
+		page.PrevCursor = first.Encode()
+	}
+	return page
+}
+
+// cursorAt returns the cursor for a row
+func cursorAt(createdAt time.Time, id string) *models.Cursor {
+	return &models.Cursor{CreatedAt: createdAt, ID: id}
+}
@@ -0,0 +1,231 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Tomlee-abila/real_time_forum/backend/internal/models"
+)
+
+func TestKeyset(t *testing.T) {
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name          string
+		cursor        *models.Cursor
+		newestFirst   bool
+		wantCondition string
+		wantOrderBy   string
+		wantReversed  bool
+	}{
+		{"first page newest first", nil, true, "1 = 1", "m.created_at DESC, m.id DESC", false},
+		{"first page oldest first", nil, false, "1 = 1", "m.created_at ASC, m.id ASC", false},
+		{"forward newest first", &models.Cursor{CreatedAt: at, ID: "x"}, true, "(m.created_at, m.id) < (?, ?)", "m.created_at DESC, m.id DESC", false},
+		{"forward oldest first", &models.Cursor{CreatedAt: at, ID: "x"}, false, "(m.created_at, m.id) > (?, ?)", "m.created_at ASC, m.id ASC", false},
+		{"backward newest first", &models.Cursor{CreatedAt: at, ID: "x", Backward: true}, true, "(m.created_at, m.id) > (?, ?)", "m.created_at ASC, m.id ASC", true},
+		{"backward oldest first", &models.Cursor{CreatedAt: at, ID: "x", Backward: true}, false, "(m.created_at, m.id) < (?, ?)", "m.created_at DESC, m.id DESC", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			condition, orderBy, args, reversed := keyset("m", tt.cursor, tt.newestFirst)
+			if condition != tt.wantCondition {
+				t.Errorf("condition = %q, want %q", condition, tt.wantCondition)
+			}
+			if orderBy != tt.wantOrderBy {
+				t.Errorf("orderBy = %q, want %q", orderBy, tt.wantOrderBy)
+			}
+			if reversed != tt.wantReversed {
+				t.Errorf("reversed = %v, want %v", reversed, tt.wantReversed)
+			}
+			wantArgs := 0
+			if tt.cursor != nil {
+				wantArgs = 2
+			}
+			if len(args) != wantArgs {
+				t.Errorf("len(args) = %d, want %d", len(args), wantArgs)
+			}
+		})
+	}
+}
+
+func TestScoreKeyset(t *testing.T) {
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	score := 4
+
+	tests := []struct {
+		name          string
+		cursor        *models.Cursor
+		wantCondition string
+		wantOrderBy   string
+		wantReversed  bool
+		wantErr       bool
+	}{
+		{"first page", nil, "1 = 1", "p.score DESC, p.created_at DESC, p.id DESC", false, false},
+		{"forward", &models.Cursor{CreatedAt: at, ID: "x", Score: &score}, "(p.score, p.created_at, p.id) < (?, ?, ?)", "p.score DESC, p.created_at DESC, p.id DESC", false, false},
+		{"backward", &models.Cursor{CreatedAt: at, ID: "x", Score: &score, Backward: true}, "(p.score, p.created_at, p.id) > (?, ?, ?)", "p.score ASC, p.created_at ASC, p.id ASC", true, false},
+		{"missing score", &models.Cursor{CreatedAt: at, ID: "x"}, "", "", false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			condition, orderBy, _, reversed, err := scoreKeyset("p", tt.cursor)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if condition != tt.wantCondition || orderBy != tt.wantOrderBy || reversed != tt.wantReversed {
+				t.Errorf("got (%q, %q, %v), want (%q, %q, %v)",
+					condition, orderBy, reversed, tt.wantCondition, tt.wantOrderBy, tt.wantReversed)
+			}
+		})
+	}
+}
+
+func TestBuildPageInfo(t *testing.T) {
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	forward := &models.Cursor{CreatedAt: at, ID: "c"}
+	backward := &models.Cursor{CreatedAt: at, ID: "c", Backward: true}
+
+	tests := []struct {
+		name     string
+		cursor   *models.Cursor
+		count    int
+		hasExtra bool
+		wantNext bool
+		wantPrev bool
+	}{
+		{"empty page", forward, 0, false, false, false},
+		{"only page", nil, 2, false, false, false},
+		{"first of many", nil, 2, true, true, false},
+		{"middle going forward", forward, 2, true, true, true},
+		{"last going forward", forward, 2, false, false, true},
+		{"middle going backward", backward, 2, true, true, true},
+		{"first going backward", backward, 2, false, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			first, last := cursorAt(at, "a"), cursorAt(at, "b")
+			page := buildPageInfo(tt.cursor, first, last, tt.count, tt.hasExtra)
+
+			if page.HasMore != tt.hasExtra {
+				t.Errorf("HasMore = %v, want %v", page.HasMore, tt.hasExtra)
+			}
+			if (page.NextCursor != "") != tt.wantNext {
+				t.Errorf("NextCursor = %q, want set %v", page.NextCursor, tt.wantNext)
+			}
+			if (page.PrevCursor != "") != tt.wantPrev {
+				t.Errorf("PrevCursor = %q, want set %v", page.PrevCursor, tt.wantPrev)
+			}
+
+			if page.NextCursor != "" {
+				next, err := models.DecodeCursor(page.NextCursor)
+				if err != nil || next.ID != "b" || next.Backward {
+					t.Errorf("NextCursor = %+v, %v; want forward cursor at b", next, err)
+				}
+			}
+			if page.PrevCursor != "" {
+				prev, err := models.DecodeCursor(page.PrevCursor)
+				if err != nil || prev.ID != "a" || !prev.Backward {
+					t.Errorf("PrevCursor = %+v, %v; want backward cursor at a", prev, err)
+				}
+			}
+		})
+	}
+}
+
+// listItems pages through the items table the same way the listing queries do
+func listItems(t *testing.T, db *sql.DB, limit int, encoded string) ([]string, models.PageInfo) {
+	t.Helper()
+
+	cursor, err := models.DecodeCursor(encoded)
+	if err != nil {
+		t.Fatalf("DecodeCursor: %v", err)
+	}
+	condition, orderBy, cursorArgs, reversed := keyset("i", cursor, true)
+
+	query := fmt.Sprintf(`SELECT i.id, i.created_at FROM items i WHERE %s ORDER BY %s LIMIT ?`, condition, orderBy)
+	rows, err := db.Query(query, append(cursorArgs, limit+1)...)
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	var times []time.Time
+	for rows.Next() {
+		var id string
+		var createdAt time.Time
+		if err := rows.Scan(&id, &createdAt); err != nil {
+			t.Fatalf("scan: %v", err)
+		}
+		ids = append(ids, id)
+		times = append(times, createdAt)
+	}
+
+	hasExtra := len(ids) > limit
+	if hasExtra {
+		ids, times = ids[:limit], times[:limit]
+	}
+	if reversed {
+		slices.Reverse(ids)
+		slices.Reverse(times)
+	}
+
+	var first, last *models.Cursor
+	if len(ids) > 0 {
+		first = cursorAt(times[0], ids[0])
+		last = cursorAt(times[len(ids)-1], ids[len(ids)-1])
+	}
+	return ids, buildPageInfo(cursor, first, last, len(ids), hasExtra)
+}
+
+func TestKeysetPaging(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(`CREATE TABLE items (id TEXT PRIMARY KEY, created_at DATETIME NOT NULL)`); err != nil {
+		t.Fatal(err)
+	}
+	// e and d share a timestamp so the id breaks the tie
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for i, id := range []string{"a", "b", "c", "d", "e"} {
+		createdAt := base.Add(time.Duration(min(i, 3)) * time.Minute)
+		if _, err := db.Exec(`INSERT INTO items (id, created_at) VALUES (?, ?)`, id, createdAt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	steps := []struct {
+		name     string
+		cursor   func(models.PageInfo) string
+		wantIDs  []string
+		wantNext bool
+		wantPrev bool
+	}{
+		{"first page", func(models.PageInfo) string { return "" }, []string{"e", "d"}, true, false},
+		{"second page", func(p models.PageInfo) string { return p.NextCursor }, []string{"c", "b"}, true, true},
+		{"last page", func(p models.PageInfo) string { return p.NextCursor }, []string{"a"}, false, true},
+		{"back to second", func(p models.PageInfo) string { return p.PrevCursor }, []string{"c", "b"}, true, true},
+		{"back to first", func(p models.PageInfo) string { return p.PrevCursor }, []string{"e", "d"}, true, false},
+	}
+
+	var page models.PageInfo
+	for _, step := range steps {
+		var ids []string
+		ids, page = listItems(t, db, 2, step.cursor(page))
+		if !slices.Equal(ids, step.wantIDs) {
+			t.Fatalf("%s: ids = %v, want %v", step.name, ids, step.wantIDs)
+		}
+		if (page.NextCursor != "") != step.wantNext || (page.PrevCursor != "") != step.wantPrev {
+			t.Fatalf("%s: page = %+v, want next %v prev %v", step.name, page, step.wantNext, step.wantPrev)
+		}
+	}
+}
@@ -3,86 +3,173 @@ package database
 import (
 	"database/sql"
 	"fmt"
+	"slices"
 	"time"
 
+	"github.com/Tomlee-abila/real_time_forum/backend/internal/markdown"
 	"github.com/Tomlee-abila/real_time_forum/backend/internal/models"
 	"github.com/google/uuid"
 )
 
-// CreatePost creates a new post in the database
+// CreatePost creates a new post with its categories and tags
 func CreatePost(userID string, post *models.PostCreation) (*models.Post, error) {
 	postID := uuid.New().String()
 	createdAt := time.Now()
 
+	tx, err := DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
 	query := `
-        INSERT INTO posts (id, user_id, title, content, category, created_at)
-        VALUES (?, ?, ?, ?, ?, ?)
+        INSERT INTO posts (id, user_id, title, content, created_at)
+        VALUES (?, ?, ?, ?, ?)
     `
 
-	_, err := DB.Exec(query, postID, userID, post.Title, post.Content, post.Category, createdAt)
+	_, err = tx.Exec(query, postID, userID, post.Title, post.Content, createdAt)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create post: %w", err)
 	}
 
+	if err := insertPostTags(tx, postID, post.Categories, post.Tags); err != nil {
+		return nil, err
+	}
+
+	if err := linkAttachments(tx, attachmentPostColumn, postID, userID, post.AttachmentIDs); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit post: %w", err)
+	}
+
 	// Get user nickname for response
 	user, err := GetUserByID(userID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user info: %w", err)
 	}
 
-	return &models.Post{
+	posts := []models.Post{{
 		ID:           postID,
 		UserID:       userID,
 		Title:        post.Title,
 		Content:      post.Content,
-		Category:     post.Category,
+		ContentHTML:  markdown.Render(post.Content),
+		Categories:   post.Categories,
+		Tags:         post.Tags,
 		CreatedAt:    createdAt,
 		UserNickname: user.Nickname,
-	}, nil
+	}}
+	if err := attachPostAttachments(posts); err != nil {
+		return nil, err
+	}
+
+	return &posts[0], nil
 }
 
-// GetAllPosts retrieves all posts with user info and comment count (for feed)
-func GetAllPosts(limit, offset int) ([]models.Post, error) {
-	query := `
+// GetAllPosts retrieves a page of posts with user info, comment count and
+// reactions (for feed), sorted by models.PostSortNew or models.PostSortTop
+func GetAllPosts(viewerID, sort string, limit int, cursor *models.Cursor) ([]models.Post, models.PageInfo, error) {
+	return queryPosts("1 = 1", nil, viewerID, sort, limit, cursor)
+}
+
+// queryPosts retrieves a page of posts matching the given filter, hiding
+// posts by users the viewer has blocked
+func queryPosts(filter string, filterArgs []interface{}, viewerID, sort string, limit int, cursor *models.Cursor) ([]models.Post, models.PageInfo, error) {
+	// Leave out posts by users the viewer has blocked
+	if viewerID != "" {
+		filter = "(" + filter + ") AND p.user_id NOT IN (SELECT blocked_id FROM user_blocks WHERE blocker_id = ?)"
+		filterArgs = append(append([]interface{}{}, filterArgs...), viewerID)
+	}
+
+	var condition, orderBy string
+	var cursorArgs []interface{}
+	var reversed bool
+	if sort == models.PostSortTop {
+		var err error
+		condition, orderBy, cursorArgs, reversed, err = scoreKeyset("p", cursor)
+		if err != nil {
+			return nil, models.PageInfo{}, err
+		}
+	} else {
+		condition, orderBy, cursorArgs, reversed = keyset("p", cursor, true)
+	}
+
+	query := fmt.Sprintf(`
         SELECT 
-            p.id, p.user_id, p.title, p.content, p.category, p.created_at,
+            p.id, p.user_id, p.title, p.content, p.created_at, p.edited_at, p.locked_at IS NOT NULL, p.score,
             u.nickname,
             COUNT(c.id) as comment_count
         FROM posts p
         LEFT JOIN users u ON p.user_id = u.id
         LEFT JOIN comments c ON p.id = c.post_id
-        GROUP BY p.id, p.user_id, p.title, p.content, p.category, p.created_at, u.nickname
-        ORDER BY p.created_at DESC
-        LIMIT ? OFFSET ?
-    `
-
-	rows, err := DB.Query(query, limit, offset)
+        WHERE %s AND %s
+        GROUP BY p.id, p.user_id, p.title, p.content, p.created_at, p.edited_at, p.locked_at IS NOT NULL, p.score, u.nickname
+        ORDER BY %s
+        LIMIT ?
+    `, filter, condition, orderBy)
+
+	args := append(append(append([]interface{}{}, filterArgs...), cursorArgs...), limit+1)
+	rows, err := DB.Query(query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get posts: %w", err)
+		return nil, models.PageInfo{}, fmt.Errorf("failed to get posts: %w", err)
 	}
 	defer rows.Close()
 
 	var posts []models.Post
 	for rows.Next() {
 		var post models.Post
+		var editedAt sql.NullTime
 		err := rows.Scan(
-			&post.ID, &post.UserID, &post.Title, &post.Content, &post.Category, &post.CreatedAt,
+			&post.ID, &post.UserID, &post.Title, &post.Content, &post.CreatedAt, &editedAt, &post.Locked, &post.Score,
 			&post.UserNickname, &post.CommentCount,
 		)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan post: %w", err)
+			return nil, models.PageInfo{}, fmt.Errorf("failed to scan post: %w", err)
 		}
+		post.EditedAt = timePtr(editedAt)
+		post.ContentHTML = markdown.Render(post.Content)
 		posts = append(posts, post)
 	}
 
-	return posts, nil
+	// Fetch one extra row to know whether another page exists
+	hasExtra := len(posts) > limit
+	if hasExtra {
+		posts = posts[:limit]
+	}
+	if reversed {
+		slices.Reverse(posts)
+	}
+
+	var first, last *models.Cursor
+	if len(posts) > 0 {
+		first = cursorAt(posts[0].CreatedAt, posts[0].ID)
+		last = cursorAt(posts[len(posts)-1].CreatedAt, posts[len(posts)-1].ID)
+		if sort == models.PostSortTop {
+			first.Score = &posts[0].Score
+			last.Score = &posts[len(posts)-1].Score
+		}
+	}
+
+	if err := attachPostTags(posts); err != nil {
+		return nil, models.PageInfo{}, err
+	}
+	if err := attachPostAttachments(posts); err != nil {
+		return nil, models.PageInfo{}, err
+	}
+	if err := attachPostReactions(posts, viewerID); err != nil {
+		return nil, models.PageInfo{}, err
+	}
+
+	return posts, buildPageInfo(cursor, first, last, len(posts), hasExtra), nil
 }
 
 // GetPostByID retrieves a specific post by ID
 func GetPostByID(postID string) (*models.Post, error) {
 	query := `
         SELECT 
-            p.id, p.user_id, p.title, p.content, p.category, p.created_at,
+            p.id, p.user_id, p.title, p.content, p.created_at, p.edited_at, p.locked_at IS NOT NULL, p.score,
             u.nickname
         FROM posts p
         LEFT JOIN users u ON p.user_id = u.id
@@ -90,8 +177,9 @@ func GetPostByID(postID string) (*models.Post, error) {
     `
 
 	var post models.Post
+	var editedAt sql.NullTime
 	err := DB.QueryRow(query, postID).Scan(
-		&post.ID, &post.UserID, &post.Title, &post.Content, &post.Category, &post.CreatedAt,
+		&post.ID, &post.UserID, &post.Title, &post.Content, &post.CreatedAt, &editedAt, &post.Locked, &post.Score,
 		&post.UserNickname,
 	)
 
@@ -101,20 +189,37 @@ func GetPostByID(postID string) (*models.Post, error) {
 		}
 		return nil, fmt.Errorf("failed to get post: %w", err)
 	}
+	post.EditedAt = timePtr(editedAt)
+	post.ContentHTML = markdown.Render(post.Content)
 
-	return &post, nil
+	posts := []models.Post{post}
+	if err := attachPostTags(posts); err != nil {
+		return nil, err
+	}
+	if err := attachPostAttachments(posts); err != nil {
+		return nil, err
+	}
+
+	return &posts[0], nil
 }
 
-// GetPostWithComments retrieves a post with all its comments
-func GetPostWithComments(postID string) (*models.PostWithComments, error) {
+// GetPostWithComments retrieves a post with a page of its comments,
+// including reactions as seen by the viewer
+func GetPostWithComments(postID, viewerID string, limit int, cursor *models.Cursor) (*models.PostWithComments, error) {
 	// Get the post
 	post, err := GetPostByID(postID)
 	if err != nil {
 		return nil, err
 	}
 
+	posts := []models.Post{*post}
+	if err := attachPostReactions(posts, viewerID); err != nil {
+		return nil, err
+	}
+	post = &posts[0]
+
 	// Get comments for the post
-	comments, err := GetCommentsByPostID(postID)
+	comments, page, err := GetCommentsByPostID(postID, viewerID, limit, cursor)
 	if err != nil {
 		return nil, err
 	}
@@ -122,64 +227,49 @@ func GetPostWithComments(postID string) (*models.PostWithComments, error) {
 	return &models.PostWithComments{
 		Post:     *post,
 		Comments: comments,
+		PageInfo: page,
 	}, nil
 }
 
-// GetPostsByCategory retrieves posts by category
-func GetPostsByCategory(category string, limit, offset int) ([]models.Post, error) {
-	query := `
-        SELECT 
-            p.id, p.user_id, p.title, p.content, p.category, p.created_at,
-            u.nickname,
-            COUNT(c.id) as comment_count
-        FROM posts p
-        LEFT JOIN users u ON p.user_id = u.id
-        LEFT JOIN comments c ON p.id = c.post_id
-        WHERE p.category = ?
-        GROUP BY p.id, p.user_id, p.title, p.content, p.category, p.created_at, u.nickname
-        ORDER BY p.created_at DESC
-        LIMIT ? OFFSET ?
-    `
-
-	rows, err := DB.Query(query, category, limit, offset)
+// GetPostsByTags retrieves a page of posts matching any or all of the
+// filter's categories and tags
+func GetPostsByTags(filter *models.TagFilter, viewerID, sort string, limit int, cursor *models.Cursor) ([]models.Post, models.PageInfo, error) {
+	condition, args := tagFilterCondition(filter)
+	posts, page, err := queryPosts(condition, args, viewerID, sort, limit, cursor)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get posts by category: %w", err)
+		return nil, models.PageInfo{}, fmt.Errorf("failed to get posts by tags: %w", err)
 	}
-	defer rows.Close()
-
-	var posts []models.Post
-	for rows.Next() {
-		var post models.Post
-		err := rows.Scan(
-			&post.ID, &post.UserID, &post.Title, &post.Content, &post.Category, &post.CreatedAt,
-			&post.UserNickname, &post.CommentCount,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan post: %w", err)
-		}
-		posts = append(posts, post)
-	}
-
-	return posts, nil
+	return posts, page, nil
 }
 
 // CreateComment creates a new comment on a post
 func CreateComment(userID, postID string, comment *models.CommentCreation) (*models.Comment, error) {
-	// First check if post exists
-	_, err := GetPostByID(postID)
+	// First check if post exists and is open for comments
+	post, err := GetPostByID(postID)
 	if err != nil {
 		return nil, fmt.Errorf("post not found")
 	}
+	if post.Locked {
+		return nil, fmt.Errorf("post is locked")
+	}
 
 	commentID := uuid.New().String()
 	createdAt := time.Now()
 
+	// Replies must point at a comment on the same post
+	if comment.ParentID != "" {
+		if err := ResolveCommentParent(postID, comment); err != nil {
+			return nil, err
+		}
+	}
+
 	query := `
-        INSERT INTO comments (id, post_id, user_id, content, created_at)
-        VALUES (?, ?, ?, ?, ?)
+        INSERT INTO comments (id, post_id, user_id, content, created_at, parent_id, depth)
+        VALUES (?, ?, ?, ?, ?, ?, ?)
     `
 
-	_, err = DB.Exec(query, commentID, postID, userID, comment.Content, createdAt)
+	_, err = DB.Exec(query, commentID, postID, userID, comment.Content, createdAt,
+		nullIfEmpty(comment.ParentID), comment.Depth)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create comment: %w", err)
 	}
@@ -195,43 +285,74 @@ func CreateComment(userID, postID string, comment *models.CommentCreation) (*mod
 		PostID:       postID,
 		UserID:       userID,
 		Content:      comment.Content,
+		ContentHTML:  markdown.Render(comment.Content),
 		CreatedAt:    createdAt,
+		ParentID:     comment.ParentID,
+		Depth:        comment.Depth,
 		UserNickname: user.Nickname,
 	}, nil
 }
 
-// GetCommentsByPostID retrieves all comments for a specific post
-func GetCommentsByPostID(postID string) ([]models.Comment, error) {
-	query := `
-        SELECT 
-            c.id, c.post_id, c.user_id, c.content, c.created_at,
-            u.nickname
+// GetCommentsByPostID retrieves a page of top-level comments for a specific post,
+// oldest first, each with its nested replies
+func GetCommentsByPostID(postID, viewerID string, limit int, cursor *models.Cursor) ([]models.Comment, models.PageInfo, error) {
+	condition, orderBy, cursorArgs, reversed := keyset("c", cursor, false)
+
+	query := fmt.Sprintf(`
+        SELECT %s
         FROM comments c
         LEFT JOIN users u ON c.user_id = u.id
-        WHERE c.post_id = ?
-        ORDER BY c.created_at ASC
-    `
+        WHERE c.post_id = ? AND c.parent_id IS NULL AND %s
+        ORDER BY %s
+        LIMIT ?
+    `, commentColumns, condition, orderBy)
 
-	rows, err := DB.Query(query, postID)
+	args := append(append([]interface{}{postID}, cursorArgs...), limit+1)
+	rows, err := DB.Query(query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get comments: %w", err)
+		return nil, models.PageInfo{}, fmt.Errorf("failed to get comments: %w", err)
 	}
 	defer rows.Close()
 
-	var comments []models.Comment
-	for rows.Next() {
-		var comment models.Comment
-		err := rows.Scan(
-			&comment.ID, &comment.PostID, &comment.UserID, &comment.Content, &comment.CreatedAt,
-			&comment.UserNickname,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan comment: %w", err)
-		}
-		comments = append(comments, comment)
+	comments, err := scanComments(rows)
+	if err != nil {
+		return nil, models.PageInfo{}, err
+	}
+
+	// Fetch one extra row to know whether another page exists
+	hasExtra := len(comments) > limit
+	if hasExtra {
+		comments = comments[:limit]
+	}
+	if reversed {
+		slices.Reverse(comments)
+	}
+
+	var first, last *models.Cursor
+	if len(comments) > 0 {
+		first = cursorAt(comments[0].CreatedAt, comments[0].ID)
+		last = cursorAt(comments[len(comments)-1].CreatedAt, comments[len(comments)-1].ID)
 	}
+	page := buildPageInfo(cursor, first, last, len(comments), hasExtra)
 
-	return comments, nil
+	// Attach the replies of every comment on this page
+	rootIDs := make([]string, len(comments))
+	for i := range comments {
+		rootIDs[i] = comments[i].ID
+	}
+	replies, err := getCommentReplies(rootIDs)
+	if err != nil {
+		return nil, models.PageInfo{}, err
+	}
+	for i := range comments {
+		attachReplies(&comments[i], replies)
+	}
+
+	if err := attachCommentReactions(comments, viewerID); err != nil {
+		return nil, models.PageInfo{}, err
+	}
+
+	return comments, page, nil
 }
 
 // GetPostCount returns the total number of posts
@@ -247,7 +368,7 @@ func GetPostCount() (int, error) {
 
 // GetPostCountByCategory returns the number of posts in a specific category
 func GetPostCountByCategory(category string) (int, error) {
-	query := "SELECT COUNT(*) FROM posts WHERE category = ?"
+	query := "SELECT COUNT(*) FROM post_tags WHERE kind = 'category' AND tag = ?"
 	var count int
 	err := DB.QueryRow(query, category).Scan(&count)
 	if err != nil {
@@ -256,12 +377,18 @@ func GetPostCountByCategory(category string) (int, error) {
 	return count, nil
 }
 
-// DeletePost deletes a post (only by the post owner)
-func DeletePost(postID, userID string) error {
+// DeletePost deletes a post, by its owner or by a role allowed to delete any post
+func DeletePost(postID, userID string, role models.Role) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
 	// First check if the post exists and belongs to the user
 	query := "SELECT user_id FROM posts WHERE id = ?"
 	var postOwnerID string
-	err := DB.QueryRow(query, postID).Scan(&postOwnerID)
+	err = tx.QueryRow(query, postID).Scan(&postOwnerID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return fmt.Errorf("post not found")
@@ -269,31 +396,83 @@ func DeletePost(postID, userID string) error {
 		return fmt.Errorf("failed to check post ownership: %w", err)
 	}
 
-	if postOwnerID != userID {
+	if postOwnerID != userID && !role.Can(models.PermDeleteAnyPost) {
 		return fmt.Errorf("unauthorized: you can only delete your own posts")
 	}
 
+	// Delete reactions on the post and its comments
+	_, err = tx.Exec(`
+        DELETE FROM reactions
+        WHERE (target_type = 'post' AND target_id = ?)
+           OR (target_type = 'comment' AND target_id IN (SELECT id FROM comments WHERE post_id = ?))
+    `, postID, postID)
+	if err != nil {
+		return fmt.Errorf("failed to delete reactions: %w", err)
+	}
+
+	// Delete revisions of the post and its comments
+	_, err = tx.Exec(`
+        DELETE FROM revisions
+        WHERE (target_type = 'post' AND target_id = ?)
+           OR (target_type = 'comment' AND target_id IN (SELECT id FROM comments WHERE post_id = ?))
+    `, postID, postID)
+	if err != nil {
+		return fmt.Errorf("failed to delete revisions: %w", err)
+	}
+
+	// Delete the post's categories and tags
+	_, err = tx.Exec("DELETE FROM post_tags WHERE post_id = ?", postID)
+	if err != nil {
+		return fmt.Errorf("failed to delete post tags: %w", err)
+	}
+
+	// Delete mentions in the post and its comments
+	_, err = tx.Exec("DELETE FROM mentions WHERE post_id = ?", postID)
+	if err != nil {
+		return fmt.Errorf("failed to delete mentions: %w", err)
+	}
+
+	// Delete the post's attachments; their files go once the rows are gone for good
+	attachments, err := deleteAttachments(tx, attachmentPostColumn, []string{postID})
+	if err != nil {
+		return err
+	}
+
 	// Delete comments first (due to foreign key constraint)
-	_, err = DB.Exec("DELETE FROM comments WHERE post_id = ?", postID)
+	_, err = tx.Exec("DELETE FROM comments WHERE post_id = ?", postID)
 	if err != nil {
 		return fmt.Errorf("failed to delete comments: %w", err)
 	}
 
 	// Delete the post
-	_, err = DB.Exec("DELETE FROM posts WHERE id = ?", postID)
+	_, err = tx.Exec("DELETE FROM posts WHERE id = ?", postID)
 	if err != nil {
 		return fmt.Errorf("failed to delete post: %w", err)
 	}
 
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit post deletion: %w", err)
+	}
+
+	for i := range attachments {
+		DeleteAttachmentFiles(&attachments[i])
+	}
 	return nil
 }
 
-// DeleteComment deletes a comment (only by the comment owner)
-func DeleteComment(commentID, userID string) error {
+// DeleteComment deletes a comment and its replies, by its owner or by a role
+// allowed to delete any comment
+func DeleteComment(commentID, userID string, role models.Role) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
 	// First check if the comment exists and belongs to the user
 	query := "SELECT user_id FROM comments WHERE id = ?"
 	var commentOwnerID string
-	err := DB.QueryRow(query, commentID).Scan(&commentOwnerID)
+	err = tx.QueryRow(query, commentID).Scan(&commentOwnerID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return fmt.Errorf("comment not found")
@@ -301,15 +480,63 @@ func DeleteComment(commentID, userID string) error {
 		return fmt.Errorf("failed to check comment ownership: %w", err)
 	}
 
-	if commentOwnerID != userID {
+	if commentOwnerID != userID && !role.Can(models.PermDeleteAnyComment) {
 		return fmt.Errorf("unauthorized: you can only delete your own comments")
 	}
 
-	// Delete the comment
-	_, err = DB.Exec("DELETE FROM comments WHERE id = ?", commentID)
+	// Delete the comment together with its replies and their reactions, revisions and mentions
+	thread := `
+        WITH RECURSIVE thread(id) AS (
+            SELECT ?
+            UNION ALL
+            SELECT c.id FROM comments c JOIN thread t ON c.parent_id = t.id
+        )
+    `
+	_, err = tx.Exec(thread+"DELETE FROM reactions WHERE target_type = 'comment' AND target_id IN (SELECT id FROM thread)", commentID)
+	if err != nil {
+		return fmt.Errorf("failed to delete reactions: %w", err)
+	}
+
+	_, err = tx.Exec(thread+"DELETE FROM revisions WHERE target_type = 'comment' AND target_id IN (SELECT id FROM thread)", commentID)
+	if err != nil {
+		return fmt.Errorf("failed to delete revisions: %w", err)
+	}
+
+	_, err = tx.Exec(thread+"DELETE FROM mentions WHERE comment_id IN (SELECT id FROM thread)", commentID)
+	if err != nil {
+		return fmt.Errorf("failed to delete mentions: %w", err)
+	}
+
+	_, err = tx.Exec(thread+"DELETE FROM comments WHERE id IN (SELECT id FROM thread)", commentID)
 	if err != nil {
 		return fmt.Errorf("failed to delete comment: %w", err)
 	}
 
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit comment deletion: %w", err)
+	}
+	return nil
+}
+
+// LockPost locks or unlocks a post. Only roles allowed to lock posts may do so.
+func LockPost(postID, userID string, role models.Role, locked bool) error {
+	if !role.Can(models.PermLockPost) {
+		return fmt.Errorf("unauthorized: only moderators can lock posts")
+	}
+
+	var result sql.Result
+	var err error
+	if locked {
+		result, err = DB.Exec("UPDATE posts SET locked_at = ?, locked_by = ? WHERE id = ?", time.Now(), userID, postID)
+	} else {
+		result, err = DB.Exec("UPDATE posts SET locked_at = NULL, locked_by = NULL WHERE id = ?", postID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to lock post: %w", err)
+	}
+	if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+		return fmt.Errorf("post not found")
+	}
+
 	return nil
 }
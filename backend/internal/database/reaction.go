@@ -0,0 +1,195 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/Tomlee-abila/real_time_forum/backend/internal/models"
+)
+
+// ToggleReaction sets the user's reaction on a post or comment. Reacting with the
+// same reaction again removes it; a different reaction replaces the previous one.
+func ToggleReaction(userID, targetType, targetID string, toggle *models.ReactionToggle) (*models.ReactionUpdate, error) {
+	table, err := reactionTargetTable(targetType)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Check the target exists and find the post it belongs to
+	var postID string
+	targetQuery := "SELECT id FROM posts WHERE id = ?"
+	if table == "comments" {
+		targetQuery = "SELECT post_id FROM comments WHERE id = ?"
+	}
+	if err := tx.QueryRow(targetQuery, targetID).Scan(&postID); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%s not found", targetType)
+		}
+		return nil, fmt.Errorf("failed to check reaction target: %w", err)
+	}
+
+	var previous string
+	err = tx.QueryRow(
+		"SELECT reaction FROM reactions WHERE user_id = ? AND target_type = ? AND target_id = ?",
+		userID, targetType, targetID,
+	).Scan(&previous)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to get reaction: %w", err)
+	}
+
+	current := toggle.Reaction
+	if previous == toggle.Reaction {
+		current = ""
+		_, err = tx.Exec(
+			"DELETE FROM reactions WHERE user_id = ? AND target_type = ? AND target_id = ?",
+			userID, targetType, targetID,
+		)
+	} else {
+		_, err = tx.Exec(`
+            INSERT OR REPLACE INTO reactions (user_id, target_type, target_id, reaction)
+            VALUES (?, ?, ?, ?)
+        `, userID, targetType, targetID, current)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to toggle reaction: %w", err)
+	}
+
+	// Keep the denormalized score in step
+	delta := models.ReactionScore(current) - models.ReactionScore(previous)
+	if delta != 0 {
+		if _, err := tx.Exec("UPDATE "+table+" SET score = score + ? WHERE id = ?", delta, targetID); err != nil {
+			return nil, fmt.Errorf("failed to update score: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to toggle reaction: %w", err)
+	}
+
+	summaries, err := getReactionSummaries(targetType, []string{targetID}, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.ReactionUpdate{
+		TargetType: targetType,
+		TargetID:   targetID,
+		PostID:     postID,
+		UserID:     userID,
+		Reaction:   current,
+		Reactions:  summaries[targetID].Reactions,
+		Score:      summaries[targetID].Score,
+	}, nil
+}
+
+// reactionTargetTable maps a reaction target type to its table
+func reactionTargetTable(targetType string) (string, error) {
+	switch targetType {
+	case models.ReactionTargetPost:
+		return "posts", nil
+	case models.ReactionTargetComment:
+		return "comments", nil
+	}
+	return "", fmt.Errorf("invalid reaction target")
+}
+
+// getReactionSummaries loads reaction counts, scores and the viewer's own
+// reaction for a batch of targets
+func getReactionSummaries(targetType string, targetIDs []string, viewerID string) (map[string]models.ReactionSummary, error) {
+	summaries := make(map[string]models.ReactionSummary)
+	if len(targetIDs) == 0 {
+		return summaries, nil
+	}
+
+	placeholders := queryPlaceholders(len(targetIDs))
+	query := fmt.Sprintf(`
+        SELECT target_id, reaction, COUNT(*), MAX(user_id = ?)
+        FROM reactions
+        WHERE target_type = ? AND target_id IN (%s)
+        GROUP BY target_id, reaction
+    `, placeholders)
+
+	args := []interface{}{viewerID, targetType}
+	for _, id := range targetIDs {
+		args = append(args, id)
+	}
+
+	rows, err := DB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get reactions: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var targetID, reaction string
+		var count int
+		var mine bool
+		if err := rows.Scan(&targetID, &reaction, &count, &mine); err != nil {
+			return nil, fmt.Errorf("failed to scan reaction: %w", err)
+		}
+
+		summary := summaries[targetID]
+		if summary.Reactions == nil {
+			summary.Reactions = make(map[string]int)
+		}
+		summary.Reactions[reaction] = count
+		summary.Score += models.ReactionScore(reaction) * count
+		if mine && viewerID != "" {
+			summary.MyReaction = reaction
+		}
+		summaries[targetID] = summary
+	}
+
+	return summaries, rows.Err()
+}
+
+// attachPostReactions fills in the reaction summaries of a page of posts
+func attachPostReactions(posts []models.Post, viewerID string) error {
+	ids := make([]string, len(posts))
+	for i := range posts {
+		ids[i] = posts[i].ID
+	}
+
+	summaries, err := getReactionSummaries(models.ReactionTargetPost, ids, viewerID)
+	if err != nil {
+		return err
+	}
+	for i := range posts {
+		posts[i].ReactionSummary = summaries[posts[i].ID]
+	}
+	return nil
+}
+
+// attachCommentReactions fills in the reaction summaries of comments and all their replies
+func attachCommentReactions(comments []models.Comment, viewerID string) error {
+	var ids []string
+	var collect func([]models.Comment)
+	collect = func(list []models.Comment) {
+		for i := range list {
+			ids = append(ids, list[i].ID)
+			collect(list[i].Replies)
+		}
+	}
+	collect(comments)
+
+	summaries, err := getReactionSummaries(models.ReactionTargetComment, ids, viewerID)
+	if err != nil {
+		return err
+	}
+
+	var apply func([]models.Comment)
+	apply = func(list []models.Comment) {
+		for i := range list {
+			list[i].ReactionSummary = summaries[list[i].ID]
+			apply(list[i].Replies)
+		}
+	}
+	apply(comments)
+	return nil
+}
@@ -0,0 +1,114 @@
+package database
+
+import (
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Tomlee-abila/real_time_forum/backend/internal/models"
+)
+
+// react toggles a reaction and fails the test on error
+func react(t *testing.T, userID, targetType, targetID, reaction string) *models.ReactionUpdate {
+	t.Helper()
+
+	update, err := ToggleReaction(userID, targetType, targetID, &models.ReactionToggle{Reaction: reaction})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return update
+}
+
+func TestToggleReaction(t *testing.T) {
+	useTestDB(t)
+	alice := createTestUser(t, "alice")
+	bob := createTestUser(t, "bob")
+	post := createTestPost(t, alice.ID, "Title", "Body")
+
+	steps := []struct {
+		name          string
+		userID        string
+		reaction      string
+		wantReaction  string
+		wantReactions map[string]int
+		wantScore     int
+	}{
+		{"like", alice.ID, "like", "like", map[string]int{"like": 1}, 1},
+		{"second like", bob.ID, "like", "like", map[string]int{"like": 2}, 2},
+		{"switch to dislike", bob.ID, "dislike", "dislike", map[string]int{"like": 1, "dislike": 1}, 0},
+		{"emoji does not score", bob.ID, "love", "love", map[string]int{"like": 1, "love": 1}, 1},
+		{"same reaction removes it", alice.ID, "like", "", map[string]int{"love": 1}, 0},
+	}
+
+	for _, step := range steps {
+		update := react(t, step.userID, models.ReactionTargetPost, post.ID, step.reaction)
+		if update.Reaction != step.wantReaction || update.Score != step.wantScore || update.PostID != post.ID {
+			t.Errorf("%s: update = %+v", step.name, update)
+		}
+		if !maps.Equal(update.Reactions, step.wantReactions) {
+			t.Errorf("%s: reactions = %v, want %v", step.name, update.Reactions, step.wantReactions)
+		}
+	}
+
+	// The viewer's own reaction comes back with the post
+	posts, _, err := GetAllPosts(bob.ID, models.PostSortNew, 10, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(posts) != 1 || posts[0].MyReaction != "love" {
+		t.Errorf("posts = %+v, want bob's love reaction", posts)
+	}
+
+	if _, err := ToggleReaction(alice.ID, models.ReactionTargetComment, "missing", &models.ReactionToggle{Reaction: "like"}); err == nil || !strings.Contains(err.Error(), "comment not found") {
+		t.Errorf("reacting to a missing comment: err = %v", err)
+	}
+	if _, err := ToggleReaction(alice.ID, "message", post.ID, &models.ReactionToggle{Reaction: "like"}); err == nil || !strings.Contains(err.Error(), "invalid reaction target") {
+		t.Errorf("reacting to a message: err = %v", err)
+	}
+}
+
+func TestTopPostsPaging(t *testing.T) {
+	useTestDB(t)
+	users := []*models.User{createTestUser(t, "alice"), createTestUser(t, "bob"), createTestUser(t, "carol")}
+
+	// Scores: p0 -1, p1 0, p2 2, p3 3, p4 0
+	scores := []int{-1, 0, 2, 3, 0}
+	var ids []string
+	for _, score := range scores {
+		post := createTestPost(t, users[0].ID, "Post", "Body")
+		ids = append(ids, post.ID)
+		reaction := "like"
+		if score < 0 {
+			reaction = "dislike"
+		}
+		for j := 0; j < max(score, -score); j++ {
+			react(t, users[j].ID, models.ReactionTargetPost, post.ID, reaction)
+		}
+	}
+
+	// Posts with equal scores come newest first
+	want := []string{ids[3], ids[2], ids[4], ids[1], ids[0]}
+
+	var got []string
+	var cursor *models.Cursor
+	for page := 0; page < 5; page++ {
+		posts, info, err := GetAllPosts("", models.PostSortTop, 2, cursor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, post := range posts {
+			got = append(got, post.ID)
+		}
+		if info.NextCursor == "" {
+			break
+		}
+		if cursor, err = models.DecodeCursor(info.NextCursor); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if !slices.Equal(got, want) {
+		t.Errorf("top posts = %v, want %v", got, want)
+	}
+}
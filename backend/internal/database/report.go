@@ -0,0 +1,303 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Tomlee-abila/real_time_forum/backend/internal/models"
+	"github.com/google/uuid"
+)
+
+// reportColumns selects a report with the nicknames of the reporter and the reported user
+const reportColumns = `
+            r.id, r.reporter_id, COALESCE(ru.nickname, ''), r.target_type, r.target_id,
+            r.target_user_id, COALESCE(tu.nickname, ''), r.target_content, r.reason,
+            r.status, r.created_at, r.updated_at`
+
+// CreateReport files a report against a post, comment or message and opens it in the moderation queue
+func CreateReport(reporterID string, report *models.ReportCreation) (*models.Report, error) {
+	targetUserID, targetContent, err := getReportTarget(report.TargetType, report.TargetID, reporterID)
+	if err != nil {
+		return nil, err
+	}
+	if targetUserID == reporterID {
+		return nil, fmt.Errorf("cannot report your own content")
+	}
+
+	var existing int
+	err = DB.QueryRow(`
+        SELECT COUNT(*) FROM reports
+        WHERE reporter_id = ? AND target_type = ? AND target_id = ? AND status = ?
+    `, reporterID, report.TargetType, report.TargetID, models.ReportOpen).Scan(&existing)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check existing reports: %w", err)
+	}
+	if existing > 0 {
+		return nil, fmt.Errorf("report already open for this content")
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	reportID := uuid.New().String()
+	now := time.Now()
+
+	_, err = tx.Exec(`
+        INSERT INTO reports (id, reporter_id, target_type, target_id, target_user_id, target_content, reason, status, created_at, updated_at)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+    `, reportID, reporterID, report.TargetType, report.TargetID, targetUserID, targetContent,
+		report.Reason, models.ReportOpen, now, now)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, fmt.Errorf("report already open for this content")
+		}
+		return nil, fmt.Errorf("failed to create report: %w", err)
+	}
+
+	if err := insertReportAction(tx, reportID, reporterID, "", models.ReportOpen, "", now); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit report: %w", err)
+	}
+
+	return GetReportByID(reportID)
+}
+
+// getReportTarget returns the author and content of reported content. Messages
+// can only be reported by members of their conversation.
+func getReportTarget(targetType, targetID, reporterID string) (userID, content string, err error) {
+	switch targetType {
+	case models.ReportTargetPost:
+		err = DB.QueryRow("SELECT user_id, title || char(10) || char(10) || content FROM posts WHERE id = ?",
+			targetID).Scan(&userID, &content)
+	case models.ReportTargetComment:
+		err = DB.QueryRow("SELECT user_id, content FROM comments WHERE id = ?",
+			targetID).Scan(&userID, &content)
+	case models.ReportTargetMessage:
+		err = DB.QueryRow(`
+            SELECT m.sender_id, m.content
+            FROM messages m
+            JOIN conversation_members cm ON cm.conversation_id = m.conversation_id AND cm.user_id = ?
+            WHERE m.id = ? AND m.deleted_at IS NULL
+        `, reporterID, targetID).Scan(&userID, &content)
+	default:
+		return "", "", fmt.Errorf("invalid report target type")
+	}
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", "", fmt.Errorf("%s not found", targetType)
+		}
+		return "", "", fmt.Errorf("failed to get reported %s: %w", targetType, err)
+	}
+	return userID, content, nil
+}
+
+// GetReportByID retrieves a report together with its audit trail
+func GetReportByID(reportID string) (*models.Report, error) {
+	query := `SELECT ` + reportColumns + `
+        FROM reports r
+        LEFT JOIN users ru ON r.reporter_id = ru.id
+        LEFT JOIN users tu ON r.target_user_id = tu.id
+        WHERE r.id = ?
+    `
+
+	rows, err := DB.Query(query, reportID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get report: %w", err)
+	}
+	defer rows.Close()
+
+	reports, err := scanReports(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(reports) == 0 {
+		return nil, fmt.Errorf("report not found")
+	}
+
+	report := &reports[0]
+	report.Actions, err = getReportActions(report.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// GetReports retrieves the moderation queue, oldest first, optionally filtered by status
+func GetReports(status models.ReportStatus, limit int, cursor *models.Cursor) (*models.ReportQueue, error) {
+	condition, orderBy, cursorArgs, reversed := keyset("r", cursor, false)
+
+	statusCondition := "1 = 1"
+	var args []interface{}
+	if status != "" {
+		statusCondition = "r.status = ?"
+		args = append(args, status)
+	}
+
+	query := fmt.Sprintf(`SELECT `+reportColumns+`
+        FROM reports r
+        LEFT JOIN users ru ON r.reporter_id = ru.id
+        LEFT JOIN users tu ON r.target_user_id = tu.id
+        WHERE %s AND %s
+        ORDER BY %s
+        LIMIT ?
+    `, statusCondition, condition, orderBy)
+
+	args = append(append(args, cursorArgs...), limit+1)
+	rows, err := DB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get reports: %w", err)
+	}
+	defer rows.Close()
+
+	reports, err := scanReports(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	// Fetch one extra row to know whether another page exists, instead of counting
+	hasExtra := len(reports) > limit
+	if hasExtra {
+		reports = reports[:limit]
+	}
+	if reversed {
+		slices.Reverse(reports)
+	}
+
+	var first, last *models.Cursor
+	if len(reports) > 0 {
+		first = cursorAt(reports[0].CreatedAt, reports[0].ID)
+		last = cursorAt(reports[len(reports)-1].CreatedAt, reports[len(reports)-1].ID)
+	}
+
+	return &models.ReportQueue{
+		Reports:  reports,
+		PageInfo: buildPageInfo(cursor, first, last, len(reports), hasExtra),
+	}, nil
+}
+
+// UpdateReportStatus moves a report to a new status and records the change in its audit trail
+func UpdateReportStatus(reportID, actorID string, update *models.ReportStatusUpdate) (*models.Report, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var current models.ReportStatus
+	err = tx.QueryRow("SELECT status FROM reports WHERE id = ?", reportID).Scan(&current)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("report not found")
+		}
+		return nil, fmt.Errorf("failed to get report status: %w", err)
+	}
+
+	if !current.CanTransitionTo(update.Status) {
+		return nil, fmt.Errorf("invalid transition: report is %s and cannot become %s", current, update.Status)
+	}
+
+	now := time.Now()
+	_, err = tx.Exec("UPDATE reports SET status = ?, updated_at = ? WHERE id = ?", update.Status, now, reportID)
+	if err != nil {
+		// The reporter filed a new report on the same content after this one was closed
+		if isUniqueViolation(err) {
+			return nil, fmt.Errorf("report already open for this content")
+		}
+		return nil, fmt.Errorf("failed to update report: %w", err)
+	}
+
+	if err := insertReportAction(tx, reportID, actorID, current, update.Status, update.Note, now); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit report update: %w", err)
+	}
+
+	return GetReportByID(reportID)
+}
+
+// insertReportAction records a status change in a report's audit trail
+func insertReportAction(tx *sql.Tx, reportID, actorID string, from, to models.ReportStatus, note string, createdAt time.Time) error {
+	query := `
+        INSERT INTO report_actions (id, report_id, actor_id, from_status, to_status, note, created_at)
+        VALUES (?, ?, ?, ?, ?, ?, ?)
+    `
+
+	_, err := tx.Exec(query, uuid.New().String(), reportID, actorID, from, to, note, createdAt)
+	if err != nil {
+		return fmt.Errorf("failed to record report action: %w", err)
+	}
+	return nil
+}
+
+// getReportActions retrieves a report's audit trail, oldest first
+func getReportActions(reportID string) ([]models.ReportAction, error) {
+	query := `
+        SELECT a.actor_id, COALESCE(u.nickname, ''), a.from_status, a.to_status, a.note, a.created_at
+        FROM report_actions a
+        LEFT JOIN users u ON a.actor_id = u.id
+        WHERE a.report_id = ?
+        ORDER BY a.created_at ASC, a.rowid ASC
+    `
+
+	rows, err := DB.Query(query, reportID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get report actions: %w", err)
+	}
+	defer rows.Close()
+
+	var actions []models.ReportAction
+	for rows.Next() {
+		var action models.ReportAction
+		err := rows.Scan(&action.ActorID, &action.ActorNickname, &action.FromStatus,
+			&action.ToStatus, &action.Note, &action.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan report action: %w", err)
+		}
+		actions = append(actions, action)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get report actions: %w", err)
+	}
+
+	return actions, nil
+}
+
+// scanReports scans rows selected with reportColumns
+func scanReports(rows *sql.Rows) ([]models.Report, error) {
+	reports := []models.Report{}
+	for rows.Next() {
+		var report models.Report
+		err := rows.Scan(
+			&report.ID, &report.ReporterID, &report.ReporterNickname, &report.TargetType, &report.TargetID,
+			&report.TargetUserID, &report.TargetNickname, &report.TargetContent, &report.Reason,
+			&report.Status, &report.CreatedAt, &report.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan report: %w", err)
+		}
+		reports = append(reports, report)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get reports: %w", err)
+	}
+	return reports, nil
+}
+
+// isUniqueViolation reports whether an error comes from a unique index,
+// here the one allowing a single open report per reporter and target
+func isUniqueViolation(err error) bool {
+	return strings.Contains(err.Error(), "UNIQUE constraint failed")
+}
@@ -0,0 +1,95 @@
+package database
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Tomlee-abila/real_time_forum/backend/internal/models"
+)
+
+func TestReportLifecycle(t *testing.T) {
+	useTestDB(t)
+	author := createTestUser(t, "author")
+	reporter := createTestUser(t, "reporter")
+	moderator := createTestUser(t, "moderator")
+	post := createTestPost(t, author.ID, "Title", "Body")
+
+	creation := &models.ReportCreation{TargetType: models.ReportTargetPost, TargetID: post.ID, Reason: "spam"}
+
+	if _, err := CreateReport(author.ID, creation); err == nil || !strings.Contains(err.Error(), "own content") {
+		t.Fatalf("reporting own post: err = %v", err)
+	}
+	if _, err := CreateReport(reporter.ID, &models.ReportCreation{TargetType: models.ReportTargetPost, TargetID: "missing", Reason: "spam"}); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Fatalf("reporting missing post: err = %v", err)
+	}
+
+	first, err := CreateReport(reporter.ID, creation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Status != models.ReportOpen || first.TargetUserID != author.ID || first.TargetContent != "Title\n\nBody" {
+		t.Fatalf("report = %+v", first)
+	}
+	if _, err := CreateReport(reporter.ID, creation); err == nil || !strings.Contains(err.Error(), "already open") {
+		t.Fatalf("second open report: err = %v", err)
+	}
+
+	steps := []struct {
+		name       string
+		reportID   func() string
+		status     models.ReportStatus
+		wantErr    string
+		wantStatus models.ReportStatus
+	}{
+		{"open cannot be reopened", func() string { return first.ID }, models.ReportOpen, "invalid transition", ""},
+		{"dismiss", func() string { return first.ID }, models.ReportDismissed, "", models.ReportDismissed},
+		{"resolved cannot change resolution", func() string { return first.ID }, models.ReportActioned, "invalid transition", ""},
+		{"reopen", func() string { return first.ID }, models.ReportOpen, "", models.ReportOpen},
+		{"action", func() string { return first.ID }, models.ReportActioned, "", models.ReportActioned},
+		{"unknown report", func() string { return "missing" }, models.ReportOpen, "report not found", ""},
+	}
+
+	for _, step := range steps {
+		report, err := UpdateReportStatus(step.reportID(), moderator.ID, &models.ReportStatusUpdate{Status: step.status, Note: step.name})
+		if step.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), step.wantErr) {
+				t.Fatalf("%s: err = %v, want %q", step.name, err, step.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		if report.Status != step.wantStatus {
+			t.Errorf("%s: status = %q, want %q", step.name, report.Status, step.wantStatus)
+		}
+	}
+
+	report, err := GetReportByID(first.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var trail []models.ReportStatus
+	for _, action := range report.Actions {
+		trail = append(trail, action.ToStatus)
+	}
+	want := []models.ReportStatus{models.ReportOpen, models.ReportDismissed, models.ReportOpen, models.ReportActioned}
+	if !slices.Equal(trail, want) {
+		t.Errorf("audit trail = %v, want %v", trail, want)
+	}
+
+	// Once the first report is closed the reporter may file another, and the
+	// first can then no longer be reopened alongside it
+	second, err := CreateReport(reporter.ID, creation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = UpdateReportStatus(first.ID, moderator.ID, &models.ReportStatusUpdate{Status: models.ReportOpen})
+	if err == nil || !strings.Contains(err.Error(), "already open") {
+		t.Fatalf("reopening beside %s: err = %v, want already open", second.ID, err)
+	}
+	if report, err := GetReportByID(first.ID); err != nil || report.Status != models.ReportActioned {
+		t.Errorf("first report = %+v, %v; want it left actioned", report, err)
+	}
+}
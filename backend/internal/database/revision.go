@@ -0,0 +1,274 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/Tomlee-abila/real_time_forum/backend/internal/models"
+	"github.com/google/uuid"
+)
+
+// Revision target types
+const (
+	revisionTargetPost    = "post"
+	revisionTargetComment = "comment"
+)
+
+// UpdatePost edits a post and stores its previous version as a revision. It
+// also returns the mentions the edit added, which are the ones to notify.
+func UpdatePost(postID, userID string, update *models.PostUpdate) (*models.Post, []models.Mention, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// First check if the post exists and belongs to the user
+	var ownerID, title, content string
+	var createdAt time.Time
+	var editedAt sql.NullTime
+	var locked bool
+	err = tx.QueryRow(
+		"SELECT user_id, title, content, created_at, edited_at, locked_at IS NOT NULL FROM posts WHERE id = ?", postID,
+	).Scan(&ownerID, &title, &content, &createdAt, &editedAt, &locked)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil, fmt.Errorf("post not found")
+		}
+		return nil, nil, fmt.Errorf("failed to check post ownership: %w", err)
+	}
+
+	if ownerID != userID {
+		return nil, nil, fmt.Errorf("unauthorized: you can only edit your own posts")
+	}
+	if locked {
+		return nil, nil, fmt.Errorf("post is locked")
+	}
+
+	// Only record a revision when something actually changed
+	if title != update.Title || content != update.Content {
+		now := time.Now()
+		if err := insertRevision(tx, revisionTargetPost, postID, title, content, versionTime(createdAt, editedAt), now, userID); err != nil {
+			return nil, nil, err
+		}
+
+		_, err = tx.Exec("UPDATE posts SET title = ?, content = ?, edited_at = ? WHERE id = ?",
+			update.Title, update.Content, now, postID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to update post: %w", err)
+		}
+	}
+
+	mentions, err := syncMentions(tx, postMentionTarget(postID, userID, ""), update.Content, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, nil, fmt.Errorf("failed to commit post update: %w", err)
+	}
+
+	post, err := GetPostByID(postID)
+	if err != nil {
+		return nil, nil, err
+	}
+	posts := []models.Post{*post}
+	if err := attachPostReactions(posts, userID); err != nil {
+		return nil, nil, err
+	}
+
+	for i := range mentions {
+		mentions[i].AuthorNickname = post.UserNickname
+	}
+
+	return &posts[0], mentions, nil
+}
+
+// UpdateComment edits a comment and stores its previous version as a revision.
+// It also returns the mentions the edit added, which are the ones to notify.
+func UpdateComment(postID, commentID, userID string, update *models.CommentUpdate) (*models.Comment, []models.Mention, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// First check if the comment exists and belongs to the user
+	var ownerID, content string
+	var createdAt time.Time
+	var editedAt sql.NullTime
+	var locked bool
+	err = tx.QueryRow(`
+        SELECT c.user_id, c.content, c.created_at, c.edited_at, p.locked_at IS NOT NULL
+        FROM comments c
+        JOIN posts p ON c.post_id = p.id
+        WHERE c.id = ? AND c.post_id = ?
+    `, commentID, postID).Scan(&ownerID, &content, &createdAt, &editedAt, &locked)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil, fmt.Errorf("comment not found")
+		}
+		return nil, nil, fmt.Errorf("failed to check comment ownership: %w", err)
+	}
+
+	if ownerID != userID {
+		return nil, nil, fmt.Errorf("unauthorized: you can only edit your own comments")
+	}
+	if locked {
+		return nil, nil, fmt.Errorf("post is locked")
+	}
+
+	// Only record a revision when something actually changed
+	if content != update.Content {
+		now := time.Now()
+		if err := insertRevision(tx, revisionTargetComment, commentID, "", content, versionTime(createdAt, editedAt), now, userID); err != nil {
+			return nil, nil, err
+		}
+
+		_, err = tx.Exec("UPDATE comments SET content = ?, edited_at = ? WHERE id = ?",
+			update.Content, now, commentID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to update comment: %w", err)
+		}
+	}
+
+	mentions, err := syncMentions(tx, commentMentionTarget(postID, commentID, userID, ""), update.Content, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, nil, fmt.Errorf("failed to commit comment update: %w", err)
+	}
+
+	comment, err := GetCommentByID(commentID)
+	if err != nil {
+		return nil, nil, err
+	}
+	comments := []models.Comment{*comment}
+	if err := attachCommentReactions(comments, userID); err != nil {
+		return nil, nil, err
+	}
+
+	for i := range mentions {
+		mentions[i].AuthorNickname = comment.UserNickname
+	}
+
+	return &comments[0], mentions, nil
+}
+
+// GetPostRevisions lists every version of a post, oldest first, with diffs
+// between consecutive versions
+func GetPostRevisions(postID string) ([]models.Revision, error) {
+	post, err := GetPostByID(postID)
+	if err != nil {
+		return nil, err
+	}
+
+	current := models.Revision{
+		Title:     post.Title,
+		Content:   post.Content,
+		CreatedAt: versionTime(post.CreatedAt, nullTime(post.EditedAt)),
+	}
+	return getRevisions(revisionTargetPost, postID, current)
+}
+
+// GetCommentRevisions lists every version of a comment, oldest first, with
+// diffs between consecutive versions
+func GetCommentRevisions(postID, commentID string) ([]models.Revision, error) {
+	comment, err := GetCommentByID(commentID)
+	if err != nil || comment.PostID != postID {
+		return nil, fmt.Errorf("comment not found")
+	}
+
+	current := models.Revision{
+		Content:   comment.Content,
+		CreatedAt: versionTime(comment.CreatedAt, nullTime(comment.EditedAt)),
+	}
+	return getRevisions(revisionTargetComment, commentID, current)
+}
+
+// getRevisions loads the stored revisions of a target, appends its current
+// version and fills in version numbers and diffs
+func getRevisions(targetType, targetID string, current models.Revision) ([]models.Revision, error) {
+	query := `
+        SELECT title, content, created_at, replaced_by
+        FROM revisions
+        WHERE target_type = ? AND target_id = ?
+        ORDER BY created_at ASC, replaced_at ASC
+    `
+
+	rows, err := DB.Query(query, targetType, targetID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get revisions: %w", err)
+	}
+	defer rows.Close()
+
+	var revisions []models.Revision
+	for rows.Next() {
+		var revision models.Revision
+		if err := rows.Scan(&revision.Title, &revision.Content, &revision.CreatedAt, &revision.ReplacedBy); err != nil {
+			return nil, fmt.Errorf("failed to scan revision: %w", err)
+		}
+		revisions = append(revisions, revision)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get revisions: %w", err)
+	}
+	revisions = append(revisions, current)
+
+	for i := range revisions {
+		revisions[i].Version = i + 1
+		if i == 0 {
+			continue
+		}
+		previous := revisions[i-1]
+		if previous.Title != revisions[i].Title {
+			revisions[i].TitleDiff = models.DiffLines(previous.Title, revisions[i].Title)
+		}
+		if previous.Content != revisions[i].Content {
+			revisions[i].ContentDiff = models.DiffLines(previous.Content, revisions[i].Content)
+		}
+	}
+
+	return revisions, nil
+}
+
+// insertRevision stores a replaced version of a post or comment
+func insertRevision(tx *sql.Tx, targetType, targetID, title, content string, createdAt, replacedAt time.Time, replacedBy string) error {
+	query := `
+        INSERT INTO revisions (id, target_type, target_id, title, content, created_at, replaced_at, replaced_by)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+    `
+
+	_, err := tx.Exec(query, uuid.New().String(), targetType, targetID, title, content, createdAt, replacedAt, replacedBy)
+	if err != nil {
+		return fmt.Errorf("failed to store revision: %w", err)
+	}
+	return nil
+}
+
+// versionTime returns when the current version of a post or comment was written
+func versionTime(createdAt time.Time, editedAt sql.NullTime) time.Time {
+	if editedAt.Valid {
+		return editedAt.Time
+	}
+	return createdAt
+}
+
+// timePtr converts a nullable timestamp into an optional one
+func timePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+// nullTime converts an optional timestamp into a nullable one
+func nullTime(t *time.Time) sql.NullTime {
+	if t == nil {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: *t, Valid: true}
+}
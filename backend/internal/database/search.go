@@ -0,0 +1,518 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"html"
+	"log"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Tomlee-abila/real_time_forum/backend/internal/models"
+)
+
+// Snippet markers, swapped for <mark> tags once the snippet is escaped
+const (
+	snippetOpen  = "\x02"
+	snippetClose = "\x03"
+)
+
+// CheckFTS5 reports whether the SQLite driver was built with FTS5, which the
+// search index needs
+func CheckFTS5(db *sql.DB) error {
+	var enabled bool
+	if err := db.QueryRow("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&enabled); err != nil {
+		return fmt.Errorf("failed to check SQLite compile options: %w", err)
+	}
+	if !enabled {
+		return fmt.Errorf("SQLite was built without FTS5, build with make (see Makefile) or go build -tags sqlite_fts5")
+	}
+	return nil
+}
+
+// searchIndexEnabled is set when search uses the FTS5 index rather than LIKE matching
+var searchIndexEnabled bool
+
+// searchIndexTriggers keep the FTS5 tables in sync with the searched tables
+var searchIndexTriggers = []string{
+	"posts_fts_insert", "posts_fts_delete", "posts_fts_update",
+	"comments_fts_insert", "comments_fts_delete", "comments_fts_update",
+	"messages_fts_insert", "messages_fts_delete", "messages_fts_update",
+}
+
+// searchIndexSchema creates the FTS5 tables over posts, comments and messages
+// and the triggers named in searchIndexTriggers
+const searchIndexSchema = `
+    CREATE VIRTUAL TABLE IF NOT EXISTS posts_fts USING fts5(
+        title,
+        content,
+        content = 'posts',
+        content_rowid = 'rowid'
+    );
+
+    CREATE VIRTUAL TABLE IF NOT EXISTS comments_fts USING fts5(
+        content,
+        content = 'comments',
+        content_rowid = 'rowid'
+    );
+
+    CREATE VIRTUAL TABLE IF NOT EXISTS messages_fts USING fts5(
+        content,
+        content = 'messages',
+        content_rowid = 'rowid'
+    );
+
+    CREATE TRIGGER IF NOT EXISTS posts_fts_insert AFTER INSERT ON posts BEGIN
+        INSERT INTO posts_fts (rowid, title, content) VALUES (new.rowid, new.title, new.content);
+    END;
+
+    CREATE TRIGGER IF NOT EXISTS posts_fts_delete AFTER DELETE ON posts BEGIN
+        INSERT INTO posts_fts (posts_fts, rowid, title, content) VALUES ('delete', old.rowid, old.title, old.content);
+    END;
+
+    CREATE TRIGGER IF NOT EXISTS posts_fts_update AFTER UPDATE OF title, content ON posts BEGIN
+        INSERT INTO posts_fts (posts_fts, rowid, title, content) VALUES ('delete', old.rowid, old.title, old.content);
+        INSERT INTO posts_fts (rowid, title, content) VALUES (new.rowid, new.title, new.content);
+    END;
+
+    CREATE TRIGGER IF NOT EXISTS comments_fts_insert AFTER INSERT ON comments BEGIN
+        INSERT INTO comments_fts (rowid, content) VALUES (new.rowid, new.content);
+    END;
+
+    CREATE TRIGGER IF NOT EXISTS comments_fts_delete AFTER DELETE ON comments BEGIN
+        INSERT INTO comments_fts (comments_fts, rowid, content) VALUES ('delete', old.rowid, old.content);
+    END;
+
+    CREATE TRIGGER IF NOT EXISTS comments_fts_update AFTER UPDATE OF content ON comments BEGIN
+        INSERT INTO comments_fts (comments_fts, rowid, content) VALUES ('delete', old.rowid, old.content);
+        INSERT INTO comments_fts (rowid, content) VALUES (new.rowid, new.content);
+    END;
+
+    CREATE TRIGGER IF NOT EXISTS messages_fts_insert AFTER INSERT ON messages BEGIN
+        INSERT INTO messages_fts (rowid, content) VALUES (new.rowid, new.content);
+    END;
+
+    CREATE TRIGGER IF NOT EXISTS messages_fts_delete AFTER DELETE ON messages BEGIN
+        INSERT INTO messages_fts (messages_fts, rowid, content) VALUES ('delete', old.rowid, old.content);
+    END;
+
+    CREATE TRIGGER IF NOT EXISTS messages_fts_update AFTER UPDATE OF content ON messages BEGIN
+        INSERT INTO messages_fts (messages_fts, rowid, content) VALUES ('delete', old.rowid, old.content);
+        INSERT INTO messages_fts (rowid, content) VALUES (new.rowid, new.content);
+    END;
+`
+
+// setupSearchIndex creates the FTS5 search index, rebuilding it when its
+// triggers were missing. Without FTS5 it logs a warning, drops the triggers,
+// which would otherwise fail every write, and search falls back to LIKE matching.
+func setupSearchIndex(db *sql.DB) error {
+	if err := CheckFTS5(db); err != nil {
+		log.Printf("Warning: %v; search falls back to slower LIKE matching", err)
+		searchIndexEnabled = false
+		for _, trigger := range searchIndexTriggers {
+			if _, err := db.Exec("DROP TRIGGER IF EXISTS " + trigger); err != nil {
+				return fmt.Errorf("failed to drop search index trigger: %w", err)
+			}
+		}
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	args := make([]interface{}, len(searchIndexTriggers))
+	for i, trigger := range searchIndexTriggers {
+		args[i] = trigger
+	}
+	var existing int
+	err = tx.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name IN ("+
+		queryPlaceholders(len(args))+")", args...).Scan(&existing)
+	if err != nil {
+		return fmt.Errorf("failed to check search index triggers: %w", err)
+	}
+
+	if _, err := tx.Exec(searchIndexSchema); err != nil {
+		return fmt.Errorf("failed to create search index: %w", err)
+	}
+
+	// Rows written while the triggers were missing are not in the index yet
+	if existing < len(searchIndexTriggers) {
+		for _, index := range []string{"posts_fts", "comments_fts", "messages_fts"} {
+			if _, err := tx.Exec("INSERT INTO " + index + " (" + index + ") VALUES ('rebuild')"); err != nil {
+				return fmt.Errorf("failed to rebuild search index: %w", err)
+			}
+		}
+		log.Println("Search index rebuilt")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit search index: %w", err)
+	}
+	searchIndexEnabled = true
+	return nil
+}
+
+// postCategoriesColumn selects a post's categories as a comma-separated list
+const postCategoriesColumn = `(
+                SELECT COALESCE(group_concat(tag, ','), '') FROM (
+                    SELECT tag FROM post_tags WHERE post_id = p.id AND kind = 'category' ORDER BY position
+                )
+            )`
+
+// Search runs a ranked full-text search. Messages are only searched within
+// the viewer's own conversations.
+func Search(query *models.SearchQuery, viewerID string) ([]models.SearchResult, error) {
+	terms := searchTerms(query.Query)
+	if len(terms) == 0 {
+		return []models.SearchResult{}, nil
+	}
+
+	var results []models.SearchResult
+	if query.Scope == models.SearchScopeAll || query.Scope == models.SearchScopePosts {
+		posts, err := searchPosts(terms, query)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, normalizeScores(posts)...)
+	}
+	if query.Scope == models.SearchScopeAll || query.Scope == models.SearchScopeComments {
+		comments, err := searchComments(terms, query)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, normalizeScores(comments)...)
+	}
+	// Messages have no category, so a category filter excludes them
+	if (query.Scope == models.SearchScopeAll || query.Scope == models.SearchScopeMessages) &&
+		viewerID != "" && query.Category == "" {
+		messages, err := searchMessages(terms, query, viewerID)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, normalizeScores(messages)...)
+	}
+
+	// Newest first among equal scores, which is every result without the index
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].CreatedAt.After(results[j].CreatedAt)
+	})
+	if len(results) > query.Limit {
+		results = results[:query.Limit]
+	}
+	if results == nil {
+		results = []models.SearchResult{}
+	}
+
+	return results, nil
+}
+
+// normalizeScores scales one kind's scores so its best result scores 1. bm25
+// scores from different indexes are not comparable, but their share of the
+// best score in each index is.
+func normalizeScores(results []models.SearchResult) []models.SearchResult {
+	var best float64
+	for _, result := range results {
+		best = max(best, result.Score)
+	}
+	if best <= 0 {
+		return results
+	}
+	for i := range results {
+		results[i].Score /= best
+	}
+	return results
+}
+
+// textMatch is the part of a search query that matches the search terms
+// against one table, through its FTS5 index or with LIKE when there is none
+type textMatch struct {
+	from       string // the searched table, aliased, joined to its index
+	snippet    string // selects the snippet
+	score      string // selects the relevance score
+	where      string
+	orderBy    string
+	selectArgs []interface{}
+	whereArgs  []interface{}
+}
+
+// newTextMatch matches terms against columns of table. snippetColumn is the
+// FTS5 column snippets are taken from, -1 for the best matching one; without
+// the index they come from all the columns joined by newlines. weights are the
+// bm25 column weights.
+func newTextMatch(table, alias string, columns []string, snippetColumn int, weights string, terms []string) textMatch {
+	if searchIndexEnabled {
+		index := table + "_fts"
+		rank := "bm25(" + index + weights + ")"
+		return textMatch{
+			from:       fmt.Sprintf("%s JOIN %s %s ON %s.rowid = %s.rowid", index, table, alias, alias, index),
+			snippet:    fmt.Sprintf("snippet(%s, %d, ?, ?, '…', 16)", index, snippetColumn),
+			score:      "-" + rank,
+			where:      index + " MATCH ?",
+			orderBy:    rank,
+			selectArgs: []interface{}{snippetOpen, snippetClose},
+			whereArgs:  []interface{}{ftsMatchQuery(terms)},
+		}
+	}
+
+	// Every term must appear in one of the columns
+	var conditions, snippet []string
+	var args []interface{}
+	for _, column := range columns {
+		snippet = append(snippet, alias+"."+column)
+	}
+	for _, term := range terms {
+		var any []string
+		for _, column := range columns {
+			any = append(any, alias+"."+column+` LIKE ? ESCAPE '\'`)
+			args = append(args, "%"+likeEscaper.Replace(term)+"%")
+		}
+		conditions = append(conditions, "("+strings.Join(any, " OR ")+")")
+	}
+	return textMatch{
+		from:      table + " " + alias,
+		snippet:   strings.Join(snippet, " || char(10) || "),
+		score:     "0",
+		where:     strings.Join(conditions, " AND "),
+		orderBy:   alias + ".created_at DESC, " + alias + ".id DESC",
+		whereArgs: args,
+	}
+}
+
+// likeEscaper escapes the LIKE wildcards in a search term
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// searchPosts searches post titles and content
+func searchPosts(terms []string, query *models.SearchQuery) ([]models.SearchResult, error) {
+	match := newTextMatch("posts", "p", []string{"title", "content"}, -1, ", 5.0, 1.0", terms)
+	filter, args := searchFilters(query, "p")
+	sqlQuery := `
+        SELECT
+            p.id, p.id, p.title, ` + postCategoriesColumn + `, p.user_id, u.nickname, '', '', p.created_at,
+            ` + match.snippet + `, ` + match.score + `
+        FROM ` + match.from + `
+        LEFT JOIN users u ON p.user_id = u.id
+        WHERE ` + match.where + filter + `
+        ORDER BY ` + match.orderBy + `
+        LIMIT ?
+    `
+
+	queryArgs := append(match.selectArgs, match.whereArgs...)
+	queryArgs = append(queryArgs, args...)
+	queryArgs = append(queryArgs, query.Limit)
+	return querySearchResults("post", sqlQuery, queryArgs, terms)
+}
+
+// searchComments searches comment content
+func searchComments(terms []string, query *models.SearchQuery) ([]models.SearchResult, error) {
+	match := newTextMatch("comments", "c", []string{"content"}, 0, "", terms)
+	filter, args := searchFilters(query, "c")
+	sqlQuery := `
+        SELECT
+            c.id, c.post_id, p.title, ` + postCategoriesColumn + `, c.user_id, u.nickname, '', '', c.created_at,
+            ` + match.snippet + `, ` + match.score + `
+        FROM ` + match.from + `
+        JOIN posts p ON c.post_id = p.id
+        LEFT JOIN users u ON c.user_id = u.id
+        WHERE ` + match.where + filter + `
+        ORDER BY ` + match.orderBy + `
+        LIMIT ?
+    `
+
+	queryArgs := append(match.selectArgs, match.whereArgs...)
+	queryArgs = append(queryArgs, args...)
+	queryArgs = append(queryArgs, query.Limit)
+	return querySearchResults("comment", sqlQuery, queryArgs, terms)
+}
+
+// searchMessages searches the content of messages in the viewer's conversations.
+// Direct conversations with users on either side of a block are left out, as
+// they are from the conversation list.
+func searchMessages(terms []string, query *models.SearchQuery, viewerID string) ([]models.SearchResult, error) {
+	match := newTextMatch("messages", "m", []string{"content"}, 0, "", terms)
+	filter, args := searchFilters(query, "m")
+	sqlQuery := `
+        SELECT
+            m.id, '', '', '', m.sender_id, u.nickname, COALESCE(r.user_id, ''), m.conversation_id, m.created_at,
+            ` + match.snippet + `, ` + match.score + `
+        FROM ` + match.from + `
+        JOIN conversation_members me ON me.conversation_id = m.conversation_id AND me.user_id = ?
+        JOIN conversations c ON m.conversation_id = c.id
+        LEFT JOIN conversation_members r ON c.kind = 'direct' AND r.conversation_id = m.conversation_id AND r.user_id != m.sender_id
+        LEFT JOIN conversation_members peer ON c.kind = 'direct' AND peer.conversation_id = c.id AND peer.user_id != me.user_id
+        LEFT JOIN users u ON m.sender_id = u.id
+        WHERE ` + match.where + `
+          AND ` + notHiddenCondition + `
+          AND NOT (c.kind = 'direct' AND ` + fmt.Sprintf(blockedBetweenCondition, "me.user_id", "peer.user_id", "peer.user_id", "me.user_id") + `)` + filter + `
+        ORDER BY ` + match.orderBy + `
+        LIMIT ?
+    `
+
+	queryArgs := append(match.selectArgs, viewerID)
+	queryArgs = append(queryArgs, match.whereArgs...)
+	queryArgs = append(queryArgs, viewerID)
+	queryArgs = append(queryArgs, args...)
+	queryArgs = append(queryArgs, query.Limit)
+	return querySearchResults("message", sqlQuery, queryArgs, terms)
+}
+
+// searchFilters builds the category, author and date conditions shared by
+// every scope. alias is the searched table; posts are always aliased p and
+// authors u.
+func searchFilters(query *models.SearchQuery, alias string) (string, []interface{}) {
+	var filter strings.Builder
+	var args []interface{}
+
+	if query.Category != "" {
+		filter.WriteString(" AND p.id IN (SELECT post_id FROM post_tags WHERE kind = 'category' AND tag = ?)")
+		args = append(args, strings.ToLower(query.Category))
+	}
+	if query.Author != "" {
+		filter.WriteString(" AND u.nickname = ? COLLATE NOCASE")
+		args = append(args, query.Author)
+	}
+	// Timestamps are stored as local time text, so compare in the same zone
+	if query.From != nil {
+		filter.WriteString(" AND " + alias + ".created_at >= ?")
+		args = append(args, query.From.Local())
+	}
+	if query.To != nil {
+		filter.WriteString(" AND " + alias + ".created_at < ?")
+		args = append(args, query.To.Local())
+	}
+
+	return filter.String(), args
+}
+
+// querySearchResults runs a search query and scans its rows. Without the
+// search index the snippet column holds the whole text, which is cut down here.
+func querySearchResults(resultType, query string, args []interface{}, terms []string) ([]models.SearchResult, error) {
+	rows, err := DB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search %ss: %w", resultType, err)
+	}
+	defer rows.Close()
+
+	var results []models.SearchResult
+	for rows.Next() {
+		result := models.SearchResult{Type: resultType}
+		var nickname sql.NullString
+		var categories string
+		err := rows.Scan(
+			&result.ID, &result.PostID, &result.Title, &categories, &result.UserID, &nickname,
+			&result.ReceiverID, &result.ConversationID, &result.CreatedAt, &result.Snippet, &result.Score,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan search result: %w", err)
+		}
+		result.UserNickname = nickname.String
+		if categories != "" {
+			result.Categories = strings.Split(categories, ",")
+		}
+		if !searchIndexEnabled {
+			result.Snippet = likeSnippet(result.Snippet, terms)
+		}
+		result.Snippet = highlightSnippet(result.Snippet)
+		results = append(results, result)
+	}
+
+	return results, rows.Err()
+}
+
+// searchTerms splits free text into search terms, skipping words with nothing
+// the FTS5 tokenizer would index
+func searchTerms(text string) []string {
+	var terms []string
+	for _, word := range strings.Fields(text) {
+		if strings.ContainsFunc(word, isWordRune) {
+			terms = append(terms, word)
+		}
+	}
+	return terms
+}
+
+// ftsMatchQuery turns search terms into an FTS5 query that matches every term
+// as a prefix, quoting each so user input cannot inject FTS5 syntax
+func ftsMatchQuery(terms []string) string {
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"*`
+	}
+	return strings.Join(quoted, " ")
+}
+
+// isWordRune reports whether r is indexed by the default FTS5 tokenizer
+func isWordRune(r rune) bool {
+	return r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r > 127
+}
+
+// Length of a snippet cut without the search index, in bytes either side of the first match
+const likeSnippetContext = 60
+
+// likeSnippet cuts text down to the surroundings of the first matching term and
+// marks every match, the way snippet() does with the search index
+func likeSnippet(text string, terms []string) string {
+	lower := strings.ToLower(text)
+
+	type span struct{ start, end int }
+	var spans []span
+	for _, term := range terms {
+		term = strings.ToLower(term)
+		for offset := 0; ; {
+			i := strings.Index(lower[offset:], term)
+			if i < 0 {
+				break
+			}
+			spans = append(spans, span{offset + i, offset + i + len(term)})
+			offset += i + len(term)
+		}
+	}
+	// ToLower can change byte lengths outside ASCII, so offsets only fit the original when lengths match
+	if len(spans) == 0 || len(lower) != len(text) {
+		return text[:snippetBoundary(text, min(len(text), 2*likeSnippetContext))]
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+
+	from := snippetBoundary(text, max(0, spans[0].start-likeSnippetContext))
+	to := snippetBoundary(text, min(len(text), spans[0].end+likeSnippetContext))
+
+	var snippet strings.Builder
+	if from > 0 {
+		snippet.WriteString("…")
+	}
+	position := from
+	for _, match := range spans {
+		if match.start < position || match.end > to {
+			continue
+		}
+		snippet.WriteString(text[position:match.start])
+		snippet.WriteString(snippetOpen + text[match.start:match.end] + snippetClose)
+		position = match.end
+	}
+	snippet.WriteString(text[position:to])
+	if to < len(text) {
+		snippet.WriteString("…")
+	}
+	return snippet.String()
+}
+
+// snippetBoundary moves a byte offset back to the start of a UTF-8 character
+func snippetBoundary(text string, offset int) int {
+	for offset > 0 && offset < len(text) && !utf8.RuneStart(text[offset]) {
+		offset--
+	}
+	return offset
+}
+
+// highlightSnippet escapes a snippet and wraps its matches in <mark> tags
+func highlightSnippet(snippet string) string {
+	escaped := html.EscapeString(snippet)
+	escaped = strings.ReplaceAll(escaped, snippetOpen, "<mark>")
+	return strings.ReplaceAll(escaped, snippetClose, "</mark>")
+}
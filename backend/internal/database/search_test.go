@@ -0,0 +1,250 @@
+package database
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Tomlee-abila/real_time_forum/backend/internal/models"
+)
+
+// searchModes runs fn with LIKE matching and, when the driver has FTS5, with the index
+func searchModes(t *testing.T, fn func(t *testing.T)) {
+	t.Run("like", func(t *testing.T) {
+		enabled := searchIndexEnabled
+		searchIndexEnabled = false
+		defer func() { searchIndexEnabled = enabled }()
+		fn(t)
+	})
+	if searchIndexEnabled {
+		t.Run("fts5", fn)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	useTestDB(t)
+	alice := createTestUser(t, "alice")
+	bob := createTestUser(t, "bob")
+	carol := createTestUser(t, "carol")
+
+	post := createTestPost(t, alice.ID, "Gardening tips", "Tomatoes need plenty of sun and water.")
+	createTestPost(t, bob.ID, "Cooking", "A sauce made from tomatoes, 100% fresh.")
+	if _, err := CreateComment(bob.ID, post.ID, &models.CommentCreation{Content: "Mine grew well in the shade"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CreateMessage(alice.ID, &models.MessageCreation{ReceiverID: bob.ID, Content: "secret tomatoes recipe", Format: models.MessageFormatPlain}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		query     string
+		scope     string
+		viewerID  string
+		wantTypes []string
+	}{
+		{"matches posts and messages", "tomatoes", models.SearchScopeAll, bob.ID, []string{"message", "post", "post"}},
+		{"every term must match", "tomatoes sun", models.SearchScopeAll, bob.ID, []string{"post"}},
+		{"case insensitive", "GARDENING", models.SearchScopeAll, "", []string{"post"}},
+		{"comments", "shade", models.SearchScopeComments, "", []string{"comment"}},
+		{"messages only for members", "recipe", models.SearchScopeAll, carol.ID, nil},
+		{"messages without a viewer", "recipe", models.SearchScopeAll, "", nil},
+		{"messages scope", "recipe", models.SearchScopeMessages, alice.ID, []string{"message"}},
+		{"punctuation only", "%% --", models.SearchScopeAll, bob.ID, nil},
+		{"no match", "cucumber", models.SearchScopeAll, bob.ID, nil},
+	}
+
+	searchModes(t, func(t *testing.T) {
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				results, err := Search(&models.SearchQuery{Query: tt.query, Scope: tt.scope, Limit: 10}, tt.viewerID)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				var types []string
+				for _, result := range results {
+					types = append(types, result.Type)
+					if !strings.Contains(result.Snippet, "<mark>") {
+						t.Errorf("snippet %q has no highlighted match", result.Snippet)
+					}
+				}
+				if strings.Join(slices.Sorted(slices.Values(types)), ",") != strings.Join(tt.wantTypes, ",") {
+					t.Errorf("types = %v, want %v", types, tt.wantTypes)
+				}
+			})
+		}
+	})
+}
+
+func TestSearchExcludesBlockedConversations(t *testing.T) {
+	useTestDB(t)
+	alice := createTestUser(t, "alice")
+	bob := createTestUser(t, "bob")
+	carol := createTestUser(t, "carol")
+
+	for _, receiverID := range []string{bob.ID, carol.ID} {
+		message := &models.MessageCreation{ReceiverID: receiverID, Content: "meeting at noon", Format: models.MessageFormatPlain}
+		if _, err := CreateMessage(alice.ID, message); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := BlockUser(bob.ID, alice.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		viewerID string
+		want     int
+	}{
+		{"blocker", bob.ID, 0},
+		{"blocked", alice.ID, 1},
+		{"bystander", carol.ID, 1},
+	}
+
+	searchModes(t, func(t *testing.T) {
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				results, err := Search(&models.SearchQuery{Query: "meeting", Scope: models.SearchScopeMessages, Limit: 10}, tt.viewerID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(results) != tt.want {
+					t.Errorf("got %d results, want %d", len(results), tt.want)
+				}
+				for _, result := range results {
+					if result.ReceiverID == bob.ID || result.UserID == bob.ID {
+						t.Errorf("result from the blocked conversation: %+v", result)
+					}
+				}
+			})
+		}
+	})
+}
+
+func TestNormalizeScores(t *testing.T) {
+	tests := []struct {
+		name   string
+		scores []float64
+		want   []float64
+	}{
+		{"scaled to the best", []float64{8, 4, 2}, []float64{1, 0.5, 0.25}},
+		{"single", []float64{0.003}, []float64{1}},
+		{"unranked", []float64{0, 0}, []float64{0, 0}},
+		{"empty", nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var results []models.SearchResult
+			for _, score := range tt.scores {
+				results = append(results, models.SearchResult{Score: score})
+			}
+
+			var got []float64
+			for _, result := range normalizeScores(results) {
+				got = append(got, result.Score)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("scores = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchRanksKindsOnTheSameScale(t *testing.T) {
+	useTestDB(t)
+	if !searchIndexEnabled {
+		t.Skip("ranking needs the FTS5 index")
+	}
+	alice := createTestUser(t, "alice")
+	post := createTestPost(t, alice.ID, "Kettles", "kettle kettle kettle, everything about the kettle")
+	if _, err := CreateComment(alice.ID, post.ID, &models.CommentCreation{Content: "my kettle broke"}); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := Search(&models.SearchQuery{Query: "kettle", Scope: models.SearchScopeAll, Limit: 10}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("got %d results, want 2", len(results))
+	}
+	// Each is the best of its kind
+	for _, result := range results {
+		if result.Score != 1 {
+			t.Errorf("%s score = %v, want 1", result.Type, result.Score)
+		}
+	}
+}
+
+func TestSearchLikeEscapesWildcards(t *testing.T) {
+	useTestDB(t)
+	alice := createTestUser(t, "alice")
+	createTestPost(t, alice.ID, "Percentages", "Only 100% of the time.")
+	createTestPost(t, alice.ID, "Underscores", "snake_case names are common.")
+
+	enabled := searchIndexEnabled
+	searchIndexEnabled = false
+	defer func() { searchIndexEnabled = enabled }()
+
+	tests := []struct {
+		query string
+		want  int
+	}{
+		{"100%", 1},
+		{"snake_case", 1},
+		{"e_c", 1},
+		{"0%o", 0},
+	}
+
+	for _, tt := range tests {
+		results, err := Search(&models.SearchQuery{Query: tt.query, Scope: models.SearchScopePosts, Limit: 10}, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != tt.want {
+			t.Errorf("Search(%q) returned %d results, want %d", tt.query, len(results), tt.want)
+		}
+	}
+}
+
+func TestLikeSnippet(t *testing.T) {
+	long := strings.Repeat("word ", 40)
+
+	tests := []struct {
+		name  string
+		text  string
+		terms []string
+		want  string
+	}{
+		{"marks every match", "Go is fun, go go", []string{"go"}, "\x02Go\x03 is fun, \x02go\x03 \x02go\x03"},
+		{"several terms", "red and blue", []string{"blue", "red"}, "\x02red\x03 and \x02blue\x03"},
+		{"no match", "short text", []string{"zzz"}, "short text"},
+		{"cuts long text", long + "needle" + long, []string{"needle"}, "…" + long[len(long)-likeSnippetContext:] + "\x02needle\x03" + long[:likeSnippetContext] + "…"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := likeSnippet(tt.text, tt.terms); got != tt.want {
+				t.Errorf("likeSnippet(%q, %v)\n got: %q\nwant: %q", tt.text, tt.terms, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetupSearchIndexWithoutFTS5DropsTriggers(t *testing.T) {
+	useTestDB(t)
+	if searchIndexEnabled {
+		t.Skip("the driver has FTS5")
+	}
+
+	var triggers int
+	if err := DB.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name LIKE '%_fts_%'").Scan(&triggers); err != nil {
+		t.Fatal(err)
+	}
+	if triggers != 0 {
+		t.Errorf("%d search index triggers left without FTS5", triggers)
+	}
+}
@@ -0,0 +1,122 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/Tomlee-abila/real_time_forum/backend/internal/models"
+)
+
+// post_tags kinds
+const (
+	tagKindCategory = "category"
+	tagKindTag      = "tag"
+)
+
+// insertPostTags stores a new post's categories and tags in order
+func insertPostTags(tx *sql.Tx, postID string, categories, tags []string) error {
+	query := "INSERT INTO post_tags (post_id, kind, tag, position) VALUES (?, ?, ?, ?)"
+
+	for i, category := range categories {
+		if _, err := tx.Exec(query, postID, tagKindCategory, category, i); err != nil {
+			return fmt.Errorf("failed to add post category: %w", err)
+		}
+	}
+	for i, tag := range tags {
+		if _, err := tx.Exec(query, postID, tagKindTag, tag, i); err != nil {
+			return fmt.Errorf("failed to add post tag: %w", err)
+		}
+	}
+	return nil
+}
+
+// attachPostTags fills in the categories and tags of each post
+func attachPostTags(posts []models.Post) error {
+	if len(posts) == 0 {
+		return nil
+	}
+
+	args := make([]interface{}, len(posts))
+	for i := range posts {
+		args[i] = posts[i].ID
+	}
+
+	query := `
+        SELECT post_id, kind, tag
+        FROM post_tags
+        WHERE post_id IN (` + queryPlaceholders(len(args)) + `)
+        ORDER BY position ASC
+    `
+
+	rows, err := DB.Query(query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to get post tags: %w", err)
+	}
+	defer rows.Close()
+
+	categories := make(map[string][]string)
+	tags := make(map[string][]string)
+	for rows.Next() {
+		var postID, kind, tag string
+		if err := rows.Scan(&postID, &kind, &tag); err != nil {
+			return fmt.Errorf("failed to scan post tag: %w", err)
+		}
+		if kind == tagKindCategory {
+			categories[postID] = append(categories[postID], tag)
+		} else {
+			tags[postID] = append(tags[postID], tag)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to get post tags: %w", err)
+	}
+
+	for i := range posts {
+		posts[i].Categories = nonNil(categories[posts[i].ID])
+		posts[i].Tags = nonNil(tags[posts[i].ID])
+	}
+	return nil
+}
+
+// tagFilterCondition builds the condition selecting posts that match a tag
+// filter, for use in queryPosts
+func tagFilterCondition(filter *models.TagFilter) (string, []interface{}) {
+	var matches []string
+	var args []interface{}
+	if len(filter.Categories) > 0 {
+		matches = append(matches, "(kind = 'category' AND tag IN ("+queryPlaceholders(len(filter.Categories))+"))")
+		for _, category := range filter.Categories {
+			args = append(args, category)
+		}
+	}
+	if len(filter.Tags) > 0 {
+		matches = append(matches, "(kind = 'tag' AND tag IN ("+queryPlaceholders(len(filter.Tags))+"))")
+		for _, tag := range filter.Tags {
+			args = append(args, tag)
+		}
+	}
+	if len(matches) == 0 {
+		return "1 = 1", nil
+	}
+
+	condition := "p.id IN (SELECT post_id FROM post_tags WHERE " + strings.Join(matches, " OR ")
+	if filter.MatchAll {
+		condition += " GROUP BY post_id HAVING COUNT(*) = ?"
+		args = append(args, len(filter.Categories)+len(filter.Tags))
+	}
+	return condition + ")", args
+}
+
+// queryPlaceholders returns n comma-separated query placeholders
+func queryPlaceholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// nonNil returns an empty list instead of nil so it encodes as []
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
@@ -0,0 +1,164 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/Tomlee-abila/real_time_forum/backend/internal/markdown"
+	"github.com/Tomlee-abila/real_time_forum/backend/internal/models"
+)
+
+// commentColumns lists the columns scanned by scanComments
+const commentColumns = `
+            c.id, c.post_id, c.user_id, c.content, c.created_at, c.edited_at,
+            c.parent_id, c.depth, c.score, u.nickname`
+
+// scanComments scans rows selected with commentColumns
+func scanComments(rows *sql.Rows) ([]models.Comment, error) {
+	var comments []models.Comment
+	for rows.Next() {
+		var comment models.Comment
+		var parentID sql.NullString
+		var editedAt sql.NullTime
+		err := rows.Scan(
+			&comment.ID, &comment.PostID, &comment.UserID, &comment.Content, &comment.CreatedAt, &editedAt,
+			&parentID, &comment.Depth, &comment.Score, &comment.UserNickname,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan comment: %w", err)
+		}
+		comment.ParentID = parentID.String
+		comment.EditedAt = timePtr(editedAt)
+		comment.ContentHTML = markdown.Render(comment.Content)
+		comments = append(comments, comment)
+	}
+	return comments, rows.Err()
+}
+
+// GetCommentByID retrieves a single comment without its replies
+func GetCommentByID(commentID string) (*models.Comment, error) {
+	query := `SELECT ` + commentColumns + `
+        FROM comments c
+        LEFT JOIN users u ON c.user_id = u.id
+        WHERE c.id = ?
+    `
+
+	rows, err := DB.Query(query, commentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get comment: %w", err)
+	}
+	defer rows.Close()
+
+	comments, err := scanComments(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(comments) == 0 {
+		return nil, fmt.Errorf("comment not found")
+	}
+
+	return &comments[0], nil
+}
+
+// ResolveCommentParent checks that a reply's parent is on the same post and
+// sets the reply's depth so it can be validated
+func ResolveCommentParent(postID string, comment *models.CommentCreation) error {
+	if comment.ParentID == "" {
+		comment.Depth = 0
+		return nil
+	}
+
+	parent, err := GetCommentByID(comment.ParentID)
+	if err != nil || parent.PostID != postID {
+		return fmt.Errorf("parent comment not found")
+	}
+
+	comment.Depth = parent.Depth + 1
+	return nil
+}
+
+// GetCommentThread retrieves a comment with all of its nested replies,
+// including reactions as seen by the viewer
+func GetCommentThread(postID, commentID, viewerID string) (*models.Comment, error) {
+	comment, err := GetCommentByID(commentID)
+	if err != nil {
+		return nil, err
+	}
+	if comment.PostID != postID {
+		return nil, fmt.Errorf("comment not found")
+	}
+
+	replies, err := getCommentReplies([]string{comment.ID})
+	if err != nil {
+		return nil, err
+	}
+	attachReplies(comment, replies)
+
+	comments := []models.Comment{*comment}
+	if err := attachCommentReactions(comments, viewerID); err != nil {
+		return nil, err
+	}
+
+	return &comments[0], nil
+}
+
+// getCommentReplies loads every descendant of the given comments, grouped by parent ID
+func getCommentReplies(parentIDs []string) (map[string][]models.Comment, error) {
+	replies := make(map[string][]models.Comment)
+	if len(parentIDs) == 0 {
+		return replies, nil
+	}
+
+	placeholders := queryPlaceholders(len(parentIDs))
+	query := fmt.Sprintf(`
+        WITH RECURSIVE thread(id) AS (
+            SELECT id FROM comments WHERE parent_id IN (%s)
+            UNION ALL
+            SELECT c.id FROM comments c JOIN thread t ON c.parent_id = t.id
+        )
+        SELECT %s
+        FROM comments c
+        JOIN thread t ON c.id = t.id
+        LEFT JOIN users u ON c.user_id = u.id
+        ORDER BY c.created_at ASC, c.id ASC
+    `, placeholders, commentColumns)
+
+	args := make([]interface{}, len(parentIDs))
+	for i, id := range parentIDs {
+		args[i] = id
+	}
+
+	rows, err := DB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get replies: %w", err)
+	}
+	defer rows.Close()
+
+	comments, err := scanComments(rows)
+	if err != nil {
+		return nil, err
+	}
+	for _, comment := range comments {
+		replies[comment.ParentID] = append(replies[comment.ParentID], comment)
+	}
+
+	return replies, nil
+}
+
+// attachReplies nests the loaded replies under a comment, recursively
+func attachReplies(comment *models.Comment, replies map[string][]models.Comment) {
+	children := replies[comment.ID]
+	for i := range children {
+		attachReplies(&children[i], replies)
+	}
+	comment.Replies = children
+	comment.ReplyCount = len(children)
+}
+
+// nullIfEmpty stores an empty string as NULL
+func nullIfEmpty(value string) interface{} {
+	if value == "" {
+		return nil
+	}
+	return value
+}
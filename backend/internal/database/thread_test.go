@@ -0,0 +1,103 @@
+package database
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Tomlee-abila/real_time_forum/backend/internal/models"
+)
+
+// replyTo adds a comment to a post, as a reply when parentID is set
+func replyTo(t *testing.T, userID, postID, parentID, content string) *models.Comment {
+	t.Helper()
+
+	comment, err := CreateComment(userID, postID, &models.CommentCreation{Content: content, ParentID: parentID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return comment
+}
+
+func TestCommentThreads(t *testing.T) {
+	useTestDB(t)
+	alice := createTestUser(t, "alice")
+	bob := createTestUser(t, "bob")
+	post := createTestPost(t, alice.ID, "Thread", "Discuss")
+	otherPost := createTestPost(t, alice.ID, "Other", "Elsewhere")
+
+	root := replyTo(t, alice.ID, post.ID, "", "root")
+	reply := replyTo(t, bob.ID, post.ID, root.ID, "reply")
+	nested := replyTo(t, alice.ID, post.ID, reply.ID, "nested")
+	second := replyTo(t, bob.ID, post.ID, "", "second root")
+
+	if depths := []int{root.Depth, reply.Depth, nested.Depth}; depths[0] != 0 || depths[1] != 1 || depths[2] != 2 {
+		t.Errorf("depths = %v, want [0 1 2]", depths)
+	}
+	if _, err := CreateComment(bob.ID, otherPost.ID, &models.CommentCreation{Content: "x", ParentID: root.ID}); err == nil || !strings.Contains(err.Error(), "parent comment not found") {
+		t.Errorf("reply across posts: err = %v", err)
+	}
+
+	comments, _, err := GetCommentsByPostID(post.ID, "", 10, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(comments) != 2 || comments[0].ID != root.ID || comments[1].ID != second.ID {
+		t.Fatalf("top-level comments = %+v, want root then second", comments)
+	}
+	if comments[0].ReplyCount != 1 || len(comments[0].Replies) != 1 || comments[0].Replies[0].ID != reply.ID {
+		t.Fatalf("root replies = %+v", comments[0].Replies)
+	}
+	if got := comments[0].Replies[0].Replies; len(got) != 1 || got[0].ID != nested.ID {
+		t.Errorf("nested replies = %+v", got)
+	}
+	if comments[1].ReplyCount != 0 || len(comments[1].Replies) != 0 {
+		t.Errorf("second root replies = %+v", comments[1].Replies)
+	}
+
+	thread, err := GetCommentThread(post.ID, reply.ID, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(thread.Replies) != 1 || thread.Replies[0].ID != nested.ID {
+		t.Errorf("thread replies = %+v", thread.Replies)
+	}
+	if _, err := GetCommentThread(otherPost.ID, reply.ID, ""); err == nil || !strings.Contains(err.Error(), "comment not found") {
+		t.Errorf("thread under the wrong post: err = %v", err)
+	}
+
+	// Deleting a comment takes its replies with it
+	if err := DeleteComment(reply.ID, alice.ID, models.RoleUser); err == nil || !strings.Contains(err.Error(), "unauthorized") {
+		t.Fatalf("deleting someone else's comment: err = %v", err)
+	}
+	if err := DeleteComment(reply.ID, bob.ID, models.RoleUser); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{reply.ID, nested.ID} {
+		if _, err := GetCommentByID(id); err == nil {
+			t.Errorf("comment %s survived its parent's deletion", id)
+		}
+	}
+	if _, err := GetCommentByID(root.ID); err != nil {
+		t.Errorf("root was deleted with its reply: %v", err)
+	}
+}
+
+func TestCommentDepthLimit(t *testing.T) {
+	useTestDB(t)
+	alice := createTestUser(t, "alice")
+	post := createTestPost(t, alice.ID, "Deep", "Thread")
+
+	parent := replyTo(t, alice.ID, post.ID, "", "level 0")
+	for depth := 1; depth <= models.MaxCommentDepth; depth++ {
+		parent = replyTo(t, alice.ID, post.ID, parent.ID, "deeper")
+	}
+
+	// Handlers resolve the parent and validate before creating the reply
+	creation := &models.CommentCreation{Content: "too deep", ParentID: parent.ID}
+	if err := ResolveCommentParent(post.ID, creation); err != nil {
+		t.Fatal(err)
+	}
+	if err := creation.Validate(); err == nil {
+		t.Errorf("reply at depth %d was accepted", creation.Depth)
+	}
+}
@@ -3,6 +3,7 @@ package database
 import (
 	"database/sql"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/Tomlee-abila/real_time_forum/backend/internal/models"
@@ -21,15 +22,15 @@ func CreateUser(user *models.UserRegistration) (*models.User, error) {
 		return nil, fmt.Errorf("failed to hash password: %w", err)
 	}
 
-	// Insert user into database
+	// Insert user into database; new users always start with the user role
 	query := `
-        INSERT INTO users (id, nickname, age, gender, first_name, last_name, email, password, created_at)
-        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+        INSERT INTO users (id, nickname, age, gender, first_name, last_name, email, password, created_at, role)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
     `
 
 	createdAt := time.Now()
 	_, err = DB.Exec(query, userID, user.Nickname, user.Age, user.Gender,
-		user.FirstName, user.LastName, user.Email, string(hashedPassword), createdAt)
+		user.FirstName, user.LastName, user.Email, string(hashedPassword), createdAt, models.RoleUser)
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to create user: %w", err)
@@ -44,6 +45,7 @@ func CreateUser(user *models.UserRegistration) (*models.User, error) {
 		FirstName: user.FirstName,
 		LastName:  user.LastName,
 		Email:     user.Email,
+		Role:      models.RoleUser,
 		CreatedAt: createdAt,
 	}, nil
 }
@@ -51,14 +53,14 @@ func CreateUser(user *models.UserRegistration) (*models.User, error) {
 // GetUserByEmail retrieves a user by email
 func GetUserByEmail(email string) (*models.User, error) {
 	query := `
-        SELECT id, nickname, age, gender, first_name, last_name, email, password, created_at
+        SELECT id, nickname, age, gender, first_name, last_name, email, password, role, created_at
         FROM users WHERE email = ?
     `
 
 	var user models.User
 	err := DB.QueryRow(query, email).Scan(
 		&user.ID, &user.Nickname, &user.Age, &user.Gender,
-		&user.FirstName, &user.LastName, &user.Email, &user.Password, &user.CreatedAt,
+		&user.FirstName, &user.LastName, &user.Email, &user.Password, &user.Role, &user.CreatedAt,
 	)
 
 	if err != nil {
@@ -74,14 +76,14 @@ func GetUserByEmail(email string) (*models.User, error) {
 // GetUserByNickname retrieves a user by nickname
 func GetUserByNickname(nickname string) (*models.User, error) {
 	query := `
-        SELECT id, nickname, age, gender, first_name, last_name, email, password, created_at
+        SELECT id, nickname, age, gender, first_name, last_name, email, password, role, created_at
         FROM users WHERE nickname = ?
     `
 
 	var user models.User
 	err := DB.QueryRow(query, nickname).Scan(
 		&user.ID, &user.Nickname, &user.Age, &user.Gender,
-		&user.FirstName, &user.LastName, &user.Email, &user.Password, &user.CreatedAt,
+		&user.FirstName, &user.LastName, &user.Email, &user.Password, &user.Role, &user.CreatedAt,
 	)
 
 	if err != nil {
@@ -97,14 +99,14 @@ func GetUserByNickname(nickname string) (*models.User, error) {
 // GetUserByID retrieves a user by ID
 func GetUserByID(userID string) (*models.User, error) {
 	query := `
-        SELECT id, nickname, age, gender, first_name, last_name, email, created_at
+        SELECT id, nickname, age, gender, first_name, last_name, email, role, created_at
         FROM users WHERE id = ?
     `
 
 	var user models.User
 	err := DB.QueryRow(query, userID).Scan(
 		&user.ID, &user.Nickname, &user.Age, &user.Gender,
-		&user.FirstName, &user.LastName, &user.Email, &user.CreatedAt,
+		&user.FirstName, &user.LastName, &user.Email, &user.Role, &user.CreatedAt,
 	)
 
 	if err != nil {
@@ -166,6 +168,99 @@ func CheckNicknameExists(nickname string) (bool, error) {
 	return count > 0, nil
 }
 
+// GetUserRole returns a user's role
+func GetUserRole(userID string) (models.Role, error) {
+	var role models.Role
+	err := DB.QueryRow("SELECT role FROM users WHERE id = ?", userID).Scan(&role)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", fmt.Errorf("user not found")
+		}
+		return "", fmt.Errorf("failed to get user role: %w", err)
+	}
+	return role, nil
+}
+
+// SetUserRole changes a user's role. The last administrator cannot be demoted.
+func SetUserRole(userID string, role models.Role) error {
+	if _, err := GetUserRole(userID); err != nil {
+		return err
+	}
+
+	// The administrator count is checked by the UPDATE itself so that two
+	// concurrent demotions cannot both see another administrator left
+	query := `
+        UPDATE users SET role = ?
+        WHERE id = ?
+          AND (role != 'admin' OR ? = 'admin' OR (SELECT COUNT(*) FROM users WHERE role = 'admin') > 1)
+    `
+
+	result, err := DB.Exec(query, role, userID, role)
+	if err != nil {
+		return fmt.Errorf("failed to update user role: %w", err)
+	}
+	if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+		return fmt.Errorf("cannot demote the last administrator")
+	}
+	return nil
+}
+
+// PromoteToAdmin gives the admin role to the registered user with the given
+// nickname or email. It bootstraps the first administrator of an installation.
+func PromoteToAdmin(nicknameOrEmail string) (*models.User, error) {
+	var user *models.User
+	var err error
+	if strings.Contains(nicknameOrEmail, "@") {
+		user, err = GetUserByEmail(nicknameOrEmail)
+	} else {
+		user, err = GetUserByNickname(nicknameOrEmail)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if user.Role != models.RoleAdmin {
+		if err := SetUserRole(user.ID, models.RoleAdmin); err != nil {
+			return nil, err
+		}
+		user.Role = models.RoleAdmin
+	}
+
+	user.Password = ""
+	return user, nil
+}
+
+// GetUsersByRole lists users with their roles, optionally limited to one role
+func GetUsersByRole(role models.Role) ([]models.User, error) {
+	query := `
+        SELECT id, nickname, age, gender, first_name, last_name, email, role, created_at
+        FROM users
+        WHERE ? = '' OR role = ?
+        ORDER BY nickname ASC
+    `
+
+	rows, err := DB.Query(query, role, role)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get users: %w", err)
+	}
+	defer rows.Close()
+
+	users := []models.User{}
+	for rows.Next() {
+		var user models.User
+		err := rows.Scan(
+			&user.ID, &user.Nickname, &user.Age, &user.Gender,
+			&user.FirstName, &user.LastName, &user.Email, &user.Role, &user.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		users = append(users, user)
+	}
+
+	return users, rows.Err()
+}
+
 // GetTotalUserCount returns the total number of registered users
 func GetTotalUserCount() (int, error) {
 	query := "SELECT COUNT(*) FROM users"
@@ -0,0 +1,53 @@
+package database
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Tomlee-abila/real_time_forum/backend/internal/models"
+)
+
+func TestSetUserRole(t *testing.T) {
+	useTestDB(t)
+	alice := createTestUser(t, "alice")
+	bob := createTestUser(t, "bob")
+
+	steps := []struct {
+		name     string
+		userID   string
+		role     models.Role
+		wantErr  string
+		wantRole models.Role
+	}{
+		{"promote to admin", alice.ID, models.RoleAdmin, "", models.RoleAdmin},
+		{"demote the last administrator", alice.ID, models.RoleModerator, "last administrator", models.RoleAdmin},
+		{"keep the last administrator an admin", alice.ID, models.RoleAdmin, "", models.RoleAdmin},
+		{"promote a second admin", bob.ID, models.RoleAdmin, "", models.RoleAdmin},
+		{"demote one of two admins", alice.ID, models.RoleModerator, "", models.RoleModerator},
+		{"demote the remaining admin", bob.ID, models.RoleUser, "last administrator", models.RoleAdmin},
+		{"change a moderator", alice.ID, models.RoleUser, "", models.RoleUser},
+		{"unknown user", "missing", models.RoleAdmin, "user not found", ""},
+	}
+
+	for _, step := range steps {
+		err := SetUserRole(step.userID, step.role)
+		if step.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), step.wantErr) {
+				t.Fatalf("%s: err = %v, want %q", step.name, err, step.wantErr)
+			}
+		} else if err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+
+		if step.wantRole == "" {
+			continue
+		}
+		role, err := GetUserRole(step.userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if role != step.wantRole {
+			t.Errorf("%s: role = %q, want %q", step.name, role, step.wantRole)
+		}
+	}
+}
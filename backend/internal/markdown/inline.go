@@ -0,0 +1,387 @@
+package markdown
+
+import (
+	"html"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Patterns recognizing inline constructs at the current position
+var (
+	entityPattern   = regexp.MustCompile(`^&(?:[A-Za-z][A-Za-z0-9]{1,31}|#[0-9]{1,7}|#[xX][0-9A-Fa-f]{1,6});`)
+	autolinkPattern = regexp.MustCompile(`^<((?:https?|mailto):[^\s<>]*)>`)
+	emailPattern    = regexp.MustCompile(`^<([A-Za-z0-9.!#$%&'*+/=?^_{|}~-]+@[A-Za-z0-9](?:[A-Za-z0-9-]*[A-Za-z0-9])?(?:\.[A-Za-z0-9](?:[A-Za-z0-9-]*[A-Za-z0-9])?)*)>`)
+	bareURLPattern  = regexp.MustCompile(`^https?://[^\s<]+`)
+	rawTagPattern   = regexp.MustCompile(`^(?:<!--[\s\S]*?-->|</?[A-Za-z][A-Za-z0-9-]*(?:\s+[A-Za-z_:][A-Za-z0-9_.:-]*(?:\s*=\s*(?:[^\s"'=<>` + "`" + `]+|'[^']*'|"[^"]*"))?)*\s*/?>)`)
+)
+
+// renderInline renders the inline content of a block: code spans, emphasis,
+// links, images, autolinks and hard line breaks. Raw HTML tags are passed
+// through for the sanitizer to filter.
+func renderInline(text string) string {
+	var out strings.Builder
+	for i := 0; i < len(text); {
+		c := text[i]
+		switch {
+		case c == '\\' && i+1 < len(text) && text[i+1] == '\n':
+			out.WriteString("<br>\n")
+			i += 2
+
+		case c == '\\' && i+1 < len(text) && isASCIIPunct(text[i+1]):
+			out.WriteString(html.EscapeString(text[i+1 : i+2]))
+			i += 2
+
+		case c == '`':
+			i = renderCodeSpan(&out, text, i)
+
+		case c == '*' || c == '_' || c == '~':
+			i = renderEmphasis(&out, text, i)
+
+		case c == '!' && strings.HasPrefix(text[i+1:], "["):
+			if end, ok := renderLink(&out, text, i+1, true); ok {
+				i = end
+			} else {
+				out.WriteString("!")
+				i++
+			}
+
+		case c == '[':
+			if end, ok := renderLink(&out, text, i, false); ok {
+				i = end
+			} else {
+				out.WriteString("[")
+				i++
+			}
+
+		case c == '<':
+			if match := autolinkPattern.FindStringSubmatch(text[i:]); match != nil {
+				writeLink(&out, match[1], html.EscapeString(match[1]))
+				i += len(match[0])
+			} else if match := emailPattern.FindStringSubmatch(text[i:]); match != nil {
+				writeLink(&out, "mailto:"+match[1], html.EscapeString(match[1]))
+				i += len(match[0])
+			} else if tag := rawTagPattern.FindString(text[i:]); tag != "" {
+				out.WriteString(tag)
+				i += len(tag)
+			} else {
+				out.WriteString("&lt;")
+				i++
+			}
+
+		case c == '&':
+			if entity := entityPattern.FindString(text[i:]); entity != "" {
+				out.WriteString(entity)
+				i += len(entity)
+			} else {
+				out.WriteString("&amp;")
+				i++
+			}
+
+		case c == 'h' && (i == 0 || !isWordByte(text[i-1])) && bareURLPattern.MatchString(text[i:]):
+			url := trimURL(bareURLPattern.FindString(text[i:]))
+			writeLink(&out, url, html.EscapeString(url))
+			i += len(url)
+
+		default:
+			_, size := utf8.DecodeRuneInString(text[i:])
+			out.WriteString(html.EscapeString(text[i : i+size]))
+			i += size
+		}
+	}
+	return out.String()
+}
+
+// renderCodeSpan renders a code span opened by the backtick run at start. An
+// unmatched run is written as literal backticks.
+func renderCodeSpan(out *strings.Builder, text string, start int) int {
+	run := delimiterRun(text, start)
+	for i := start + run; i < len(text); {
+		if text[i] != '`' {
+			i++
+			continue
+		}
+		closing := delimiterRun(text, i)
+		if closing == run {
+			code := strings.ReplaceAll(text[start+run:i], "\n", " ")
+			if len(code) > 2 && code[0] == ' ' && code[len(code)-1] == ' ' && strings.TrimSpace(code) != "" {
+				code = code[1 : len(code)-1]
+			}
+			out.WriteString("<code>" + html.EscapeString(code) + "</code>")
+			return i + closing
+		}
+		i += closing
+	}
+
+	out.WriteString(text[start : start+run])
+	return start + run
+}
+
+// renderEmphasis renders emphasis (* or _), strong emphasis (** or __) or
+// strikethrough (~~) opened by the delimiter run at start. Runs that cannot
+// open or have no closer are written literally.
+func renderEmphasis(out *strings.Builder, text string, start int) int {
+	c := text[start]
+	run := delimiterRun(text, start)
+
+	need := 1
+	tag := "em"
+	switch {
+	case c == '~':
+		need, tag = 2, "del"
+	case run >= 2:
+		need, tag = 2, "strong"
+	}
+
+	if (c != '~' || run == 2) && canOpen(text, start, run) {
+		if end := findCloser(text, start+need, c, need); end >= 0 {
+			out.WriteString("<" + tag + ">" + renderInline(text[start+need:end]) + "</" + tag + ">")
+			return end + need
+		}
+	}
+
+	out.WriteString(text[start : start+run])
+	return start + run
+}
+
+// findCloser finds the delimiter that closes emphasis opened with need
+// characters c, skipping code spans and escapes. It returns the index where the
+// closing delimiter starts, or -1.
+func findCloser(text string, from int, c byte, need int) int {
+	for i := from; i < len(text); {
+		switch text[i] {
+		case '\\':
+			i += 2
+			continue
+		case '`':
+			// Code spans bind tighter than emphasis
+			run := delimiterRun(text, i)
+			if end := strings.Index(text[i+run:], text[i:i+run]); end >= 0 {
+				i += run + end + run
+			} else {
+				i += run
+			}
+			continue
+		}
+		if text[i] != c {
+			i++
+			continue
+		}
+
+		run := delimiterRun(text, i)
+		end := i + run
+		// A lone * closes emphasis; ** and longer runs close strong emphasis
+		fits := run >= 3 || (need == 1) == (run == 1)
+		if c == '~' {
+			fits = run == 2
+		}
+		if fits && i > from && canClose(text, i, run) {
+			return end - need
+		}
+		i = end
+	}
+	return -1
+}
+
+// canOpen reports whether a delimiter run can open emphasis: it is followed by
+// a non-space, and an underscore run does not start inside a word
+func canOpen(text string, start, run int) bool {
+	next, _ := utf8.DecodeRuneInString(text[start+run:])
+	if start+run >= len(text) || unicode.IsSpace(next) {
+		return false
+	}
+	if text[start] == '_' && start > 0 {
+		prev, _ := utf8.DecodeLastRuneInString(text[:start])
+		return !isWordRune(prev)
+	}
+	return true
+}
+
+// canClose reports whether a delimiter run can close emphasis: it follows a
+// non-space, and an underscore run does not end inside a word
+func canClose(text string, start, run int) bool {
+	prev, _ := utf8.DecodeLastRuneInString(text[:start])
+	if start == 0 || unicode.IsSpace(prev) {
+		return false
+	}
+	if text[start] == '_' && start+run < len(text) {
+		next, _ := utf8.DecodeRuneInString(text[start+run:])
+		return !isWordRune(next)
+	}
+	return true
+}
+
+// renderLink renders [text](destination "title") starting at the opening
+// bracket, or ![alt](source "title") when image is set
+func renderLink(out *strings.Builder, text string, start int, image bool) (int, bool) {
+	closeBracket := matchingBracket(text, start)
+	if closeBracket < 0 || closeBracket+1 >= len(text) || text[closeBracket+1] != '(' {
+		return 0, false
+	}
+	destination, title, end, ok := parseLinkTarget(text, closeBracket+2)
+	if !ok {
+		return 0, false
+	}
+
+	label := text[start+1 : closeBracket]
+	titleAttr := ""
+	if title != "" {
+		titleAttr = ` title="` + html.EscapeString(title) + `"`
+	}
+	if image {
+		out.WriteString(`<img src="` + html.EscapeString(destination) + `" alt="` +
+			html.EscapeString(plainText(label)) + `"` + titleAttr + `>`)
+	} else {
+		out.WriteString(`<a href="` + html.EscapeString(destination) + `"` + titleAttr + `>` +
+			renderInline(label) + `</a>`)
+	}
+	return end, true
+}
+
+// matchingBracket finds the ] closing the [ at start, allowing nested brackets
+func matchingBracket(text string, start int) int {
+	depth := 0
+	for i := start; i < len(text); i++ {
+		switch text[i] {
+		case '\\':
+			i++
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// parseLinkTarget parses the destination and optional title of a link, which
+// start after the opening parenthesis, and returns the index after the closing one
+func parseLinkTarget(text string, start int) (destination, title string, end int, ok bool) {
+	i := skipSpaces(text, start)
+
+	if i < len(text) && text[i] == '<' {
+		closing := strings.IndexAny(text[i+1:], ">\n")
+		if closing < 0 || text[i+1+closing] != '>' {
+			return "", "", 0, false
+		}
+		destination = text[i+1 : i+1+closing]
+		i += closing + 2
+	} else {
+		depth := 0
+		begin := i
+		for ; i < len(text); i++ {
+			ch := text[i]
+			if ch == '\\' && i+1 < len(text) {
+				i++
+				continue
+			}
+			if ch == '(' {
+				depth++
+			} else if ch == ')' {
+				if depth == 0 {
+					break
+				}
+				depth--
+			} else if ch == ' ' || ch == '\n' {
+				break
+			}
+		}
+		destination = text[begin:i]
+	}
+
+	i = skipSpaces(text, i)
+	if i < len(text) && (text[i] == '"' || text[i] == '\'') {
+		closing := strings.IndexByte(text[i+1:], text[i])
+		if closing < 0 {
+			return "", "", 0, false
+		}
+		title = unescapePunct(text[i+1 : i+1+closing])
+		i = skipSpaces(text, i+closing+2)
+	}
+
+	if i >= len(text) || text[i] != ')' {
+		return "", "", 0, false
+	}
+	return unescapePunct(destination), title, i + 1, true
+}
+
+// writeLink writes a link whose label is already rendered
+func writeLink(out *strings.Builder, href, label string) {
+	out.WriteString(`<a href="` + html.EscapeString(href) + `">` + label + `</a>`)
+}
+
+// trimURL drops trailing punctuation from a bare URL, keeping closing
+// parentheses that balance ones inside the URL
+func trimURL(url string) string {
+	for len(url) > 0 {
+		last := url[len(url)-1]
+		if strings.IndexByte(".,:;!?\"'*_~", last) >= 0 {
+			url = url[:len(url)-1]
+			continue
+		}
+		if last == ')' && strings.Count(url, ")") > strings.Count(url, "(") {
+			url = url[:len(url)-1]
+			continue
+		}
+		break
+	}
+	return url
+}
+
+// plainText strips Markdown punctuation from image alt text
+func plainText(label string) string {
+	return strings.NewReplacer("*", "", "_", "", "`", "", "~", "", "[", "", "]", "").Replace(unescapePunct(label))
+}
+
+// unescapePunct removes the backslashes of escaped punctuation
+func unescapePunct(s string) string {
+	if !strings.Contains(s, "\\") {
+		return s
+	}
+	var out strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) && isASCIIPunct(s[i+1]) {
+			i++
+		}
+		out.WriteByte(s[i])
+	}
+	return out.String()
+}
+
+// delimiterRun counts the repetitions of the character at start
+func delimiterRun(text string, start int) int {
+	n := 1
+	for start+n < len(text) && text[start+n] == text[start] {
+		n++
+	}
+	return n
+}
+
+// skipSpaces skips spaces and at most one line ending
+func skipSpaces(text string, i int) int {
+	newline := false
+	for ; i < len(text); i++ {
+		if text[i] == '\n' && !newline {
+			newline = true
+		} else if text[i] != ' ' {
+			break
+		}
+	}
+	return i
+}
+
+func isASCIIPunct(c byte) bool {
+	return strings.IndexByte("!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~", c) >= 0
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z'
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
@@ -0,0 +1,311 @@
+package markdown
+
+import (
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Patterns recognizing the start of each kind of block
+var (
+	headingPattern    = regexp.MustCompile(`^ {0,3}(#{1,6})(?:[ \t]+(.*?))?(?:[ \t]+#+)?[ \t]*$`)
+	rulePattern       = regexp.MustCompile(`^ {0,3}(?:(?:-[ \t]*){3,}|(?:\*[ \t]*){3,}|(?:_[ \t]*){3,})$`)
+	fencePattern      = regexp.MustCompile("^( {0,3})(`{3,}|~{3,})[ \t]*([^`]*?)[ \t]*$")
+	quotePattern      = regexp.MustCompile(`^ {0,3}> ?`)
+	bulletPattern     = regexp.MustCompile(`^( {0,3})([-+*])( {1,4}|$)`)
+	orderedPattern    = regexp.MustCompile(`^( {0,3})(\d{1,9})([.)])( {1,4}|$)`)
+	hardBreakPattern  = regexp.MustCompile(`(?: {2,}|\\)\n`)
+	languageSeparator = regexp.MustCompile(`[^A-Za-z0-9_+#.-]`)
+)
+
+// Render converts Markdown to HTML and sanitizes the result, so it is safe to
+// insert into a page. Raw HTML in the source is kept only where the sanitizer allows it.
+func Render(source string) string {
+	if strings.TrimSpace(source) == "" {
+		return ""
+	}
+	return Sanitize(renderHTML(source))
+}
+
+// renderHTML converts Markdown to unsanitized HTML
+func renderHTML(source string) string {
+	source = strings.ReplaceAll(source, "\r\n", "\n")
+	source = strings.ReplaceAll(source, "\r", "\n")
+	source = strings.ReplaceAll(source, "\t", "    ")
+
+	var out strings.Builder
+	renderBlocks(&out, strings.Split(source, "\n"), false)
+	return out.String()
+}
+
+// renderBlocks renders a run of lines as block elements. Paragraphs of tight
+// list items are written without <p> tags.
+func renderBlocks(out *strings.Builder, lines []string, tight bool) {
+	for i := 0; i < len(lines); {
+		line := lines[i]
+
+		switch {
+		case isBlank(line):
+			i++
+
+		case fencePattern.MatchString(line):
+			i = renderFencedCode(out, lines, i)
+
+		case indentOf(line) >= 4:
+			i = renderIndentedCode(out, lines, i)
+
+		case headingPattern.MatchString(line):
+			match := headingPattern.FindStringSubmatch(line)
+			level := strconv.Itoa(len(match[1]))
+			out.WriteString("<h" + level + ">" + renderInline(strings.TrimSpace(match[2])) + "</h" + level + ">\n")
+			i++
+
+		case rulePattern.MatchString(line):
+			out.WriteString("<hr>\n")
+			i++
+
+		case quotePattern.MatchString(line):
+			var quoted []string
+			for ; i < len(lines) && quotePattern.MatchString(lines[i]); i++ {
+				quoted = append(quoted, quotePattern.ReplaceAllString(lines[i], ""))
+			}
+			out.WriteString("<blockquote>\n")
+			renderBlocks(out, quoted, false)
+			out.WriteString("</blockquote>\n")
+
+		case listMarker(line) != nil:
+			i = renderList(out, lines, i)
+
+		default:
+			i = renderParagraph(out, lines, i, tight)
+		}
+	}
+}
+
+// renderFencedCode renders a ``` or ~~~ code block, using the first word of the
+// info string as the language hint
+func renderFencedCode(out *strings.Builder, lines []string, start int) int {
+	match := fencePattern.FindStringSubmatch(lines[start])
+	indent, fence := len(match[1]), match[2]
+
+	language := ""
+	if fields := strings.Fields(match[3]); len(fields) > 0 {
+		language = strings.ToLower(languageSeparator.ReplaceAllString(fields[0], ""))
+	}
+
+	var code strings.Builder
+	i := start + 1
+	for ; i < len(lines); i++ {
+		trimmed := strings.TrimLeft(lines[i], " ")
+		if indentOf(lines[i]) < 4 && strings.HasPrefix(trimmed, fence) &&
+			strings.Trim(trimmed, fence[:1]+" ") == "" {
+			i++
+			break
+		}
+		code.WriteString(html.EscapeString(trimIndent(lines[i], indent)))
+		code.WriteString("\n")
+	}
+
+	if language != "" {
+		out.WriteString(`<pre><code class="language-` + language + `">`)
+	} else {
+		out.WriteString("<pre><code>")
+	}
+	out.WriteString(code.String())
+	out.WriteString("</code></pre>\n")
+	return i
+}
+
+// renderIndentedCode renders a block of lines indented by four or more spaces
+func renderIndentedCode(out *strings.Builder, lines []string, start int) int {
+	end := start
+	for i := start; i < len(lines); i++ {
+		if isBlank(lines[i]) {
+			continue
+		}
+		if indentOf(lines[i]) < 4 {
+			break
+		}
+		end = i + 1
+	}
+
+	out.WriteString("<pre><code>")
+	for _, line := range lines[start:end] {
+		out.WriteString(html.EscapeString(trimIndent(line, 4)))
+		out.WriteString("\n")
+	}
+	out.WriteString("</code></pre>\n")
+	return end
+}
+
+// listItemMarker describes the marker that starts a list item
+type listItemMarker struct {
+	ordered bool
+	// The bullet character, or the delimiter after the number of an ordered item
+	delimiter string
+	start     int
+	// Columns of indentation that continue the item's content
+	contentIndent int
+}
+
+// listMarker parses the list item marker at the start of a line, or returns nil
+func listMarker(line string) *listItemMarker {
+	if match := bulletPattern.FindStringSubmatch(line); match != nil {
+		return &listItemMarker{
+			delimiter:     match[2],
+			contentIndent: markerIndent(line, len(match[0])),
+		}
+	}
+	if match := orderedPattern.FindStringSubmatch(line); match != nil {
+		start, _ := strconv.Atoi(match[2])
+		return &listItemMarker{
+			ordered:       true,
+			delimiter:     match[3],
+			start:         start,
+			contentIndent: markerIndent(line, len(match[0])),
+		}
+	}
+	return nil
+}
+
+// markerIndent is the content indent of an item whose marker and following
+// spaces take up width columns. Blank items and items starting with indented
+// code continue one column after the marker.
+func markerIndent(line string, width int) int {
+	if width >= len(line) || strings.HasSuffix(line[:width], "    ") {
+		return len(strings.TrimRight(line[:width], " ")) + 1
+	}
+	return width
+}
+
+// renderList renders consecutive items of the same kind of list
+func renderList(out *strings.Builder, lines []string, start int) int {
+	first := listMarker(lines[start])
+
+	sameList := func(marker *listItemMarker) bool {
+		return marker != nil && marker.ordered == first.ordered && marker.delimiter == first.delimiter
+	}
+
+	var items [][]string
+	loose := false
+	i := start
+	for i < len(lines) {
+		marker := listMarker(lines[i])
+		if !sameList(marker) {
+			break
+		}
+
+		item := []string{lines[i][min(marker.contentIndent, len(lines[i])):]}
+		i++
+		for ; i < len(lines); i++ {
+			line := lines[i]
+			if isBlank(line) {
+				item = append(item, "")
+				continue
+			}
+			if indentOf(line) >= marker.contentIndent {
+				item = append(item, trimIndent(line, marker.contentIndent))
+				continue
+			}
+			// Lazy continuation of the item's last paragraph
+			if !isBlank(item[len(item)-1]) && !startsBlock(line) && listMarker(line) == nil {
+				item = append(item, strings.TrimLeft(line, " "))
+				continue
+			}
+			break
+		}
+
+		// Blank lines between items or between blocks of an item make the list loose
+		end := len(item)
+		for end > 0 && isBlank(item[end-1]) {
+			end--
+		}
+		if end < len(item) && i < len(lines) && sameList(listMarker(lines[i])) {
+			loose = true
+		}
+		for _, line := range item[:end] {
+			if isBlank(line) {
+				loose = true
+			}
+		}
+		items = append(items, item[:end])
+	}
+
+	if first.ordered {
+		if first.start != 1 {
+			out.WriteString(`<ol start="` + strconv.Itoa(first.start) + `">` + "\n")
+		} else {
+			out.WriteString("<ol>\n")
+		}
+	} else {
+		out.WriteString("<ul>\n")
+	}
+	for _, item := range items {
+		out.WriteString("<li>")
+		var content strings.Builder
+		renderBlocks(&content, item, !loose)
+		out.WriteString(strings.TrimSuffix(content.String(), "\n"))
+		out.WriteString("</li>\n")
+	}
+	if first.ordered {
+		out.WriteString("</ol>\n")
+	} else {
+		out.WriteString("</ul>\n")
+	}
+
+	// Trailing blank lines belong to whatever follows the list
+	for i > start && isBlank(lines[i-1]) {
+		i--
+	}
+	return i
+}
+
+// renderParagraph renders lines up to the next blank line or block start as a paragraph
+func renderParagraph(out *strings.Builder, lines []string, start int, tight bool) int {
+	var text []string
+	i := start
+	for ; i < len(lines); i++ {
+		if isBlank(lines[i]) || (i > start && startsBlock(lines[i])) {
+			break
+		}
+		text = append(text, strings.TrimLeft(lines[i], " "))
+	}
+
+	joined := strings.TrimRight(strings.Join(text, "\n"), " ")
+	content := renderInline(hardBreakPattern.ReplaceAllString(joined, "\\\n"))
+	if tight {
+		out.WriteString(content + "\n")
+	} else {
+		out.WriteString("<p>" + content + "</p>\n")
+	}
+	return i
+}
+
+// startsBlock reports whether a line interrupts a paragraph
+func startsBlock(line string) bool {
+	if indentOf(line) >= 4 {
+		return false
+	}
+	if marker := listMarker(line); marker != nil {
+		// Only items with content, and ordered lists starting at 1, interrupt a paragraph
+		return strings.TrimSpace(line[marker.contentIndent-1:]) != "" && (!marker.ordered || marker.start == 1)
+	}
+	return fencePattern.MatchString(line) || headingPattern.MatchString(line) ||
+		rulePattern.MatchString(line) || quotePattern.MatchString(line)
+}
+
+// isBlank reports whether a line holds only whitespace
+func isBlank(line string) bool {
+	return strings.TrimSpace(line) == ""
+}
+
+// indentOf counts the leading spaces of a line
+func indentOf(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+// trimIndent removes up to n leading spaces
+func trimIndent(line string, n int) string {
+	return line[min(n, indentOf(line)):]
+}
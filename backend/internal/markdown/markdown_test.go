@@ -0,0 +1,157 @@
+package markdown
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{"empty", "  \n ", ""},
+		{"paragraph", "hello world", "<p>hello world</p>\n"},
+		{"escapes text", "a < b & c > d", "<p>a &lt; b &amp; c &gt; d</p>\n"},
+		{"emphasis", "*em* **strong** ~~del~~", "<p><em>em</em> <strong>strong</strong> <del>del</del></p>\n"},
+		{"intraword underscore", "snake_case_name", "<p>snake_case_name</p>\n"},
+		{"code span", "use `a < b`", "<p>use <code>a &lt; b</code></p>\n"},
+		{"heading", "## Title ##", "<h2>Title</h2>\n"},
+		{"rule", "***", "<hr>\n"},
+		{"blockquote", "> quoted", "<blockquote>\n<p>quoted</p>\n</blockquote>\n"},
+		{"hard break", "one  \ntwo", "<p>one<br>\ntwo</p>\n"},
+		{"tight list", "- a\n- b", "<ul>\n<li>a</li>\n<li>b</li>\n</ul>\n"},
+		{"loose list", "- a\n\n- b", "<ul>\n<li><p>a</p></li>\n<li><p>b</p></li>\n</ul>\n"},
+		{"ordered list start", "3. c\n4. d", "<ol start=\"3\">\n<li>c</li>\n<li>d</li>\n</ol>\n"},
+		{"nested list", "- a\n  - b", "<ul>\n<li>a\n<ul>\n<li>b</li>\n</ul></li>\n</ul>\n"},
+		{
+			"fenced code with language",
+			"```go\nfmt.Println(\"<hi>\")\n```",
+			"<pre><code class=\"language-go\">fmt.Println(&#34;&lt;hi&gt;&#34;)\n</code></pre>\n",
+		},
+		{
+			"fence language is cleaned",
+			"```c\"onclick=x\nint a;\n```",
+			"<pre><code class=\"language-conclickx\">int a;\n</code></pre>\n",
+		},
+		{"indented code", "    <b>x</b>", "<pre><code>&lt;b&gt;x&lt;/b&gt;\n</code></pre>\n"},
+		{
+			"link",
+			"[site](https://example.com \"Title\")",
+			"<p><a href=\"https://example.com\" title=\"Title\" rel=\"nofollow\">site</a></p>\n",
+		},
+		{
+			"image",
+			"![a *cat*](https://example.com/cat.png)",
+			"<p><img src=\"https://example.com/cat.png\" alt=\"a cat\"></p>\n",
+		},
+		{
+			"bare url",
+			"see https://example.com/a_(b).",
+			"<p>see <a href=\"https://example.com/a_(b)\" rel=\"nofollow\">https://example.com/a_(b)</a>.</p>\n",
+		},
+		{
+			"autolink email",
+			"<me@example.com>",
+			"<p><a href=\"mailto:me@example.com\" rel=\"nofollow\">me@example.com</a></p>\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Render(tt.source); got != tt.want {
+				t.Errorf("Render(%q)\n got: %q\nwant: %q", tt.source, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderStripsUnsafeContent(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{"javascript link", "[x](javascript:alert(1))", "<p><a rel=\"nofollow\">x</a></p>\n"},
+		{"obfuscated scheme", "[x](java\tscript:alert(1))", "<p>[x](java    script:alert(1))</p>\n"},
+		{"uppercase scheme", "<a href=\"JAVASCRIPT:alert(1)\">x</a>", "<p><a rel=\"nofollow\">x</a></p>\n"},
+		{"entity encoded scheme", "<a href=\"&#106;avascript:alert(1)\">x</a>", "<p><a rel=\"nofollow\">x</a></p>\n"},
+		{"data image", "![x](data:image/svg+xml;base64,AAAA)", "<p><img alt=\"x\"></p>\n"},
+		{"script element", "<script>alert(1)</script>after", "<p>after</p>\n"},
+		{"unclosed script", "before<script>alert(1)", "<p>before</p>"},
+		{"style element", "<style>p{}</style>text", "<p>text</p>\n"},
+		{"event handler", "<b onclick=\"alert(1)\">bold</b>", "<p><b>bold</b></p>\n"},
+		{"style attribute", "<p style=\"color:red\">x</p>", "<p><p>x</p></p>\n"},
+		{"unknown tag", "<marquee>x</marquee>", "<p>x</p>\n"},
+		{"iframe", "<iframe src=\"https://evil.example\"></iframe>ok", "<p>ok</p>\n"},
+		{"arbitrary class", "<code class=\"evil\">x</code>", "<p><code>x</code></p>\n"},
+		{"language class", "<code class=\"language-go\">x</code>", "<p><code class=\"language-go\">x</code></p>\n"},
+		{"comment", "a<!-- <script>alert(1)</script> -->b", "<p>ab</p>\n"},
+		{"unclosed tag", "<em>open", "<p><em>open</em></p>\n"},
+		{"stray closing tag", "text</strong>", "<p>text</p>\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Render(tt.source); got != tt.want {
+				t.Errorf("Render(%q)\n got: %q\nwant: %q", tt.source, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"keeps allowed attributes", `<a href="/posts/1" title="t">x</a>`, `<a href="/posts/1" title="t" rel="nofollow">x</a>`},
+		{"replaces rel", `<a href="https://a.example" rel="opener">x</a>`, `<a href="https://a.example" rel="nofollow">x</a>`},
+		{"mailto link", `<a href="mailto:me@example.com">x</a>`, `<a href="mailto:me@example.com" rel="nofollow">x</a>`},
+		{"mailto image", `<img src="mailto:me@example.com">`, `<img>`},
+		{"duplicate attribute", `<a href="/a" href="javascript:x">x</a>`, `<a href="/a" rel="nofollow">x</a>`},
+		{"unquoted attribute", `<img src=https://a.example/x.png alt=x>`, `<img src="https://a.example/x.png" alt="x">`},
+		{"escapes attribute values", `<img alt='"><script>'>`, `<img alt="&#34;&gt;&lt;script&gt;">`},
+		{"invalid start", `<ol start="1 onclick">`, `<ol></ol>`},
+		{"closes inner tags", `<em><strong>x</em>y`, `<em><strong>x</strong></em>y`},
+		{"bare angle brackets", `1 < 2 > 0`, `1 &lt; 2 &gt; 0`},
+		{"bare ampersand", `a & b &amp; c`, `a &amp; b &amp; c`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Sanitize(tt.input); got != tt.want {
+				t.Errorf("Sanitize(%q)\n got: %q\nwant: %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderNeverEmitsDangerousMarkup(t *testing.T) {
+	sources := []string{
+		"[x](javascript:alert(1))",
+		"[x](<javascript:alert(1)>)",
+		"![x](javascript:alert(1))",
+		"<a href=javascript:alert(1)>x</a>",
+		"<a href=\" javascript:alert(1)\">x</a>",
+		"<a href=\"java&#x09;script:alert(1)\">x</a>",
+		"<img src=x onerror=alert(1)>",
+		"<svg><script>alert(1)</script></svg>",
+		"<scr<script>ipt>alert(1)</script>",
+		"<<script>script>alert(1)<</script>/script>",
+		"`<script>` <script >alert(1)</script >",
+		"<SCRIPT>alert(1)</SCRIPT>",
+		"<div onmouseover=\"alert(1)\">x</div>",
+	}
+
+	for _, source := range sources {
+		got := strings.ToLower(Render(source))
+		for _, bad := range []string{"<script", "javascript:", "onerror", "onmouseover", "<svg", "<div"} {
+			if strings.Contains(got, bad) {
+				t.Errorf("Render(%q) = %q, contains %q", source, got, bad)
+			}
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package markdown
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+// allowedTags lists the elements kept by Sanitize and the attributes each may carry
+var allowedTags = map[string][]string{
+	"a":          {"href", "title"},
+	"b":          nil,
+	"blockquote": nil,
+	"br":         nil,
+	"code":       {"class"},
+	"del":        nil,
+	"em":         nil,
+	"h1":         nil,
+	"h2":         nil,
+	"h3":         nil,
+	"h4":         nil,
+	"h5":         nil,
+	"h6":         nil,
+	"hr":         nil,
+	"i":          nil,
+	"img":        {"src", "alt", "title"},
+	"kbd":        nil,
+	"li":         nil,
+	"ol":         {"start"},
+	"p":          nil,
+	"pre":        nil,
+	"s":          nil,
+	"strong":     nil,
+	"sub":        nil,
+	"sup":        nil,
+	"ul":         nil,
+}
+
+// voidTags are allowed elements that have no closing tag
+var voidTags = map[string]bool{"br": true, "hr": true, "img": true}
+
+// droppedTags are removed together with everything inside them
+var droppedTags = map[string]bool{
+	"script": true, "style": true, "iframe": true, "object": true, "embed": true,
+	"textarea": true, "title": true, "noscript": true, "template": true,
+	"svg": true, "math": true, "xmp": true, "noembed": true, "noframes": true,
+}
+
+// URL schemes allowed in links and image sources; relative URLs are always allowed
+var (
+	linkSchemes  = map[string]bool{"http": true, "https": true, "mailto": true}
+	imageSchemes = map[string]bool{"http": true, "https": true}
+)
+
+var (
+	tagPattern       = regexp.MustCompile(`^<(/?)([A-Za-z][A-Za-z0-9]*)((?:\s+[^\s"'>/=]+(?:\s*=\s*(?:"[^"]*"|'[^']*'|[^\s"'=<>` + "`" + `]+))?)*)\s*/?>`)
+	attributePattern = regexp.MustCompile(`([^\s"'>/=]+)(?:\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'=<>` + "`" + `]+)))?`)
+	languagePattern  = regexp.MustCompile(`^language-[A-Za-z0-9_+#.-]+$`)
+	digitsPattern    = regexp.MustCompile(`^[0-9]{1,9}$`)
+)
+
+// Sanitize filters HTML through an allow-list. Allowed tags keep only their
+// allowed attributes, links and images keep only safe URLs, every link gets
+// rel="nofollow", and unclosed tags are closed. Other tags are removed, along
+// with the contents of scripts, styles and embedded documents; everything else
+// is kept as escaped text.
+func Sanitize(input string) string {
+	var out strings.Builder
+	var open []string
+
+	for i := 0; i < len(input); {
+		switch input[i] {
+		case '<':
+			if strings.HasPrefix(input[i:], "<!--") {
+				end := strings.Index(input[i+4:], "-->")
+				if end < 0 {
+					i = len(input)
+				} else {
+					i += 4 + end + 3
+				}
+				continue
+			}
+
+			match := tagPattern.FindStringSubmatch(input[i:])
+			if match == nil {
+				out.WriteString("&lt;")
+				i++
+				continue
+			}
+			i += len(match[0])
+
+			closing, name := match[1] == "/", strings.ToLower(match[2])
+			if droppedTags[name] {
+				if !closing {
+					i = skipElement(input, i, name)
+				}
+				continue
+			}
+			attributes, allowed := allowedTags[name]
+			if !allowed {
+				continue
+			}
+
+			if closing {
+				open = closeTag(&out, open, name)
+				continue
+			}
+			out.WriteString("<" + name + sanitizeAttributes(name, attributes, match[3]) + ">")
+			if !voidTags[name] {
+				open = append(open, name)
+			}
+
+		case '>':
+			out.WriteString("&gt;")
+			i++
+
+		case '&':
+			if entity := entityPattern.FindString(input[i:]); entity != "" {
+				out.WriteString(entity)
+				i += len(entity)
+			} else {
+				out.WriteString("&amp;")
+				i++
+			}
+
+		default:
+			out.WriteByte(input[i])
+			i++
+		}
+	}
+
+	for j := len(open) - 1; j >= 0; j-- {
+		out.WriteString("</" + open[j] + ">")
+	}
+	return out.String()
+}
+
+// closeTag closes the innermost open element called name, closing any elements
+// opened inside it first. A closing tag with nothing to close is dropped.
+func closeTag(out *strings.Builder, open []string, name string) []string {
+	for j := len(open) - 1; j >= 0; j-- {
+		if open[j] != name {
+			continue
+		}
+		for k := len(open) - 1; k >= j; k-- {
+			out.WriteString("</" + open[k] + ">")
+		}
+		return open[:j]
+	}
+	return open
+}
+
+// skipElement returns the index after the closing tag of a dropped element, or
+// the end of the input when it is never closed
+func skipElement(input string, from int, name string) int {
+	lower := strings.ToLower(input[from:])
+	for offset := 0; ; {
+		end := strings.Index(lower[offset:], "</"+name)
+		if end < 0 {
+			return len(input)
+		}
+		offset += end + len(name) + 2
+		if offset < len(lower) && (lower[offset] == '>' || strings.IndexByte(" \t\n\r/", lower[offset]) >= 0) {
+			if closeAt := strings.IndexByte(lower[offset:], '>'); closeAt >= 0 {
+				return from + offset + closeAt + 1
+			}
+			return len(input)
+		}
+	}
+}
+
+// sanitizeAttributes keeps the allowed attributes of a tag, re-escaping their values
+func sanitizeAttributes(tag string, allowed []string, raw string) string {
+	var out strings.Builder
+	seen := make(map[string]bool)
+
+	for _, match := range attributePattern.FindAllStringSubmatch(raw, -1) {
+		name := strings.ToLower(match[1])
+		if seen[name] || !contains(allowed, name) {
+			continue
+		}
+		value := html.UnescapeString(match[2] + match[3] + match[4])
+
+		switch {
+		case name == "href":
+			value = safeURL(value, linkSchemes)
+		case name == "src":
+			value = safeURL(value, imageSchemes)
+		case name == "class":
+			if !languagePattern.MatchString(value) {
+				value = ""
+			}
+		case name == "start":
+			if !digitsPattern.MatchString(value) {
+				value = ""
+			}
+		}
+		if value == "" && name != "alt" {
+			continue
+		}
+
+		seen[name] = true
+		out.WriteString(" " + name + `="` + html.EscapeString(value) + `"`)
+	}
+
+	if tag == "a" {
+		out.WriteString(` rel="nofollow"`)
+	}
+	return out.String()
+}
+
+// safeURL returns a URL if it is relative or uses one of the allowed schemes,
+// or an empty string otherwise
+func safeURL(value string, schemes map[string]bool) string {
+	value = strings.TrimSpace(value)
+	// Browsers ignore control characters and whitespace inside a scheme
+	cleaned := strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || r == ' ' {
+			return -1
+		}
+		return r
+	}, value)
+
+	colon := strings.IndexByte(cleaned, ':')
+	if colon < 0 || strings.ContainsAny(cleaned[:colon], "/?#") {
+		return value
+	}
+	if !schemes[strings.ToLower(cleaned[:colon])] {
+		return ""
+	}
+	return value
+}
+
+// contains reports whether list holds value
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,89 @@
+package models
+
+import (
+	"errors"
+	"mime"
+	"time"
+)
+
+// Attachment represents an uploaded file. It belongs to its uploader until it
+// is attached to a post or a message.
+type Attachment struct {
+	ID         string `json:"id"`
+	UploaderID string `json:"uploader_id"`
+	Filename   string `json:"filename"`
+	MimeType   string `json:"mime_type"`
+	Size       int64  `json:"size"`
+	// Pixel dimensions of images
+	Width  int `json:"width,omitempty"`
+	Height int `json:"height,omitempty"`
+	// Download locations, both access controlled
+	URL          string    `json:"url"`
+	ThumbnailURL string    `json:"thumbnail_url,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	// Storage keys of the file and its thumbnail
+	StorageKey   string `json:"-"`
+	ThumbnailKey string `json:"-"`
+	// What the attachment is attached to, if anything
+	PostID    string `json:"-"`
+	MessageID string `json:"-"`
+}
+
+// Limits on attachments
+const (
+	// MaxAttachmentSize is the largest upload accepted for any file type
+	MaxAttachmentSize = 10 << 20
+	// MaxAttachments is the most attachments a post or message can carry
+	MaxAttachments = 5
+	// ThumbnailSize is the longest side of an image thumbnail, in pixels
+	ThumbnailSize = 320
+)
+
+// attachmentSizeLimits lists the accepted content types and the largest file allowed for each
+var attachmentSizeLimits = map[string]int64{
+	"image/jpeg":      5 << 20,
+	"image/png":       5 << 20,
+	"image/gif":       5 << 20,
+	"image/webp":      5 << 20,
+	"application/pdf": MaxAttachmentSize,
+	"text/plain":      1 << 20,
+}
+
+// SetURLs fills in the download locations of an attachment
+func (a *Attachment) SetURLs() {
+	a.URL = "/api/attachments/" + a.ID
+	a.ThumbnailURL = ""
+	if a.ThumbnailKey != "" {
+		a.ThumbnailURL = a.URL + "/thumbnail"
+	}
+}
+
+// ValidateAttachment checks a sniffed content type and a file size against the
+// accepted types and their limits. It returns the content type without parameters.
+func ValidateAttachment(contentType string, size int64) (string, error) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", errors.New("unsupported file type")
+	}
+
+	limit, ok := attachmentSizeLimits[mediaType]
+	if !ok {
+		return "", errors.New("unsupported file type: " + mediaType)
+	}
+	if size == 0 {
+		return "", errors.New("file is empty")
+	}
+	if size > limit {
+		return "", errors.New("file is too large")
+	}
+	return mediaType, nil
+}
+
+// validateAttachmentIDs trims and deduplicates attachment IDs and checks their number
+func validateAttachmentIDs(ids *[]string) error {
+	*ids = uniqueIDs(*ids)
+	if len(*ids) > MaxAttachments {
+		return errors.New("too many attachments")
+	}
+	return nil
+}
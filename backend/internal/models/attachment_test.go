@@ -0,0 +1,40 @@
+package models
+
+import "testing"
+
+func TestValidateAttachment(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		size        int64
+		want        string
+		wantErr     string
+	}{
+		{"image", "image/png", 1024, "image/png", ""},
+		{"parameters dropped", "text/plain; charset=utf-8", 10, "text/plain", ""},
+		{"pdf at the overall limit", "application/pdf", MaxAttachmentSize, "application/pdf", ""},
+		{"image over its limit", "image/jpeg", 5<<20 + 1, "", "file is too large"},
+		{"text over its limit", "text/plain", 1<<20 + 1, "", "file is too large"},
+		{"empty", "image/gif", 0, "", "file is empty"},
+		{"unsupported", "text/html; charset=utf-8", 10, "", "unsupported file type: text/html"},
+		{"malformed", "", 10, "", "unsupported file type"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ValidateAttachment(tt.contentType, tt.size)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("media type = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
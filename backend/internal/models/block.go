@@ -0,0 +1,27 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// BlockedUser represents a user that the current user has blocked
+type BlockedUser struct {
+	UserID    string    `json:"user_id"`
+	Nickname  string    `json:"nickname"`
+	BlockedAt time.Time `json:"blocked_at"`
+}
+
+// BlockCreation represents the data needed to block a user
+type BlockCreation struct {
+	UserID string `json:"user_id"`
+}
+
+// Validate validates the block creation data
+func (bc *BlockCreation) Validate() error {
+	if strings.TrimSpace(bc.UserID) == "" {
+		return errors.New("user ID is required")
+	}
+	return nil
+}
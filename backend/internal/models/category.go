@@ -0,0 +1,66 @@
+package models
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// Category represents a post category managed by administrators
+type Category struct {
+	Slug        string `json:"slug"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	SortOrder   int    `json:"sort_order"`
+	Archived    bool   `json:"archived"`
+	PostCount   int    `json:"post_count"`
+}
+
+// CategoryCreation represents the data needed to create a category
+type CategoryCreation struct {
+	Slug        string `json:"slug"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	SortOrder   int    `json:"sort_order"`
+}
+
+// CategoryUpdate represents the data needed to edit a category. The slug is
+// fixed because posts refer to it.
+type CategoryUpdate struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	SortOrder   int    `json:"sort_order"`
+	Archived    bool   `json:"archived"`
+}
+
+var categorySlugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// Validate validates the category creation data
+func (cc *CategoryCreation) Validate() error {
+	if len(cc.Slug) < 2 || len(cc.Slug) > 30 {
+		return errors.New("slug must be between 2 and 30 characters")
+	}
+	if !categorySlugPattern.MatchString(cc.Slug) {
+		return errors.New("slug can only contain lowercase letters, numbers, and single hyphens")
+	}
+	return validateCategoryDetails(cc.Name, cc.Description)
+}
+
+// Validate validates the category update data
+func (cu *CategoryUpdate) Validate() error {
+	return validateCategoryDetails(cu.Name, cu.Description)
+}
+
+// validateCategoryDetails validates the fields shared by category creation and updates
+func validateCategoryDetails(name, description string) error {
+	if strings.TrimSpace(name) == "" {
+		return errors.New("name is required")
+	}
+	if len(name) > 50 {
+		return errors.New("name must be at most 50 characters")
+	}
+	if len(description) > 200 {
+		return errors.New("description must be at most 200 characters")
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// Conversation kinds
+const (
+	ConversationDirect = "direct"
+	ConversationGroup  = "group"
+)
+
+// Conversation member roles. The creator can appoint admins; admins can
+// add and remove members and rename the conversation.
+const (
+	MemberRoleCreator = "creator"
+	MemberRoleAdmin   = "admin"
+	MemberRoleMember  = "member"
+)
+
+// MaxGroupMembers is the largest number of members a group conversation can have
+const MaxGroupMembers = 50
+
+// ConversationMember represents a member of a conversation
+type ConversationMember struct {
+	UserID   string    `json:"user_id"`
+	Nickname string    `json:"nickname"`
+	Role     string    `json:"role"`
+	JoinedAt time.Time `json:"joined_at"`
+}
+
+// ConversationCreation represents the data needed to create a group conversation
+type ConversationCreation struct {
+	Name      string   `json:"name"`
+	MemberIDs []string `json:"member_ids"`
+}
+
+// ConversationUpdate represents the data needed to rename a group conversation
+type ConversationUpdate struct {
+	Name string `json:"name"`
+}
+
+// MemberAddition represents the users to add to a group conversation
+type MemberAddition struct {
+	UserIDs []string `json:"user_ids"`
+}
+
+// MemberRoleUpdate represents a change to a member's role
+type MemberRoleUpdate struct {
+	Role string `json:"role"`
+}
+
+// CanManageMembers reports whether a member role may add and remove members
+func CanManageMembers(role string) bool {
+	return role == MemberRoleCreator || role == MemberRoleAdmin
+}
+
+// Validate validates the conversation creation data
+func (cc *ConversationCreation) Validate() error {
+	if err := validateConversationName(&cc.Name); err != nil {
+		return err
+	}
+	cc.MemberIDs = uniqueIDs(cc.MemberIDs)
+	if len(cc.MemberIDs) == 0 {
+		return errors.New("at least one other member is required")
+	}
+	if len(cc.MemberIDs) >= MaxGroupMembers {
+		return errors.New("too many members")
+	}
+	return nil
+}
+
+// Validate validates the conversation update data
+func (cu *ConversationUpdate) Validate() error {
+	return validateConversationName(&cu.Name)
+}
+
+// Validate validates the member addition data
+func (ma *MemberAddition) Validate() error {
+	ma.UserIDs = uniqueIDs(ma.UserIDs)
+	if len(ma.UserIDs) == 0 {
+		return errors.New("at least one user ID is required")
+	}
+	if len(ma.UserIDs) >= MaxGroupMembers {
+		return errors.New("too many members")
+	}
+	return nil
+}
+
+// Validate validates the member role update data
+func (mu *MemberRoleUpdate) Validate() error {
+	if mu.Role != MemberRoleAdmin && mu.Role != MemberRoleMember {
+		return errors.New("role must be admin or member")
+	}
+	return nil
+}
+
+// validateConversationName trims and validates a group conversation name
+func validateConversationName(name *string) error {
+	*name = strings.TrimSpace(*name)
+	if *name == "" {
+		return errors.New("name is required")
+	}
+	if len(*name) > 50 {
+		return errors.New("name must be at most 50 characters")
+	}
+	return nil
+}
+
+// uniqueIDs trims IDs and drops blanks and duplicates, keeping their order
+func uniqueIDs(ids []string) []string {
+	seen := make(map[string]bool, len(ids))
+	unique := make([]string, 0, len(ids))
+	for _, id := range ids {
+		id = strings.TrimSpace(id)
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		unique = append(unique, id)
+	}
+	return unique
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestConversationCreationValidate(t *testing.T) {
+	many := make([]string, MaxGroupMembers)
+	for i := range many {
+		many[i] = strings.Repeat("u", i+1)
+	}
+
+	tests := []struct {
+		name        string
+		creation    ConversationCreation
+		wantName    string
+		wantMembers []string
+		wantErr     string
+	}{
+		{"trims and deduplicates", ConversationCreation{Name: " Team ", MemberIDs: []string{"b", " a", "b", ""}}, "Team", []string{"b", "a"}, ""},
+		{"missing name", ConversationCreation{Name: "  ", MemberIDs: []string{"a"}}, "", nil, "name is required"},
+		{"long name", ConversationCreation{Name: strings.Repeat("n", 51), MemberIDs: []string{"a"}}, "", nil, "at most 50"},
+		{"no members", ConversationCreation{Name: "Team", MemberIDs: []string{" ", ""}}, "", nil, "at least one other member"},
+		{"too many members", ConversationCreation{Name: "Team", MemberIDs: many}, "", nil, "too many members"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.creation.Validate()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.creation.Name != tt.wantName || !slices.Equal(tt.creation.MemberIDs, tt.wantMembers) {
+				t.Errorf("got %q %v, want %q %v", tt.creation.Name, tt.creation.MemberIDs, tt.wantName, tt.wantMembers)
+			}
+		})
+	}
+}
+
+func TestCanManageMembers(t *testing.T) {
+	want := map[string]bool{MemberRoleCreator: true, MemberRoleAdmin: true, MemberRoleMember: false, "": false}
+	for role, allowed := range want {
+		if got := CanManageMembers(role); got != allowed {
+			t.Errorf("CanManageMembers(%q) = %v, want %v", role, got, allowed)
+		}
+	}
+}
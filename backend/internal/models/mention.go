@@ -0,0 +1,91 @@
+package models
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Mention target types
+const (
+	MentionTargetPost    = "post"
+	MentionTargetComment = "comment"
+	MentionTargetMessage = "message"
+)
+
+// MaxMentions is the most users one post, comment or message can mention
+const MaxMentions = 10
+
+// mentionPattern matches @nickname where the @ does not follow a word
+// character, so e-mail addresses are not mistaken for mentions
+var mentionPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_@])@([\p{L}\p{N}_.-]{3,20})`)
+
+// Mention records that a user was mentioned as @nickname in a post, comment or message
+type Mention struct {
+	ID string `json:"id"`
+	// The mentioned user
+	UserID         string `json:"user_id"`
+	AuthorID       string `json:"author_id"`
+	AuthorNickname string `json:"author_nickname,omitempty"`
+	// Where the mention appears; comments also carry their post, messages their conversation
+	TargetType     string `json:"target_type"`
+	PostID         string `json:"post_id,omitempty"`
+	CommentID      string `json:"comment_id,omitempty"`
+	MessageID      string `json:"message_id,omitempty"`
+	ConversationID string `json:"conversation_id,omitempty"`
+	// The start of the content the user was mentioned in
+	Excerpt   string     `json:"excerpt"`
+	CreatedAt time.Time  `json:"created_at"`
+	ReadAt    *time.Time `json:"read_at,omitempty"`
+}
+
+// MentionList represents a cursor-paginated list of mentions
+type MentionList struct {
+	Mentions []Mention `json:"mentions"`
+	PageInfo
+}
+
+// MentionsRead represents the mentions to mark as read; no IDs means all of them
+type MentionsRead struct {
+	IDs []string `json:"ids,omitempty"`
+}
+
+// Validate deduplicates the mention IDs and checks their number
+func (mr *MentionsRead) Validate() error {
+	mr.IDs = uniqueIDs(mr.IDs)
+	if len(mr.IDs) > 100 {
+		return errors.New("at most 100 mentions can be marked at once")
+	}
+	return nil
+}
+
+// ParseMentions returns the nicknames mentioned in content, each once, in order
+// of appearance and at most MaxMentions of them
+func ParseMentions(content string) []string {
+	var nicknames []string
+	seen := make(map[string]bool)
+	for _, match := range mentionPattern.FindAllStringSubmatch(content, -1) {
+		// A mention at the end of a sentence does not include the full stop
+		nickname := strings.TrimRight(match[1], ".-")
+		if utf8.RuneCountInString(nickname) < 3 || seen[nickname] {
+			continue
+		}
+		seen[nickname] = true
+		nicknames = append(nicknames, nickname)
+		if len(nicknames) == MaxMentions {
+			break
+		}
+	}
+	return nicknames
+}
+
+// MentionExcerpt shortens content to a single line of at most 100 characters
+func MentionExcerpt(content string) string {
+	excerpt := strings.Join(strings.Fields(content), " ")
+	if utf8.RuneCountInString(excerpt) <= 100 {
+		return excerpt
+	}
+	return string([]rune(excerpt)[:100]) + "…"
+}
@@ -0,0 +1,71 @@
+package models
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseMentions(t *testing.T) {
+	var many []string
+	for i := 0; i < MaxMentions+2; i++ {
+		many = append(many, fmt.Sprintf("@user%d", i))
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{"none", "hello world", nil},
+		{"single", "hi @alice", []string{"alice"}},
+		{"start of text", "@bob hi", []string{"bob"}},
+		{"order and duplicates", "@bob @alice @bob", []string{"bob", "alice"}},
+		{"trailing full stop", "thanks @carol.", []string{"carol"}},
+		{"email address", "mail me@example.com", nil},
+		{"double at", "@@dave", nil},
+		{"too short", "@al", nil},
+		{"unicode", "merci @zoé!", []string{"zoé"}},
+		{"capped", strings.Join(many, " "), nicknamesOf(many[:MaxMentions])},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseMentions(tt.content); !slices.Equal(got, tt.want) {
+				t.Errorf("ParseMentions(%q) = %v, want %v", tt.content, got, tt.want)
+			}
+		})
+	}
+}
+
+// nicknamesOf strips the @ from mentions
+func nicknamesOf(mentions []string) []string {
+	var nicknames []string
+	for _, mention := range mentions {
+		nicknames = append(nicknames, strings.TrimPrefix(mention, "@"))
+	}
+	return nicknames
+}
+
+func TestMentionExcerpt(t *testing.T) {
+	long := strings.Repeat("é", 120)
+
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"collapses whitespace", " a\n\tb  c ", "a b c"},
+		{"exactly the limit", long[:200], long[:200]},
+		{"truncated by rune", long, strings.Repeat("é", 100) + "…"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MentionExcerpt(tt.content); got != tt.want {
+				t.Errorf("MentionExcerpt = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
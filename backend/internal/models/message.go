@@ -6,41 +6,90 @@ import (
 	"time"
 )
 
-// Message represents a private message between users
+// Message represents a private message in a conversation
 type Message struct {
-	ID         string    `json:"id"`
-	SenderID   string    `json:"sender_id"`
-	ReceiverID string    `json:"receiver_id"`
+	ID             string `json:"id"`
+	ConversationID string `json:"conversation_id"`
+	SenderID       string `json:"sender_id"`
+	// ReceiverID is the other member of a direct conversation
+	ReceiverID string    `json:"receiver_id,omitempty"`
 	Content    string    `json:"content"`
 	CreatedAt  time.Time `json:"created_at"`
-	IsRead     bool      `json:"is_read"`
+	// How the content is written, and for Markdown its sanitized HTML rendering
+	Format      string `json:"format"`
+	ContentHTML string `json:"content_html,omitempty"`
+	// IsRead reports whether every other member has read the message
+	IsRead   bool       `json:"is_read"`
+	EditedAt *time.Time `json:"edited_at,omitempty"`
+	// A message deleted for everyone is kept as a tombstone without content
+	Deleted   bool       `json:"deleted,omitempty"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	// Uploaded files attached to the message, visible to members only
+	Attachments []Attachment `json:"attachments,omitempty"`
 	// User information for display
 	SenderNickname   string `json:"sender_nickname,omitempty"`
 	ReceiverNickname string `json:"receiver_nickname,omitempty"`
 }
 
-// MessageCreation represents the data needed to create a message
+// MessageCreation represents the data needed to create a message. A direct
+// message names its receiver; any other message names its conversation.
 type MessageCreation struct {
-	ReceiverID string `json:"receiver_id"`
-	Content    string `json:"content"`
+	ReceiverID     string `json:"receiver_id,omitempty"`
+	ConversationID string `json:"conversation_id,omitempty"`
+	Content        string `json:"content"`
+	// MessageFormatPlain (the default) or MessageFormatMarkdown
+	Format string `json:"format,omitempty"`
+	// Previously uploaded attachments to attach to the message
+	AttachmentIDs []string `json:"attachment_ids,omitempty"`
 }
 
-// Conversation represents a conversation between two users
+// Message content formats
+const (
+	// MessageFormatPlain content is shown as typed
+	MessageFormatPlain = "plain"
+	// MessageFormatMarkdown content is also rendered to sanitized HTML
+	MessageFormatMarkdown = "markdown"
+)
+
+// MessageEditWindow is how long after sending a message its sender can edit it
+const MessageEditWindow = 15 * time.Minute
+
+// Message deletion scopes
+const (
+	// DeleteForMe hides a message from the member who deleted it
+	DeleteForMe = "me"
+	// DeleteForEveryone replaces a message with a tombstone for every member
+	DeleteForEveryone = "everyone"
+)
+
+// MessageUpdate represents the data needed to edit a message
+type MessageUpdate struct {
+	Content string `json:"content"`
+}
+
+// Conversation represents a direct or group conversation as seen by one member
 type Conversation struct {
-	UserID       string    `json:"user_id"`
-	UserNickname string    `json:"user_nickname"`
-	LastMessage  *Message  `json:"last_message"`
-	UnreadCount  int       `json:"unread_count"`
+	ID        string    `json:"id"`
+	Kind      string    `json:"kind"`
+	Name      string    `json:"name,omitempty"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+	// The other member of a direct conversation
+	UserID       string    `json:"user_id,omitempty"`
+	UserNickname string    `json:"user_nickname,omitempty"`
 	IsOnline     bool      `json:"is_online"`
 	LastSeen     time.Time `json:"last_seen,omitempty"`
+	// Every member of a group conversation, and the caller's role in it
+	Members     []ConversationMember `json:"members,omitempty"`
+	MyRole      string               `json:"my_role,omitempty"`
+	LastMessage *Message             `json:"last_message"`
+	UnreadCount int                  `json:"unread_count"`
 }
 
-// MessageHistory represents paginated message history
+// MessageHistory represents cursor-paginated message history
 type MessageHistory struct {
-	Messages    []Message `json:"messages"`
-	HasMore     bool      `json:"has_more"`
-	TotalCount  int       `json:"total_count"`
-	CurrentPage int       `json:"current_page"`
+	Messages []Message `json:"messages"`
+	PageInfo
 }
 
 // UserStatus represents online/offline status
@@ -69,19 +118,47 @@ type MessageEvent struct {
 
 // Validate validates the message creation data
 func (mc *MessageCreation) Validate() error {
-	// Validate receiver ID
-	if strings.TrimSpace(mc.ReceiverID) == "" {
-		return errors.New("receiver ID is required")
+	// Validate the receiver or conversation
+	hasReceiver := strings.TrimSpace(mc.ReceiverID) != ""
+	hasConversation := strings.TrimSpace(mc.ConversationID) != ""
+	if !hasReceiver && !hasConversation {
+		return errors.New("receiver ID or conversation ID is required")
+	}
+	if hasReceiver && hasConversation {
+		return errors.New("only one of receiver ID and conversation ID can be set")
 	}
 
-	// Validate content
-	if strings.TrimSpace(mc.Content) == "" {
+	switch mc.Format {
+	case "":
+		mc.Format = MessageFormatPlain
+	case MessageFormatPlain, MessageFormatMarkdown:
+	default:
+		return errors.New("message format must be plain or markdown")
+	}
+
+	// A message with attachments may have no text
+	if err := validateAttachmentIDs(&mc.AttachmentIDs); err != nil {
+		return err
+	}
+	if len(mc.AttachmentIDs) > 0 && mc.Content == "" {
+		return nil
+	}
+	return validateMessageContent(mc.Content)
+}
+
+// Validate validates the message update data
+func (mu *MessageUpdate) Validate() error {
+	return validateMessageContent(mu.Content)
+}
+
+// validateMessageContent validates the content of a new or edited message
+func validateMessageContent(content string) error {
+	if strings.TrimSpace(content) == "" {
 		return errors.New("message content is required")
 	}
-	if len(mc.Content) > 1000 {
+	if len(content) > 1000 {
 		return errors.New("message content must be less than 1000 characters")
 	}
-
 	return nil
 }
 
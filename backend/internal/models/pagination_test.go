@@ -0,0 +1,67 @@
+package models
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	createdAt := time.Date(2024, 5, 1, 12, 30, 0, 123456789, time.UTC)
+	score := -3
+
+	tests := []struct {
+		name   string
+		cursor Cursor
+	}{
+		{"forward", Cursor{CreatedAt: createdAt, ID: "a"}},
+		{"backward", Cursor{CreatedAt: createdAt, ID: "b", Backward: true}},
+		{"score", Cursor{CreatedAt: createdAt, ID: "c", Score: &score}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decoded, err := DecodeCursor(tt.cursor.Encode())
+			if err != nil {
+				t.Fatalf("DecodeCursor: %v", err)
+			}
+			if !decoded.CreatedAt.Equal(tt.cursor.CreatedAt) || decoded.ID != tt.cursor.ID || decoded.Backward != tt.cursor.Backward {
+				t.Errorf("got %+v, want %+v", decoded, tt.cursor)
+			}
+			if (decoded.Score == nil) != (tt.cursor.Score == nil) || (decoded.Score != nil && *decoded.Score != *tt.cursor.Score) {
+				t.Errorf("score = %v, want %v", decoded.Score, tt.cursor.Score)
+			}
+		})
+	}
+}
+
+func TestDecodeCursor(t *testing.T) {
+	encode := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+
+	tests := []struct {
+		name    string
+		encoded string
+		wantNil bool
+		wantErr bool
+	}{
+		{"empty", "", true, false},
+		{"valid", encode(`{"t":"2024-05-01T12:00:00Z","i":"x"}`), false, false},
+		{"not base64", "!!!", true, true},
+		{"not json", encode("cursor"), true, true},
+		{"missing id", encode(`{"t":"2024-05-01T12:00:00Z"}`), true, true},
+		{"missing time", encode(`{"i":"x"}`), true, true},
+		{"bad time", encode(`{"t":"yesterday","i":"x"}`), true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cursor, err := DecodeCursor(tt.encoded)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if (cursor == nil) != tt.wantNil {
+				t.Errorf("cursor = %+v, wantNil %v", cursor, tt.wantNil)
+			}
+		})
+	}
+}
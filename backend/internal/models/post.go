@@ -12,12 +12,24 @@ type Post struct {
 	UserID    string    `json:"user_id"`
 	Title     string    `json:"title"`
 	Content   string    `json:"content"`
-	Category  string    `json:"category"`
 	CreatedAt time.Time `json:"created_at"`
+	// Content rendered from Markdown and sanitized
+	ContentHTML string `json:"content_html"`
+	// Categories in the order they were given, and free-form tags
+	Categories []string `json:"categories"`
+	Tags       []string `json:"tags"`
+	// Set once the post has been edited
+	EditedAt *time.Time `json:"edited_at,omitempty"`
+	// Locked posts accept no new comments or edits
+	Locked bool `json:"locked"`
 	// User information for display
 	UserNickname string `json:"user_nickname,omitempty"`
 	// Comment count for feed display
 	CommentCount int `json:"comment_count,omitempty"`
+	// Reaction totals and the viewer's own reaction
+	ReactionSummary
+	// Uploaded files attached to the post
+	Attachments []Attachment `json:"attachments,omitempty"`
 }
 
 // Comment represents a comment on a post
@@ -27,26 +39,71 @@ type Comment struct {
 	UserID    string    `json:"user_id"`
 	Content   string    `json:"content"`
 	CreatedAt time.Time `json:"created_at"`
+	// Content rendered from Markdown and sanitized
+	ContentHTML string `json:"content_html"`
+	// Set once the comment has been edited
+	EditedAt *time.Time `json:"edited_at,omitempty"`
+	// Threading: the comment this one replies to, and its nesting level (0 = top level)
+	ParentID string `json:"parent_id,omitempty"`
+	Depth    int    `json:"depth"`
 	// User information for display
 	UserNickname string `json:"user_nickname,omitempty"`
+	// Reaction totals and the viewer's own reaction
+	ReactionSummary
+	// Direct replies, nested for display
+	ReplyCount int       `json:"reply_count"`
+	Replies    []Comment `json:"replies,omitempty"`
 }
 
+// Post feed sort orders
+const (
+	PostSortNew = "new"
+	PostSortTop = "top"
+)
+
+// MaxCommentDepth is the deepest nesting level a reply may have
+const MaxCommentDepth = 5
+
+// Limits on how a post can be categorized and tagged
+const (
+	MaxPostCategories = 3
+	MaxPostTags       = 5
+)
+
 // PostCreation represents the data needed to create a post
 type PostCreation struct {
-	Title    string `json:"title"`
-	Content  string `json:"content"`
-	Category string `json:"category"`
+	Title      string   `json:"title"`
+	Content    string   `json:"content"`
+	Categories []string `json:"categories"`
+	Tags       []string `json:"tags"`
+	// Single category accepted from older clients
+	Category string `json:"category,omitempty"`
+	// Previously uploaded attachments to attach to the post
+	AttachmentIDs []string `json:"attachment_ids,omitempty"`
+}
+
+// TagFilter selects posts by category and tag
+type TagFilter struct {
+	Categories []string
+	Tags       []string
+	// Whether posts must match every category and tag rather than any of them
+	MatchAll bool
 }
 
 // CommentCreation represents the data needed to create a comment
 type CommentCreation struct {
-	Content string `json:"content"`
+	Content  string `json:"content"`
+	ParentID string `json:"parent_id,omitempty"`
+	// Depth is resolved from the parent comment before validation
+	Depth int `json:"-"`
 }
 
 // PostWithComments represents a post with its comments
 type PostWithComments struct {
 	Post     Post      `json:"post"`
 	Comments []Comment `json:"comments"`
+	// Cursors for paging through the comments
+	PageInfo
 }
 
 // Validate validates the post creation data
@@ -67,21 +124,49 @@ func (pc *PostCreation) Validate() error {
 		return errors.New("content must be between 10 and 5000 characters")
 	}
 
-	// Validate category
-	if strings.TrimSpace(pc.Category) == "" {
-		return errors.New("category is required")
+	// Validate categories; whether they exist is checked against the database
+	if len(pc.Categories) == 0 {
+		return errors.New("at least one category is required")
+	}
+	if len(pc.Categories) > MaxPostCategories {
+		return errors.New("a post can have at most 3 categories")
 	}
 
-	validCategories := []string{
-		"general", "technology", "gaming", "sports", "music",
-		"movies", "books", "food", "travel", "science", "other",
+	// Validate tags
+	if len(pc.Tags) > MaxPostTags {
+		return errors.New("a post can have at most 5 tags")
+	}
+	for _, tag := range pc.Tags {
+		if len(tag) < 2 || len(tag) > 30 || !categorySlugPattern.MatchString(tag) {
+			return errors.New("tags must be 2 to 30 lowercase letters, numbers, or single hyphens")
+		}
 	}
 
-	if !Contains(validCategories, strings.ToLower(pc.Category)) {
-		return errors.New("invalid category")
+	return validateAttachmentIDs(&pc.AttachmentIDs)
+}
+
+// Normalize folds the legacy single category into the category list and
+// lowercases and de-duplicates categories and tags
+func (pc *PostCreation) Normalize() {
+	if len(pc.Categories) == 0 && pc.Category != "" {
+		pc.Categories = []string{pc.Category}
 	}
+	pc.Category = ""
+	pc.Categories = NormalizeTags(pc.Categories)
+	pc.Tags = NormalizeTags(pc.Tags)
+}
 
-	return nil
+// NormalizeTags trims, lowercases and de-duplicates a list of categories or
+// tags, keeping their order
+func NormalizeTags(tags []string) []string {
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag != "" && !Contains(normalized, tag) {
+			normalized = append(normalized, tag)
+		}
+	}
+	return normalized
 }
 
 // Validate validates the comment creation data
@@ -94,13 +179,10 @@ func (cc *CommentCreation) Validate() error {
 		return errors.New("comment must be between 1 and 1000 characters")
 	}
 
-	return nil
-}
-
-// GetValidCategories returns the list of valid post categories
-func GetValidCategories() []string {
-	return []string{
-		"general", "technology", "gaming", "sports", "music",
-		"movies", "books", "food", "travel", "science", "other",
+	// Validate nesting
+	if cc.Depth > MaxCommentDepth {
+		return errors.New("replies cannot be nested more than 5 levels deep")
 	}
+
+	return nil
 }
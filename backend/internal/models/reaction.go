@@ -0,0 +1,66 @@
+package models
+
+import (
+	"errors"
+	"strings"
+)
+
+// Reaction target types
+const (
+	ReactionTargetPost    = "post"
+	ReactionTargetComment = "comment"
+)
+
+// ReactionSummary aggregates the reactions on a post or comment
+type ReactionSummary struct {
+	Reactions map[string]int `json:"reactions,omitempty"`
+	Score     int            `json:"score"`
+	// The requesting user's own reaction, if any
+	MyReaction string `json:"my_reaction,omitempty"`
+}
+
+// ReactionToggle represents the data needed to toggle a reaction
+type ReactionToggle struct {
+	Reaction string `json:"reaction"`
+}
+
+// ReactionUpdate describes a reaction change and the target's new totals
+type ReactionUpdate struct {
+	TargetType string         `json:"target_type"`
+	TargetID   string         `json:"target_id"`
+	PostID     string         `json:"post_id"`
+	UserID     string         `json:"user_id"`
+	Reaction   string         `json:"reaction"` // Empty when the reaction was removed
+	Reactions  map[string]int `json:"reactions"`
+	Score      int            `json:"score"`
+}
+
+// Validate validates the reaction toggle data
+func (rt *ReactionToggle) Validate() error {
+	rt.Reaction = strings.ToLower(strings.TrimSpace(rt.Reaction))
+	if rt.Reaction == "" {
+		return errors.New("reaction is required")
+	}
+	if !Contains(GetValidReactions(), rt.Reaction) {
+		return errors.New("invalid reaction")
+	}
+	return nil
+}
+
+// GetValidReactions returns the list of valid reactions
+func GetValidReactions() []string {
+	return []string{
+		"like", "dislike", "love", "laugh", "wow", "sad", "angry",
+	}
+}
+
+// ReactionScore returns how much a reaction contributes to a score
+func ReactionScore(reaction string) int {
+	switch reaction {
+	case "like":
+		return 1
+	case "dislike":
+		return -1
+	}
+	return 0
+}
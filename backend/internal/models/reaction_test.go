@@ -0,0 +1,39 @@
+package models
+
+import "testing"
+
+func TestReactionToggleValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		reaction string
+		want     string
+		wantErr  bool
+	}{
+		{"like", "like", "like", false},
+		{"normalised", "  Laugh ", "laugh", false},
+		{"empty", "  ", "", true},
+		{"unknown", "meh", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			toggle := ReactionToggle{Reaction: tt.reaction}
+			err := toggle.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && toggle.Reaction != tt.want {
+				t.Errorf("Reaction = %q, want %q", toggle.Reaction, tt.want)
+			}
+		})
+	}
+}
+
+func TestReactionScore(t *testing.T) {
+	want := map[string]int{"like": 1, "dislike": -1}
+	for _, reaction := range GetValidReactions() {
+		if got := ReactionScore(reaction); got != want[reaction] {
+			t.Errorf("ReactionScore(%q) = %d, want %d", reaction, got, want[reaction])
+		}
+	}
+}
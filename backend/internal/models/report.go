@@ -0,0 +1,114 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// Report target types
+const (
+	ReportTargetPost    = "post"
+	ReportTargetComment = "comment"
+	ReportTargetMessage = "message"
+)
+
+// ReportStatus is where a report is in the moderation queue
+type ReportStatus string
+
+// Report statuses
+const (
+	ReportOpen      ReportStatus = "open"
+	ReportActioned  ReportStatus = "actioned"
+	ReportDismissed ReportStatus = "dismissed"
+)
+
+// Valid reports whether the status is one of the known statuses
+func (s ReportStatus) Valid() bool {
+	return s == ReportOpen || s == ReportActioned || s == ReportDismissed
+}
+
+// CanTransitionTo reports whether a report may move from this status to another.
+// Open reports are resolved as actioned or dismissed, and resolved reports can be reopened.
+func (s ReportStatus) CanTransitionTo(next ReportStatus) bool {
+	if s == ReportOpen {
+		return next == ReportActioned || next == ReportDismissed
+	}
+	return next == ReportOpen
+}
+
+// Report represents a user's report of a post, comment or message
+type Report struct {
+	ID               string `json:"id"`
+	ReporterID       string `json:"reporter_id"`
+	ReporterNickname string `json:"reporter_nickname,omitempty"`
+	TargetType       string `json:"target_type"`
+	TargetID         string `json:"target_id"`
+	TargetUserID     string `json:"target_user_id"`
+	TargetNickname   string `json:"target_nickname,omitempty"`
+	// TargetContent is the reported content as it was when the report was made
+	TargetContent string         `json:"target_content"`
+	Reason        string         `json:"reason"`
+	Status        ReportStatus   `json:"status"`
+	CreatedAt     time.Time      `json:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+	Actions       []ReportAction `json:"actions,omitempty"`
+}
+
+// ReportAction is an entry in a report's audit trail
+type ReportAction struct {
+	ActorID       string       `json:"actor_id"`
+	ActorNickname string       `json:"actor_nickname,omitempty"`
+	FromStatus    ReportStatus `json:"from_status,omitempty"`
+	ToStatus      ReportStatus `json:"to_status"`
+	Note          string       `json:"note,omitempty"`
+	CreatedAt     time.Time    `json:"created_at"`
+}
+
+// ReportCreation represents the data needed to report content
+type ReportCreation struct {
+	TargetType string `json:"target_type"`
+	TargetID   string `json:"target_id"`
+	Reason     string `json:"reason"`
+}
+
+// ReportStatusUpdate represents a moderator's decision on a report
+type ReportStatusUpdate struct {
+	Status ReportStatus `json:"status"`
+	Note   string       `json:"note"`
+}
+
+// ReportQueue represents a cursor-paginated page of the moderation queue
+type ReportQueue struct {
+	Reports []Report `json:"reports"`
+	PageInfo
+}
+
+// Validate validates the report creation data
+func (rc *ReportCreation) Validate() error {
+	if rc.TargetType != ReportTargetPost && rc.TargetType != ReportTargetComment && rc.TargetType != ReportTargetMessage {
+		return errors.New("target type must be post, comment or message")
+	}
+	if strings.TrimSpace(rc.TargetID) == "" {
+		return errors.New("target ID is required")
+	}
+
+	rc.Reason = strings.TrimSpace(rc.Reason)
+	if len(rc.Reason) < 3 || len(rc.Reason) > 500 {
+		return errors.New("reason must be between 3 and 500 characters")
+	}
+	return nil
+}
+
+// Validate validates the report status update data
+func (ru *ReportStatusUpdate) Validate() error {
+	if !ru.Status.Valid() {
+		return errors.New("status must be open, actioned or dismissed")
+	}
+
+	ru.Note = strings.TrimSpace(ru.Note)
+	if len(ru.Note) > 500 {
+		return errors.New("note must be at most 500 characters")
+	}
+	return nil
+}
@@ -0,0 +1,21 @@
+package models
+
+import "testing"
+
+func TestReportStatusCanTransitionTo(t *testing.T) {
+	statuses := []ReportStatus{ReportOpen, ReportActioned, ReportDismissed}
+
+	allowed := map[ReportStatus]map[ReportStatus]bool{
+		ReportOpen:      {ReportActioned: true, ReportDismissed: true},
+		ReportActioned:  {ReportOpen: true},
+		ReportDismissed: {ReportOpen: true},
+	}
+
+	for _, from := range statuses {
+		for _, to := range statuses {
+			if got := from.CanTransitionTo(to); got != allowed[from][to] {
+				t.Errorf("%s -> %s = %v, want %v", from, to, got, allowed[from][to])
+			}
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// Revision represents one version of a post or comment
+type Revision struct {
+	Version   int       `json:"version"`
+	Title     string    `json:"title,omitempty"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+	// Who replaced this version with the next one, empty for the current version
+	ReplacedBy string `json:"replaced_by,omitempty"`
+	// Changes from the previous version, empty for the first version
+	TitleDiff   []DiffLine `json:"title_diff,omitempty"`
+	ContentDiff []DiffLine `json:"content_diff,omitempty"`
+}
+
+// DiffLine is one line of a line-based diff
+type DiffLine struct {
+	Op   string `json:"op"` // "equal", "insert" or "delete"
+	Text string `json:"text"`
+}
+
+// PostUpdate represents the data needed to edit a post
+type PostUpdate struct {
+	Title   string `json:"title"`
+	Content string `json:"content"`
+}
+
+// CommentUpdate represents the data needed to edit a comment
+type CommentUpdate struct {
+	Content string `json:"content"`
+}
+
+// Validate validates the post update data
+func (pu *PostUpdate) Validate() error {
+	// Validate title
+	if strings.TrimSpace(pu.Title) == "" {
+		return errors.New("title is required")
+	}
+	if len(pu.Title) < 3 || len(pu.Title) > 100 {
+		return errors.New("title must be between 3 and 100 characters")
+	}
+
+	// Validate content
+	if strings.TrimSpace(pu.Content) == "" {
+		return errors.New("content is required")
+	}
+	if len(pu.Content) < 10 || len(pu.Content) > 5000 {
+		return errors.New("content must be between 10 and 5000 characters")
+	}
+
+	return nil
+}
+
+// Validate validates the comment update data
+func (cu *CommentUpdate) Validate() error {
+	if strings.TrimSpace(cu.Content) == "" {
+		return errors.New("comment content is required")
+	}
+	if len(cu.Content) > 1000 {
+		return errors.New("comment must be between 1 and 1000 characters")
+	}
+	return nil
+}
+
+// Largest LCS table DiffLines will build, in cells. Above it the changed
+// middle of the texts is reported as a plain replacement.
+const maxDiffCells = 250000
+
+// DiffLines returns a line-based diff turning oldText into newText
+func DiffLines(oldText, newText string) []DiffLine {
+	a := strings.Split(oldText, "\n")
+	b := strings.Split(newText, "\n")
+
+	// Lines shared at the start and end need no table
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var diff []DiffLine
+	for _, line := range a[:prefix] {
+		diff = append(diff, DiffLine{Op: "equal", Text: line})
+	}
+	diff = append(diff, diffMiddle(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, line := range a[len(a)-suffix:] {
+		diff = append(diff, DiffLine{Op: "equal", Text: line})
+	}
+
+	return diff
+}
+
+// diffMiddle diffs the lines between the common prefix and suffix
+func diffMiddle(a, b []string) []DiffLine {
+	var diff []DiffLine
+
+	if (len(a)+1)*(len(b)+1) > maxDiffCells {
+		for _, line := range a {
+			diff = append(diff, DiffLine{Op: "delete", Text: line})
+		}
+		for _, line := range b {
+			diff = append(diff, DiffLine{Op: "insert", Text: line})
+		}
+		return diff
+	}
+
+	// Longest common subsequence table, filled from the end
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			diff = append(diff, DiffLine{Op: "equal", Text: a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			diff = append(diff, DiffLine{Op: "delete", Text: a[i]})
+			i++
+		default:
+			diff = append(diff, DiffLine{Op: "insert", Text: b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		diff = append(diff, DiffLine{Op: "delete", Text: a[i]})
+	}
+	for ; j < len(b); j++ {
+		diff = append(diff, DiffLine{Op: "insert", Text: b[j]})
+	}
+
+	return diff
+}
@@ -0,0 +1,65 @@
+package models
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiffLines(t *testing.T) {
+	eq := func(text string) DiffLine { return DiffLine{Op: "equal", Text: text} }
+	ins := func(text string) DiffLine { return DiffLine{Op: "insert", Text: text} }
+	del := func(text string) DiffLine { return DiffLine{Op: "delete", Text: text} }
+
+	tests := []struct {
+		name    string
+		oldText string
+		newText string
+		want    []DiffLine
+	}{
+		{"unchanged", "a\nb", "a\nb", []DiffLine{eq("a"), eq("b")}},
+		{"changed line", "a\nb\nc", "a\nx\nc", []DiffLine{eq("a"), del("b"), ins("x"), eq("c")}},
+		{"appended", "a", "a\nb", []DiffLine{eq("a"), ins("b")}},
+		{"prepended", "b", "a\nb", []DiffLine{ins("a"), eq("b")}},
+		{"removed middle", "a\nb\nc", "a\nc", []DiffLine{eq("a"), del("b"), eq("c")}},
+		{"moved line", "a\nb\nc", "b\nc\na", []DiffLine{del("a"), eq("b"), eq("c"), ins("a")}},
+		{"from empty", "", "a", []DiffLine{del(""), ins("a")}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DiffLines(tt.oldText, tt.newText); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DiffLines(%q, %q)\n got: %v\nwant: %v", tt.oldText, tt.newText, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffLinesLargeInput(t *testing.T) {
+	// 2500 distinct lines a side would need a table of over six million cells
+	var oldLines, newLines []string
+	for i := 0; i < 2500; i++ {
+		oldLines = append(oldLines, "o"+strings.Repeat("x", i%7))
+		newLines = append(newLines, "n"+strings.Repeat("y", i%7))
+	}
+	oldText := "head\n" + strings.Join(oldLines, "\n") + "\ntail"
+	newText := "head\n" + strings.Join(newLines, "\n") + "\ntail"
+
+	diff := DiffLines(oldText, newText)
+	if len(diff) != 5002 {
+		t.Fatalf("len(diff) = %d, want 5002", len(diff))
+	}
+	if diff[0] != (DiffLine{Op: "equal", Text: "head"}) || diff[len(diff)-1] != (DiffLine{Op: "equal", Text: "tail"}) {
+		t.Errorf("common prefix or suffix was not kept: %v ... %v", diff[0], diff[len(diff)-1])
+	}
+	for _, line := range diff[1:2501] {
+		if line.Op != "delete" {
+			t.Fatalf("expected the old lines to be deleted, got %v", line)
+		}
+	}
+	for _, line := range diff[2501:5001] {
+		if line.Op != "insert" {
+			t.Fatalf("expected the new lines to be inserted, got %v", line)
+		}
+	}
+}
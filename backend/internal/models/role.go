@@ -0,0 +1,68 @@
+package models
+
+import "errors"
+
+// Role is a user's access level
+type Role string
+
+// User roles, from least to most privileged
+const (
+	RoleUser      Role = "user"
+	RoleModerator Role = "moderator"
+	RoleAdmin     Role = "admin"
+)
+
+// Permission is an action that needs more than ownership of the content
+type Permission string
+
+// Permissions granted by roles
+const (
+	PermDeleteAnyPost    Permission = "delete_any_post"
+	PermDeleteAnyComment Permission = "delete_any_comment"
+	PermLockPost         Permission = "lock_post"
+	PermReviewReports    Permission = "review_reports"
+	PermManageCategories Permission = "manage_categories"
+	PermManageUsers      Permission = "manage_users"
+)
+
+// rolePermissions lists what each role may do; admins may do everything
+var rolePermissions = map[Role][]Permission{
+	RoleModerator: {PermDeleteAnyPost, PermDeleteAnyComment, PermLockPost, PermReviewReports},
+	RoleAdmin: {
+		PermDeleteAnyPost, PermDeleteAnyComment, PermLockPost, PermReviewReports,
+		PermManageCategories, PermManageUsers,
+	},
+}
+
+// Can reports whether the role grants a permission
+func (r Role) Can(permission Permission) bool {
+	for _, granted := range rolePermissions[r] {
+		if granted == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// Valid reports whether the role is one of the known roles
+func (r Role) Valid() bool {
+	return r == RoleUser || r == RoleModerator || r == RoleAdmin
+}
+
+// RoleUpdate represents the data needed to change a user's role
+type RoleUpdate struct {
+	Role Role `json:"role"`
+}
+
+// Validate validates the role update data
+func (ru *RoleUpdate) Validate() error {
+	if !ru.Role.Valid() {
+		return errors.New("role must be user, moderator or admin")
+	}
+	return nil
+}
+
+// PostLock represents the data needed to lock or unlock a post
+type PostLock struct {
+	Locked bool `json:"locked"`
+}
@@ -0,0 +1,56 @@
+package models
+
+import "testing"
+
+func TestRoleCan(t *testing.T) {
+	permissions := []Permission{
+		PermDeleteAnyPost, PermDeleteAnyComment, PermLockPost, PermReviewReports,
+		PermManageCategories, PermManageUsers,
+	}
+
+	tests := []struct {
+		role Role
+		want map[Permission]bool
+	}{
+		{RoleUser, map[Permission]bool{}},
+		{RoleModerator, map[Permission]bool{
+			PermDeleteAnyPost: true, PermDeleteAnyComment: true, PermLockPost: true, PermReviewReports: true,
+		}},
+		{RoleAdmin, map[Permission]bool{
+			PermDeleteAnyPost: true, PermDeleteAnyComment: true, PermLockPost: true, PermReviewReports: true,
+			PermManageCategories: true, PermManageUsers: true,
+		}},
+		{Role("owner"), map[Permission]bool{}},
+		{Role(""), map[Permission]bool{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.role), func(t *testing.T) {
+			for _, permission := range permissions {
+				if got := tt.role.Can(permission); got != tt.want[permission] {
+					t.Errorf("%q.Can(%q) = %v, want %v", tt.role, permission, got, tt.want[permission])
+				}
+			}
+		})
+	}
+}
+
+func TestRoleUpdateValidate(t *testing.T) {
+	tests := []struct {
+		role    Role
+		wantErr bool
+	}{
+		{RoleUser, false},
+		{RoleModerator, false},
+		{RoleAdmin, false},
+		{Role("Admin"), true},
+		{Role(""), true},
+	}
+
+	for _, tt := range tests {
+		update := RoleUpdate{Role: tt.role}
+		if err := update.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("Validate(%q) = %v, wantErr %v", tt.role, err, tt.wantErr)
+		}
+	}
+}
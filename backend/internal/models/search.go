@@ -0,0 +1,69 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// Search scopes
+const (
+	SearchScopeAll      = "all"
+	SearchScopePosts    = "posts"
+	SearchScopeComments = "comments"
+	SearchScopeMessages = "messages"
+)
+
+// SearchQuery represents a full-text search request
+type SearchQuery struct {
+	Query    string
+	Scope    string
+	Category string
+	Author   string
+	From     *time.Time
+	To       *time.Time
+	Limit    int
+}
+
+// SearchResult represents one ranked search hit
+type SearchResult struct {
+	Type   string `json:"type"` // "post", "comment" or "message"
+	ID     string `json:"id"`
+	PostID string `json:"post_id,omitempty"`
+	Title  string `json:"title,omitempty"`
+	// Categories of the post, or of the post a comment is on
+	Categories []string `json:"categories,omitempty"`
+	// Matching excerpt, HTML-escaped with matches wrapped in <mark> tags
+	Snippet      string `json:"snippet"`
+	UserID       string `json:"user_id"`
+	UserNickname string `json:"user_nickname"`
+	// ReceiverID is set for direct messages; ConversationID for every message
+	ReceiverID     string    `json:"receiver_id,omitempty"`
+	ConversationID string    `json:"conversation_id,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+	// Relevance within results of the same type, from 0 to 1 where the best
+	// scores 1. Always 0 when search falls back to LIKE matching.
+	Score float64 `json:"score"`
+}
+
+// Validate validates the search query
+func (sq *SearchQuery) Validate() error {
+	if len(strings.TrimSpace(sq.Query)) < 2 {
+		return errors.New("search query must be at least 2 characters")
+	}
+	if len(sq.Query) > 200 {
+		return errors.New("search query must be at most 200 characters")
+	}
+
+	switch sq.Scope {
+	case SearchScopeAll, SearchScopePosts, SearchScopeComments, SearchScopeMessages:
+	default:
+		return errors.New("scope must be all, posts, comments or messages")
+	}
+
+	if sq.From != nil && sq.To != nil && sq.To.Before(*sq.From) {
+		return errors.New("to must not be before from")
+	}
+
+	return nil
+}
@@ -17,6 +17,7 @@ type User struct {
 	LastName  string    `json:"last_name"`
 	Email     string    `json:"email"`
 	Password  string    `json:"-"` // Never include password in JSON responses
+	Role      Role      `json:"role"`
 	CreatedAt time.Time `json:"created_at"`
 }
 
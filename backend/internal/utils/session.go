@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/Tomlee-abila/real_time_forum/backend/internal/database"
+	"github.com/Tomlee-abila/real_time_forum/backend/internal/models"
 	"github.com/google/uuid"
 )
 
@@ -17,6 +18,8 @@ type Session struct {
 	UserID    string    `json:"user_id"`
 	Token     string    `json:"token"`
 	ExpiresAt time.Time `json:"expires_at"`
+	// Role of the session's user, read when the session is loaded
+	Role models.Role `json:"role"`
 }
 
 // CreateSession creates a new session for a user
@@ -40,25 +43,32 @@ func CreateSession(userID string) (*Session, error) {
 		return nil, fmt.Errorf("failed to create session: %w", err)
 	}
 
+	role, err := database.GetUserRole(userID)
+	if err != nil {
+		return nil, err
+	}
+
 	return &Session{
 		ID:        sessionID,
 		UserID:    userID,
 		Token:     token,
 		ExpiresAt: expiresAt,
+		Role:      role,
 	}, nil
 }
 
 // GetSessionByToken retrieves a session by token
 func GetSessionByToken(token string) (*Session, error) {
 	query := `
-        SELECT id, user_id, token, expires_at
-        FROM sessions 
-        WHERE token = ? AND expires_at > ?
+        SELECT s.id, s.user_id, s.token, s.expires_at, u.role
+        FROM sessions s
+        JOIN users u ON s.user_id = u.id
+        WHERE s.token = ? AND s.expires_at > ?
     `
 
 	var session Session
 	err := database.DB.QueryRow(query, token, time.Now()).Scan(
-		&session.ID, &session.UserID, &session.Token, &session.ExpiresAt,
+		&session.ID, &session.UserID, &session.Token, &session.ExpiresAt, &session.Role,
 	)
 
 	if err != nil {
@@ -0,0 +1,73 @@
+package websocket
+
+import (
+	"log"
+	"strings"
+
+	"github.com/Tomlee-abila/real_time_forum/backend/internal/database"
+)
+
+// ApplyBlock cuts off live events between a newly blocked pair: active typing
+// indicators are stopped and each side sees the other go offline. The events
+// are queued on the hub, so API handlers can call it directly.
+func (h *Hub) ApplyBlock(blockerID, blockedID string) {
+	// Typing in the pair's direct conversation is keyed by conversation, not receiver
+	conversationID, err := database.GetDirectConversationID(blockerID, blockedID)
+	if err != nil && !strings.Contains(err.Error(), "conversation not found") {
+		log.Printf("Error getting direct conversation of %s and %s: %v", blockerID, blockedID, err)
+	}
+	h.stopPairTyping(blockerID, blockedID, conversationID)
+
+	h.sendPeerPresence(blockerID, blockedID, false)
+	h.sendPeerPresence(blockedID, blockerID, false)
+}
+
+// stopPairTyping stops the typing indicators two users show each other, by
+// receiver and, when they have one, in their direct conversation
+func (h *Hub) stopPairTyping(userID1, userID2, conversationID string) {
+	for _, pair := range [][2]string{{userID1, userID2}, {userID2, userID1}} {
+		h.stopTyping(typingKey{senderID: pair[0], receiverID: pair[1]})
+		if conversationID != "" {
+			h.stopTyping(typingKey{senderID: pair[0], conversationID: conversationID})
+		}
+	}
+}
+
+// ApplyUnblock restores presence between a pair once no block remains in either direction
+func (h *Hub) ApplyUnblock(blockerID, blockedID string) {
+	blocked, err := database.IsBlockedBetween(blockerID, blockedID)
+	if err != nil {
+		log.Printf("Error checking block between %s and %s: %v", blockerID, blockedID, err)
+		return
+	}
+	if blocked {
+		return
+	}
+
+	h.sendPeerPresence(blockerID, blockedID, true)
+	h.sendPeerPresence(blockedID, blockerID, true)
+}
+
+// sendPeerPresence queues an event telling a user whether a connected peer
+// should be shown online. Nothing is sent when the peer is not connected.
+func (h *Hub) sendPeerPresence(userID, peerID string, visible bool) {
+	if h.GetUserSessionCount(peerID) == 0 {
+		return
+	}
+
+	status, err := database.GetUserStatus(peerID)
+	if err != nil {
+		log.Printf("Error getting status for user %s: %v", peerID, err)
+		return
+	}
+
+	eventType := EventUserOnline
+	if !visible {
+		eventType = EventUserOffline
+		status.IsOnline = false
+	}
+	h.queue(&BroadcastMessage{
+		event:      CreateUserStatusEvent(eventType, status),
+		targetUser: userID,
+	})
+}
@@ -0,0 +1,60 @@
+package websocket
+
+import (
+	"testing"
+	"time"
+)
+
+// trackTyping registers an active typing indicator without resolving its targets
+func trackTyping(h *Hub, key typingKey, targets ...string) {
+	h.typing.mutex.Lock()
+	defer h.typing.mutex.Unlock()
+	h.typing.timers[key] = time.AfterFunc(time.Hour, func() {})
+	h.typing.nicknames[key] = key.senderID
+	h.typing.targets[key] = targets
+}
+
+func TestStopPairTyping(t *testing.T) {
+	tests := []struct {
+		name        string
+		key         typingKey
+		wantStopped bool
+	}{
+		{"blocker to blocked", typingKey{senderID: "alice", receiverID: "bob"}, true},
+		{"blocked to blocker", typingKey{senderID: "bob", receiverID: "alice"}, true},
+		{"blocker in direct conversation", typingKey{senderID: "alice", conversationID: "direct"}, true},
+		{"blocked in direct conversation", typingKey{senderID: "bob", conversationID: "direct"}, true},
+		{"to someone else", typingKey{senderID: "alice", receiverID: "carol"}, false},
+		{"in another conversation", typingKey{senderID: "bob", conversationID: "group"}, false},
+		{"someone else in the direct conversation", typingKey{senderID: "carol", conversationID: "direct"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHub()
+			trackTyping(h, tt.key, "someone")
+
+			h.stopPairTyping("alice", "bob", "direct")
+
+			h.typing.mutex.Lock()
+			_, active := h.typing.timers[tt.key]
+			h.typing.mutex.Unlock()
+			if active == tt.wantStopped {
+				t.Errorf("indicator active = %v, want %v", active, !tt.wantStopped)
+			}
+
+			select {
+			case message := <-h.broadcast:
+				if !tt.wantStopped {
+					t.Errorf("unexpected %s event", message.event.Type)
+				} else if message.event.Type != EventTypingStop {
+					t.Errorf("queued %s, want %s", message.event.Type, EventTypingStop)
+				}
+			default:
+				if tt.wantStopped {
+					t.Error("no typing_stop queued")
+				}
+			}
+		})
+	}
+}
@@ -3,9 +3,12 @@ package websocket
 import (
 	"encoding/json"
 	"log"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/Tomlee-abila/real_time_forum/backend/internal/database"
+	"github.com/Tomlee-abila/real_time_forum/backend/internal/models"
 	"github.com/gorilla/websocket"
 )
 
@@ -19,8 +22,8 @@ const (
 	// Send pings to peer with this period. Must be less than pongWait
 	pingPeriod = (pongWait * 9) / 10
 
-	// Maximum message size allowed from peer
-	maxMessageSize = 1024
+	// Maximum message size allowed from peer (room for a full chat message plus envelope)
+	maxMessageSize = 8192
 )
 
 // Client represents a WebSocket client connection
@@ -37,23 +40,33 @@ type Client struct {
 	// User information
 	userID   string
 	nickname string
+	role     models.Role
 
 	// Mutex for thread-safe operations
 	mutex sync.RWMutex
 
 	// Last activity time
 	lastActivity time.Time
+
+	// Last time activity was written to user_status
+	lastPersisted time.Time
+
+	// Topics this client follows (guarded by the hub mutex)
+	topics map[string]bool
 }
 
 // NewClient creates a new WebSocket client
-func NewClient(hub *Hub, conn *websocket.Conn, userID, nickname string) *Client {
+func NewClient(hub *Hub, conn *websocket.Conn, userID, nickname string, role models.Role) *Client {
 	return &Client{
-		conn:         conn,
-		send:         make(chan []byte, 256),
-		hub:          hub,
-		userID:       userID,
-		nickname:     nickname,
-		lastActivity: time.Now(),
+		conn:          conn,
+		send:          make(chan []byte, 256),
+		hub:           hub,
+		userID:        userID,
+		nickname:      nickname,
+		role:          role,
+		lastActivity:  time.Now(),
+		lastPersisted: time.Now(),
+		topics:        make(map[string]bool),
 	}
 }
 
@@ -71,11 +84,35 @@ func (c *Client) GetNickname() string {
 	return c.nickname
 }
 
-// UpdateActivity updates the client's last activity time
-func (c *Client) UpdateActivity() {
+// GetRole returns the client's role
+func (c *Client) GetRole() models.Role {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.role
+}
+
+// setRole updates the client's role after it changes
+func (c *Client) setRole(role models.Role) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
-	c.lastActivity = time.Now()
+	c.role = role
+}
+
+// UpdateActivity updates the client's last activity time and
+// periodically persists it as the user's last_active heartbeat
+func (c *Client) UpdateActivity() {
+	c.mutex.Lock()
+	now := time.Now()
+	c.lastActivity = now
+	persist := now.Sub(c.lastPersisted) >= activityPersistInterval
+	if persist {
+		c.lastPersisted = now
+	}
+	c.mutex.Unlock()
+
+	if persist {
+		c.hub.persistActivity(c.GetUserID())
+	}
 }
 
 // ReadPump pumps messages from the WebSocket connection to the hub
@@ -97,7 +134,7 @@ func (c *Client) ReadPump() {
 		_, message, err := c.conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				// log.Printf("WebSocket error: %v", err) // Will add when log import works
+				log.Printf("WebSocket error for user %s: %v", c.GetUserID(), err)
 			}
 			break
 		}
@@ -170,6 +207,14 @@ func (c *Client) handleMessage(message []byte) {
 		c.handleTypingStart(&event)
 	case EventTypingStop:
 		c.handleTypingStop(&event)
+	case EventSubscribe:
+		c.handleSubscribe(&event)
+	case EventUnsubscribe:
+		c.handleUnsubscribe(&event)
+	case EventResume:
+		c.handleResume(&event)
+	case EventModerate:
+		c.handleModerate(&event)
 	case EventPing:
 		c.sendPong()
 	default:
@@ -178,19 +223,12 @@ func (c *Client) handleMessage(message []byte) {
 	}
 }
 
-// sendEvent sends an event to the client
+// sendEvent sends an event to the client through the hub, which owns the send channel
 func (c *Client) sendEvent(event *Event) {
-	data, err := json.Marshal(event)
-	if err != nil {
-		log.Printf("Error marshaling event: %v", err)
-		return
-	}
-
-	select {
-	case c.send <- data:
-	default:
-		close(c.send)
-	}
+	c.hub.queue(&BroadcastMessage{
+		event:  event,
+		client: c,
+	})
 }
 
 // sendError sends an error event to the client
@@ -199,37 +237,153 @@ func (c *Client) sendError(message string, code int) {
 	c.sendEvent(errorEvent)
 }
 
+// sendErrorFor sends an error event in reply to a specific client event
+func (c *Client) sendErrorFor(request *Event, message string, code int) {
+	c.sendEvent(CreateErrorEventFor(request, message, code))
+}
+
 // sendPong sends a pong event to the client
 func (c *Client) sendPong() {
 	pongEvent := CreateEvent(EventPong, nil, c.userID)
 	c.sendEvent(pongEvent)
 }
 
-// handleNewMessage processes new message events (placeholder)
+// handleNewMessage validates, stores and delivers a message sent over the socket
 func (c *Client) handleNewMessage(event *Event) {
-	// TODO: Implement message creation from WebSocket
-	log.Printf("New message event from user %s", c.userID)
+	var messageCreation models.MessageCreation
+	if err := event.DecodeData(&messageCreation); err != nil {
+		c.sendErrorFor(event, "Invalid message payload", 400)
+		return
+	}
+
+	// Validate message
+	if err := messageCreation.Validate(); err != nil {
+		c.sendErrorFor(event, err.Error(), 400)
+		return
+	}
+
+	// Create message in database
+	message, err := database.CreateMessage(c.GetUserID(), &messageCreation)
+	if err != nil {
+		if strings.Contains(err.Error(), "attachment not found") {
+			c.sendErrorFor(event, err.Error(), 400)
+		} else if strings.Contains(err.Error(), "conversation not found") {
+			c.sendErrorFor(event, "Conversation not found", 404)
+		} else if strings.Contains(err.Error(), "not found") {
+			c.sendErrorFor(event, "Receiver not found", 404)
+		} else if strings.Contains(err.Error(), "blocked") {
+			c.sendErrorFor(event, "You cannot message this user", 403)
+		} else {
+			log.Printf("Error creating message from user %s: %v", c.GetUserID(), err)
+			c.sendErrorFor(event, "Failed to create message", 500)
+		}
+		return
+	}
+
+	// Echo the stored message back to the sender with the server-assigned ID
+	echoEvent := CreateMessageEvent(message)
+	echoEvent.CorrelationID = event.CorrelationID
+	c.sendEvent(echoEvent)
+
+	// Deliver the message to every member, including the sender's other sessions
+	memberIDs, err := database.GetConversationMemberIDs(message.ConversationID)
+	if err != nil {
+		log.Printf("Error getting members of conversation %s: %v", message.ConversationID, err)
+		return
+	}
+	c.hub.queue(&BroadcastMessage{
+		event:   CreateMessageEvent(message),
+		members: memberIDs,
+		sender:  c,
+	})
+
+	// Notify members mentioned in the message
+	if mentions, err := database.CreateMessageMentions(message); err != nil {
+		log.Printf("Error creating mentions for message %s: %v", message.ID, err)
+	} else {
+		c.hub.NotifyMentions(mentions)
+	}
 }
 
-// handleMessageRead processes message read events (placeholder)
+// handleMessageRead marks a conversation as read and notifies the original senders.
+// The conversation is given by its ID, or by the sender for direct messages.
 func (c *Client) handleMessageRead(event *Event) {
-	// TODO: Implement message read confirmation
-	log.Printf("Message read event from user %s", c.userID)
+	var readData MessageReadEvent
+	if err := event.DecodeData(&readData); err != nil ||
+		(strings.TrimSpace(readData.ConversationID) == "" && strings.TrimSpace(readData.SenderID) == "") {
+		c.sendErrorFor(event, "Conversation ID or sender ID is required", 400)
+		return
+	}
+
+	conversationID := readData.ConversationID
+	var read []models.Message
+	var err error
+	if conversationID != "" {
+		read, err = database.MarkConversationRead(conversationID, c.GetUserID())
+	} else {
+		read, err = database.MarkMessagesAsRead(c.GetUserID(), readData.SenderID)
+	}
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			c.sendErrorFor(event, "Conversation not found", 404)
+			return
+		}
+		log.Printf("Error marking messages read for user %s: %v", c.GetUserID(), err)
+		c.sendErrorFor(event, "Failed to mark messages as read", 500)
+		return
+	}
+	if len(read) == 0 {
+		return
+	}
+
+	for _, receipt := range readReceipts(read[0].ConversationID, c.GetUserID(), read) {
+		receipt.sender = c
+		c.hub.queue(receipt)
+	}
 }
 
-// handleTypingStart processes typing start events (placeholder)
+// handleTypingStart forwards a typing indicator to the conversation
 func (c *Client) handleTypingStart(event *Event) {
-	// TODO: Implement typing indicator broadcast
-	log.Printf("Typing start event from user %s", c.userID)
+	key, ok := c.decodeTypingKey(event)
+	if !ok {
+		return
+	}
+	c.hub.startTyping(key, c.GetNickname())
 }
 
-// handleTypingStop processes typing stop events (placeholder)
+// handleTypingStop clears a typing indicator for the conversation
 func (c *Client) handleTypingStop(event *Event) {
-	// TODO: Implement typing indicator stop broadcast
-	log.Printf("Typing stop event from user %s", c.userID)
+	key, ok := c.decodeTypingKey(event)
+	if !ok {
+		return
+	}
+	c.hub.stopTyping(key)
 }
 
-// Close closes the client connection
-func (c *Client) Close() {
-	close(c.send)
+// decodeTypingKey extracts the receiver or conversation ID from a typing event payload
+func (c *Client) decodeTypingKey(event *Event) (typingKey, bool) {
+	var typing TypingEvent
+	if err := event.DecodeData(&typing); err != nil {
+		c.sendErrorFor(event, "Invalid typing payload", 400)
+		return typingKey{}, false
+	}
+
+	key := typingKey{
+		senderID:       c.GetUserID(),
+		receiverID:     strings.TrimSpace(typing.ReceiverID),
+		conversationID: strings.TrimSpace(typing.ConversationID),
+	}
+	if key.conversationID != "" {
+		key.receiverID = ""
+		return key, true
+	}
+	if key.receiverID == "" {
+		c.sendErrorFor(event, "Receiver ID or conversation ID is required", 400)
+		return typingKey{}, false
+	}
+	if key.receiverID == c.GetUserID() {
+		c.sendErrorFor(event, "Cannot send typing events to yourself", 400)
+		return typingKey{}, false
+	}
+	return key, true
 }
@@ -0,0 +1,92 @@
+package websocket
+
+import (
+	"log"
+	"time"
+
+	"github.com/Tomlee-abila/real_time_forum/backend/internal/database"
+	"github.com/Tomlee-abila/real_time_forum/backend/internal/models"
+)
+
+// sendToMembers sends an event to every connection of each member, skipping one connection
+func (h *Hub) sendToMembers(memberIDs []string, event *Event, except *Client) {
+	for _, userID := range memberIDs {
+		h.sendToUserExcept(userID, event, except)
+	}
+}
+
+// BroadcastToConversation sends an event from the API to every member of a conversation
+func (h *Hub) BroadcastToConversation(conversationID string, event *Event) {
+	memberIDs, err := database.GetConversationMemberIDs(conversationID)
+	if err != nil {
+		log.Printf("Error getting members of conversation %s: %v", conversationID, err)
+		return
+	}
+	h.BroadcastToUsers(memberIDs, event)
+}
+
+// BroadcastToUsers sends an event from the API to every connection of the given users
+func (h *Hub) BroadcastToUsers(userIDs []string, event *Event) {
+	if len(userIDs) == 0 {
+		return
+	}
+
+	h.queue(&BroadcastMessage{
+		event:   event,
+		members: userIDs,
+	})
+}
+
+// SendReadReceipts tells the senders of newly read messages that a member has
+// read them. Each sender gets one message_read event listing their own messages.
+func (h *Hub) SendReadReceipts(conversationID, readerID string, read []models.Message) {
+	for _, receipt := range readReceipts(conversationID, readerID, read) {
+		h.BroadcastMessageFromAPI(receipt.event, receipt.targetUser)
+	}
+}
+
+// readReceipts groups read messages by sender into message_read events
+func readReceipts(conversationID, readerID string, read []models.Message) []*BroadcastMessage {
+	readAt := time.Now()
+	messageIDs := make(map[string][]string)
+	var senders []string
+	for _, message := range read {
+		if _, ok := messageIDs[message.SenderID]; !ok {
+			senders = append(senders, message.SenderID)
+		}
+		messageIDs[message.SenderID] = append(messageIDs[message.SenderID], message.ID)
+	}
+
+	receipts := make([]*BroadcastMessage, 0, len(senders))
+	for _, senderID := range senders {
+		receipts = append(receipts, &BroadcastMessage{
+			event:      CreateMessageReadEvent(conversationID, senderID, readerID, messageIDs[senderID], readAt),
+			targetUser: senderID,
+		})
+	}
+	return receipts
+}
+
+// NotifyConversationUpdated sends each member their own view of a conversation
+// after it was created, renamed or its members changed
+func (h *Hub) NotifyConversationUpdated(conversationID string) {
+	memberIDs, err := database.GetConversationMemberIDs(conversationID)
+	if err != nil {
+		log.Printf("Error getting members of conversation %s: %v", conversationID, err)
+		return
+	}
+
+	for _, userID := range memberIDs {
+		conversation, err := database.GetConversation(conversationID, userID)
+		if err != nil {
+			log.Printf("Error getting conversation %s for user %s: %v", conversationID, userID, err)
+			continue
+		}
+		h.BroadcastMessageFromAPI(CreateConversationUpdatedEvent(conversation), userID)
+	}
+}
+
+// NotifyConversationRemoved tells a user who left or was removed that the conversation is gone for them
+func (h *Hub) NotifyConversationRemoved(conversationID, userID string) {
+	h.BroadcastMessageFromAPI(CreateConversationRemovedEvent(conversationID, userID), userID)
+}
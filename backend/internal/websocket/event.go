@@ -1,16 +1,27 @@
 package websocket
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/Tomlee-abila/real_time_forum/backend/internal/models"
+)
 
 // EventType represents different types of WebSocket events
 type EventType string
 
 const (
 	// Message events
-	EventNewMessage  EventType = "new_message"
-	EventMessageRead EventType = "message_read"
-	EventTypingStart EventType = "typing_start"
-	EventTypingStop  EventType = "typing_stop"
+	EventNewMessage     EventType = "new_message"
+	EventMessageRead    EventType = "message_read"
+	EventMessageEdited  EventType = "message_edited"
+	EventMessageDeleted EventType = "message_deleted"
+	EventTypingStart    EventType = "typing_start"
+	EventTypingStop     EventType = "typing_stop"
+
+	// Conversation events
+	EventConversationUpdated EventType = "conversation_updated"
+	EventConversationRemoved EventType = "conversation_removed"
 
 	// User status events
 	EventUserOnline  EventType = "user_online"
@@ -18,12 +29,34 @@ const (
 	EventUserList    EventType = "user_list"
 	EventUserStats   EventType = "user_stats"
 
+	// Feed events
+	EventPostCreated    EventType = "post_created"
+	EventCommentCreated EventType = "comment_created"
+	EventPostDeleted    EventType = "post_deleted"
+	EventPostUpdated    EventType = "post_updated"
+	EventCommentUpdated EventType = "comment_updated"
+	EventCommentDeleted EventType = "comment_deleted"
+	EventReactionUpdate EventType = "reaction_updated"
+	EventSubscribe      EventType = "subscribe"
+	EventUnsubscribe    EventType = "unsubscribe"
+	EventSubscriptions  EventType = "subscriptions"
+
+	// Moderation events
+	EventModerate      EventType = "moderate"
+	EventModerated     EventType = "moderated"
+	EventReportCreated EventType = "report_created"
+
+	// Notification events
+	EventMention EventType = "mention"
+
 	// System events
 	EventError        EventType = "error"
 	EventConnected    EventType = "connected"
 	EventDisconnected EventType = "disconnected"
 	EventPing         EventType = "ping"
 	EventPong         EventType = "pong"
+	EventResume       EventType = "resume"
+	EventResumed      EventType = "resumed"
 )
 
 // Event represents a WebSocket event
@@ -32,6 +65,19 @@ type Event struct {
 	Data      interface{} `json:"data"`
 	Timestamp string      `json:"timestamp"`
 	UserID    string      `json:"user_id,omitempty"`
+	// CorrelationID is set by the client and echoed back on replies and errors
+	CorrelationID string `json:"correlation_id,omitempty"`
+	// Seq is the per-user sequence number of events that can be replayed
+	Seq uint64 `json:"seq,omitempty"`
+}
+
+// DecodeData decodes the event payload into the given value
+func (e *Event) DecodeData(v interface{}) error {
+	data, err := json.Marshal(e.Data)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
 }
 
 // MessageEvent represents a new message event
@@ -39,11 +85,28 @@ type MessageEvent struct {
 	Message interface{} `json:"message"`
 }
 
-// TypingEvent represents typing start/stop events
+// MessageDeletedEvent represents a deleted message. Scope is "everyone" when the
+// message became a tombstone for all members, or "me" when the user hid it.
+type MessageDeletedEvent struct {
+	MessageID      string `json:"message_id"`
+	ConversationID string `json:"conversation_id"`
+	Scope          string `json:"scope"`
+}
+
+// TypingEvent represents typing start/stop events. ReceiverID is set when
+// typing to a direct message peer, ConversationID when typing in a conversation.
 type TypingEvent struct {
-	UserID       string `json:"user_id"`
-	UserNickname string `json:"user_nickname"`
-	ReceiverID   string `json:"receiver_id"`
+	UserID         string `json:"user_id"`
+	UserNickname   string `json:"user_nickname"`
+	ReceiverID     string `json:"receiver_id,omitempty"`
+	ConversationID string `json:"conversation_id,omitempty"`
+}
+
+// ConversationEvent represents a change to a conversation or its members.
+// Conversation is omitted when the user was removed from it.
+type ConversationEvent struct {
+	ConversationID string      `json:"conversation_id"`
+	Conversation   interface{} `json:"conversation,omitempty"`
 }
 
 // UserStatusEvent represents user online/offline events
@@ -56,6 +119,38 @@ type UserListEvent struct {
 	Users []interface{} `json:"users"`
 }
 
+// FeedEvent represents a post or comment change in the forum feed.
+// Categories and PostID are used to route the event to subscribers.
+type FeedEvent struct {
+	Categories []string    `json:"categories"`
+	PostID     string      `json:"post_id"`
+	Post       interface{} `json:"post,omitempty"`
+	Comment    interface{} `json:"comment,omitempty"`
+	Reaction   interface{} `json:"reaction,omitempty"`
+}
+
+// ModerationEvent represents a moderation action requested over the socket
+// ("delete_post", "delete_comment", "lock_post" or "unlock_post")
+type ModerationEvent struct {
+	Action    string `json:"action"`
+	PostID    string `json:"post_id"`
+	CommentID string `json:"comment_id,omitempty"`
+}
+
+// SubscriptionEvent represents a subscribe/unsubscribe request and
+// the resulting set of followed topics
+type SubscriptionEvent struct {
+	Topics []string `json:"topics"`
+}
+
+// ResumeEvent represents a client's resume request and the server's reply.
+// Complete is false when events were lost and the client should reload its state.
+type ResumeEvent struct {
+	LastSeq  uint64 `json:"last_seq"`
+	Replayed int    `json:"replayed,omitempty"`
+	Complete bool   `json:"complete,omitempty"`
+}
+
 // ErrorEvent represents error events
 type ErrorEvent struct {
 	Message string `json:"message"`
@@ -64,15 +159,20 @@ type ErrorEvent struct {
 
 // ConnectedEvent represents successful connection
 type ConnectedEvent struct {
-	UserID  string `json:"user_id"`
-	Message string `json:"message"`
+	UserID         string `json:"user_id"`
+	Message        string `json:"message"`
+	ActiveSessions int    `json:"active_sessions"`
+	LastSeq        uint64 `json:"last_seq"`
 }
 
-// MessageReadEvent represents message read confirmation
+// MessageReadEvent represents message read confirmation. ReceiverID is the
+// member who read the messages.
 type MessageReadEvent struct {
-	SenderID   string   `json:"sender_id"`
-	ReceiverID string   `json:"receiver_id"`
-	MessageIDs []string `json:"message_ids,omitempty"`
+	ConversationID string   `json:"conversation_id,omitempty"`
+	SenderID       string   `json:"sender_id"`
+	ReceiverID     string   `json:"receiver_id"`
+	MessageIDs     []string `json:"message_ids,omitempty"`
+	ReadAt         string   `json:"read_at,omitempty"`
 }
 
 // UserStatsEvent represents user statistics
@@ -100,11 +200,22 @@ func CreateErrorEvent(message string, code int) *Event {
 	}, "")
 }
 
+// CreateErrorEventFor creates an error event in reply to a client event
+func CreateErrorEventFor(request *Event, message string, code int) *Event {
+	errorEvent := CreateErrorEvent(message, code)
+	if request != nil {
+		errorEvent.CorrelationID = request.CorrelationID
+	}
+	return errorEvent
+}
+
 // CreateConnectedEvent creates a connected event
-func CreateConnectedEvent(userID string) *Event {
+func CreateConnectedEvent(userID string, activeSessions int, lastSeq uint64) *Event {
 	return CreateEvent(EventConnected, &ConnectedEvent{
-		UserID:  userID,
-		Message: "Successfully connected to WebSocket",
+		UserID:         userID,
+		Message:        "Successfully connected to WebSocket",
+		ActiveSessions: activeSessions,
+		LastSeq:        lastSeq,
 	}, userID)
 }
 
@@ -115,6 +226,154 @@ func CreateMessageEvent(message interface{}) *Event {
 	}, "")
 }
 
+// CreateMessageEditedEvent creates a message_edited event carrying the edited message
+func CreateMessageEditedEvent(message *models.Message) *Event {
+	return CreateEvent(EventMessageEdited, &MessageEvent{
+		Message: message,
+	}, message.SenderID)
+}
+
+// CreateMessageDeletedEvent creates a message_deleted event
+func CreateMessageDeletedEvent(message *models.Message, scope, userID string) *Event {
+	return CreateEvent(EventMessageDeleted, &MessageDeletedEvent{
+		MessageID:      message.ID,
+		ConversationID: message.ConversationID,
+		Scope:          scope,
+	}, userID)
+}
+
+// CreateMessageReadEvent creates a read receipt for the original sender
+func CreateMessageReadEvent(conversationID, senderID, receiverID string, messageIDs []string, readAt time.Time) *Event {
+	return CreateEvent(EventMessageRead, &MessageReadEvent{
+		ConversationID: conversationID,
+		SenderID:       senderID,
+		ReceiverID:     receiverID,
+		MessageIDs:     messageIDs,
+		ReadAt:         readAt.Format("2006-01-02T15:04:05Z07:00"),
+	}, receiverID)
+}
+
+// CreateConversationUpdatedEvent creates a conversation_updated event for a member
+func CreateConversationUpdatedEvent(conversation *models.Conversation) *Event {
+	return CreateEvent(EventConversationUpdated, &ConversationEvent{
+		ConversationID: conversation.ID,
+		Conversation:   conversation,
+	}, "")
+}
+
+// CreateConversationRemovedEvent creates a conversation_removed event for a user who left or was removed
+func CreateConversationRemovedEvent(conversationID, userID string) *Event {
+	return CreateEvent(EventConversationRemoved, &ConversationEvent{
+		ConversationID: conversationID,
+	}, userID)
+}
+
+// CreatePostCreatedEvent creates a post_created feed event
+func CreatePostCreatedEvent(post *models.Post) *Event {
+	return CreateEvent(EventPostCreated, &FeedEvent{
+		Categories: post.Categories,
+		PostID:     post.ID,
+		Post:       post,
+	}, post.UserID)
+}
+
+// CreateCommentCreatedEvent creates a comment_created feed event
+func CreateCommentCreatedEvent(categories []string, comment *models.Comment) *Event {
+	return CreateEvent(EventCommentCreated, &FeedEvent{
+		Categories: categories,
+		PostID:     comment.PostID,
+		Comment:    comment,
+	}, comment.UserID)
+}
+
+// CreatePostDeletedEvent creates a post_deleted feed event
+func CreatePostDeletedEvent(categories []string, postID, userID string) *Event {
+	return CreateEvent(EventPostDeleted, &FeedEvent{
+		Categories: categories,
+		PostID:     postID,
+	}, userID)
+}
+
+// CreatePostUpdatedEvent creates a post_updated feed event
+func CreatePostUpdatedEvent(post *models.Post) *Event {
+	// The editor's own reaction is not shared with other viewers
+	shared := *post
+	shared.MyReaction = ""
+	return CreateEvent(EventPostUpdated, &FeedEvent{
+		Categories: post.Categories,
+		PostID:     post.ID,
+		Post:       &shared,
+	}, post.UserID)
+}
+
+// CreateCommentUpdatedEvent creates a comment_updated feed event
+func CreateCommentUpdatedEvent(categories []string, comment *models.Comment) *Event {
+	// The editor's own reaction is not shared with other viewers
+	shared := *comment
+	shared.MyReaction = ""
+	return CreateEvent(EventCommentUpdated, &FeedEvent{
+		Categories: categories,
+		PostID:     comment.PostID,
+		Comment:    &shared,
+	}, comment.UserID)
+}
+
+// CreateCommentDeletedEvent creates a comment_deleted feed event
+func CreateCommentDeletedEvent(categories []string, postID, commentID, userID string) *Event {
+	return CreateEvent(EventCommentDeleted, &FeedEvent{
+		Categories: categories,
+		PostID:     postID,
+		Comment:    &models.Comment{ID: commentID, PostID: postID},
+	}, userID)
+}
+
+// CreateReactionUpdatedEvent creates a reaction_updated feed event
+func CreateReactionUpdatedEvent(categories []string, update *models.ReactionUpdate) *Event {
+	return CreateEvent(EventReactionUpdate, &FeedEvent{
+		Categories: categories,
+		PostID:     update.PostID,
+		Reaction:   update,
+	}, update.UserID)
+}
+
+// CreateReportCreatedEvent creates a report_created event for moderators
+func CreateReportCreatedEvent(report *models.Report) *Event {
+	return CreateEvent(EventReportCreated, report, report.ReporterID)
+}
+
+// CreateMentionEvent creates a mention event for the mentioned user
+func CreateMentionEvent(mention *models.Mention) *Event {
+	return CreateEvent(EventMention, mention, mention.AuthorID)
+}
+
+// CreateTypingEvent creates a typing start/stop event
+func CreateTypingEvent(eventType EventType, senderID, nickname, receiverID, conversationID string) *Event {
+	return CreateEvent(eventType, &TypingEvent{
+		UserID:         senderID,
+		UserNickname:   nickname,
+		ReceiverID:     receiverID,
+		ConversationID: conversationID,
+	}, senderID)
+}
+
+// CreateUserStatusEvent creates a user_online or user_offline event
+func CreateUserStatusEvent(eventType EventType, status *models.UserStatus) *Event {
+	return CreateEvent(eventType, &UserStatusEvent{
+		UserStatus: status,
+	}, status.UserID)
+}
+
+// CreateUserListEvent creates a snapshot of the currently online users
+func CreateUserListEvent(statuses []models.UserStatus) *Event {
+	users := make([]interface{}, 0, len(statuses))
+	for _, status := range statuses {
+		users = append(users, status)
+	}
+	return CreateEvent(EventUserList, &UserListEvent{
+		Users: users,
+	}, "")
+}
+
 // CreateUserStatsEvent creates a user stats event
 func CreateUserStatsEvent(totalUsers, onlineUsers, offlineUsers int) *Event {
 	return CreateEvent(EventUserStats, &UserStatsEvent{
@@ -0,0 +1,13 @@
+package websocket
+
+// feedTopics returns the topics a feed event is published to
+func feedTopics(feed *FeedEvent) []string {
+	topics := []string{TopicFeed}
+	for _, category := range feed.Categories {
+		topics = append(topics, CategoryTopic(category))
+	}
+	if feed.PostID != "" {
+		topics = append(topics, PostTopic(feed.PostID))
+	}
+	return topics
+}
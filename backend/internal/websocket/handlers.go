@@ -48,7 +48,7 @@ func WebSocketHandler(hub *Hub, w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Create new client
-	client := NewClient(hub, conn, user.ID, user.Nickname)
+	client := NewClient(hub, conn, user.ID, user.Nickname, session.Role)
 
 	// Register client with hub
 	hub.register <- client
@@ -4,14 +4,24 @@ import (
 	"encoding/json"
 	"log"
 	"sync"
+	"time"
 
 	"github.com/Tomlee-abila/real_time_forum/backend/internal/database"
+	"github.com/Tomlee-abila/real_time_forum/backend/internal/models"
 )
 
+// Number of broadcasts the hub queues before further broadcasts are dropped.
+// Handlers that notify several users queue one broadcast per user.
+const broadcastBufferSize = 256
+
 // BroadcastMessage represents a message to be broadcast
 type BroadcastMessage struct {
 	event      *Event
-	targetUser string // If empty, broadcast to all
+	targetUser string            // If empty, broadcast to all
+	topics     []string          // If set, deliver only to subscribers of these topics
+	members    []string          // If set, deliver to every connection of these users
+	permission models.Permission // If set, deliver only to clients whose role grants it
+	client     *Client           // If set, deliver only to this connection
 	sender     *Client
 }
 
@@ -32,23 +42,40 @@ type Hub struct {
 	// Mutex for thread-safe operations
 	mutex sync.RWMutex
 
-	// Map of user ID to client for direct messaging
-	userClients map[string]*Client
+	// Map of user ID to the set of that user's connections (tabs/devices)
+	userClients map[string]map[*Client]bool
+
+	// Map of topic to subscribed clients
+	topics map[string]map[*Client]bool
+
+	// Active typing indicators
+	typing *typingTracker
+
+	// Sequenced events kept for replay on reconnect
+	replay *replayLog
 }
 
 // NewHub creates a new WebSocket hub
 func NewHub() *Hub {
 	return &Hub{
-		broadcast:   make(chan *BroadcastMessage),
+		broadcast:   make(chan *BroadcastMessage, broadcastBufferSize),
 		register:    make(chan *Client),
 		unregister:  make(chan *Client),
 		clients:     make(map[*Client]bool),
-		userClients: make(map[string]*Client),
+		userClients: make(map[string]map[*Client]bool),
+		topics:      make(map[string]map[*Client]bool),
+		typing:      newTypingTracker(),
+		replay:      newReplayLog(),
 	}
 }
 
 // Run starts the hub and handles client registration/unregistration and message broadcasting
 func (h *Hub) Run() {
+	h.resetPresence()
+
+	sweep := time.NewTicker(presenceSweepInterval)
+	defer sweep.Stop()
+
 	for {
 		select {
 		case client := <-h.register:
@@ -59,72 +86,117 @@ func (h *Hub) Run() {
 
 		case message := <-h.broadcast:
 			h.broadcastMessage(message)
+
+		case <-sweep.C:
+			h.sweepPresence()
 		}
 	}
 }
 
 // registerClient registers a new client
 func (h *Hub) registerClient(client *Client) {
+	userID := client.GetUserID()
+
 	h.mutex.Lock()
-	defer h.mutex.Unlock()
+	h.clients[client] = true
+	if h.userClients[userID] == nil {
+		h.userClients[userID] = make(map[*Client]bool)
+	}
+	h.userClients[userID][client] = true
+	activeSessions := len(h.userClients[userID])
+	h.mutex.Unlock()
 
-	userID := client.GetUserID()
+	log.Printf("Client registered: %s (%s), %d active session(s)", client.GetNickname(), userID, activeSessions)
 
-	// Check if user already has a connection
-	if existingClient, exists := h.userClients[userID]; exists {
-		log.Printf("User %s (%s) already connected, closing existing connection", client.GetNickname(), userID)
+	// Send connected event to client
+	connectedEvent := CreateConnectedEvent(userID, activeSessions, h.replay.lastSeq(userID))
+	h.sendToClient(client, connectedEvent)
 
-		// Clean up existing client
-		delete(h.clients, existingClient)
-		delete(h.userClients, userID)
-		close(existingClient.send)
+	// Send the initial online users snapshot
+	h.sendUserList(client)
+
+	// Presence only changes when the user's first session opens
+	if activeSessions == 1 {
+		h.setUserOnline(userID, true)
+		h.broadcastUserStats()
+	}
+}
 
-		// Note: We don't send disconnect events here to avoid confusion
-		// The old connection will be cleaned up naturally
+// unregisterClient unregisters a client
+func (h *Hub) unregisterClient(client *Client) {
+	removed, remainingSessions := h.removeClient(client)
+	if !removed {
+		return
 	}
+	log.Printf("Client unregistered: %s (%s), %d active session(s)", client.GetNickname(), client.GetUserID(), remainingSessions)
 
-	// Register new client
-	h.clients[client] = true
-	h.userClients[userID] = client
+	// The user stays online while any other session is open
+	if remainingSessions > 0 {
+		return
+	}
 
-	log.Printf("Client registered: %s (%s)", client.GetNickname(), userID)
+	h.setUserOnline(client.GetUserID(), false)
 
-	// Send connected event to client
-	connectedEvent := CreateConnectedEvent(userID)
-	h.sendToClient(client, connectedEvent)
+	// A disconnected user can no longer be typing
+	h.stopAllTyping(client.GetUserID())
 
 	// Broadcast updated user stats
 	h.broadcastUserStats()
 }
 
-// unregisterClient unregisters a client
-func (h *Hub) unregisterClient(client *Client) {
+// removeClient drops a client from the hub and closes its send channel.
+// It reports whether the client was removed and how many sessions the user has left.
+func (h *Hub) removeClient(client *Client) (bool, int) {
 	h.mutex.Lock()
 	defer h.mutex.Unlock()
 
-	if _, ok := h.clients[client]; ok {
-		delete(h.clients, client)
-		delete(h.userClients, client.GetUserID())
-		close(client.send)
-		log.Printf("Client unregistered: %s (%s)", client.GetNickname(), client.GetUserID())
-
-		// Broadcast updated user stats
-		h.broadcastUserStats()
+	userID := client.GetUserID()
+	if _, ok := h.clients[client]; !ok {
+		return false, len(h.userClients[userID])
+	}
+	delete(h.clients, client)
+	delete(h.userClients[userID], client)
+	for topic := range client.topics {
+		h.unsubscribeLocked(client, topic)
+	}
+	remainingSessions := len(h.userClients[userID])
+	if remainingSessions == 0 {
+		delete(h.userClients, userID)
 	}
+	close(client.send)
+	return true, remainingSessions
 }
 
-// broadcastMessage broadcasts a message to clients
+// broadcastMessage broadcasts a message to clients, skipping the sending connection
 func (h *Hub) broadcastMessage(message *BroadcastMessage) {
-	if message.targetUser != "" {
+	if message.client != nil {
+		// Reply to a single connection, unless it disconnected in the meantime
+		if h.isRegistered(message.client) {
+			h.sendToClient(message.client, message.event)
+		}
+	} else if message.targetUser != "" {
 		// Send to specific user
-		h.sendToUser(message.targetUser, message.event)
+		h.sendToUserExcept(message.targetUser, message.event, message.sender)
+	} else if len(message.members) > 0 {
+		// Send to the members of a conversation
+		h.sendToMembers(message.members, message.event, message.sender)
+	} else if len(message.topics) > 0 {
+		// Send to topic subscribers
+		h.sendToTopics(message.topics, message.event, message.sender)
+	} else if message.permission != "" {
+		// Send to staff whose role grants the permission
+		h.sendToPermission(message.permission, message.event)
+	} else if feed, ok := message.event.Data.(*FeedEvent); ok {
+		// Feed events only go to clients following the feed, category or post
+		h.sendToTopics(feedTopics(feed), message.event, message.sender)
 	} else {
 		// Broadcast to all clients
 		h.sendToAll(message.event)
 	}
 }
 
-// sendToClient sends an event to a specific client
+// sendToClient sends an event to a specific client. Only the hub goroutine may
+// call it, because the hub closes send channels when it removes clients.
 func (h *Hub) sendToClient(client *Client, event *Event) {
 	data, err := json.Marshal(event)
 	if err != nil {
@@ -135,54 +207,94 @@ func (h *Hub) sendToClient(client *Client, event *Event) {
 	select {
 	case client.send <- data:
 	default:
-		close(client.send)
-		delete(h.clients, client)
-		delete(h.userClients, client.GetUserID())
+		// Client is not keeping up, have the hub drop it
+		go func() { h.unregister <- client }()
 	}
 }
 
-// sendToUser sends an event to a specific user by user ID
-func (h *Hub) sendToUser(userID string, event *Event) {
+// sendToUserExcept sends an event to every connection of a user except one.
+// The event is sequenced and logged even when the user is offline, so it can be replayed.
+func (h *Hub) sendToUserExcept(userID string, event *Event, except *Client) {
+	event = h.replay.record(userID, event)
+
 	h.mutex.RLock()
-	client, exists := h.userClients[userID]
+	clients := make([]*Client, 0, len(h.userClients[userID]))
+	for client := range h.userClients[userID] {
+		if client != except {
+			clients = append(clients, client)
+		}
+	}
 	h.mutex.RUnlock()
 
-	if exists {
+	for _, client := range clients {
 		h.sendToClient(client, event)
 	}
 }
 
-// sendToAll sends an event to all connected clients
+// sendToAll sends an event to all connected clients, sequencing it per user.
+// Users that are offline but have a replay log also get it logged.
 func (h *Hub) sendToAll(event *Event) {
+	h.sendToAllExcept(event, nil)
+}
+
+// sendToAllExcept sends an event like sendToAll, skipping the excluded users
+func (h *Hub) sendToAllExcept(event *Event, excluded map[string]bool) {
 	h.mutex.RLock()
-	clients := make([]*Client, 0, len(h.clients))
-	for client := range h.clients {
-		clients = append(clients, client)
+	userClients := make(map[string][]*Client, len(h.userClients))
+	for userID, clients := range h.userClients {
+		if excluded[userID] {
+			continue
+		}
+		for client := range clients {
+			userClients[userID] = append(userClients[userID], client)
+		}
 	}
 	h.mutex.RUnlock()
 
-	for _, client := range clients {
-		h.sendToClient(client, event)
+	// Offline users only need the event when it can be replayed to them
+	if !isEphemeral(event.Type) {
+		for _, userID := range h.replay.knownUsers() {
+			if _, connected := userClients[userID]; !connected && !excluded[userID] {
+				h.replay.record(userID, event)
+			}
+		}
 	}
-}
 
-// BroadcastMessageFromAPI broadcasts a message from API (not from WebSocket client)
-func (h *Hub) BroadcastMessageFromAPI(event *Event, targetUserID string) {
-	broadcastMsg := &BroadcastMessage{
-		event:      event,
-		targetUser: targetUserID,
-		sender:     nil, // No sender client for API calls
+	for userID, clients := range userClients {
+		sequenced := h.replay.record(userID, event)
+		for _, client := range clients {
+			h.sendToClient(client, sequenced)
+		}
 	}
+}
 
+// isRegistered reports whether a client is still connected to the hub
+func (h *Hub) isRegistered(client *Client) bool {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	return h.clients[client]
+}
+
+// queue hands a message to the hub goroutine for delivery. The message is
+// dropped rather than blocking the caller when the hub is falling behind.
+func (h *Hub) queue(message *BroadcastMessage) {
 	select {
-	case h.broadcast <- broadcastMsg:
+	case h.broadcast <- message:
 		// Message queued for broadcast
 	default:
-		// Hub broadcast channel is full, log but continue
-		log.Printf("Hub broadcast channel full, message dropped")
+		log.Printf("Hub broadcast channel full, %s event dropped", message.event.Type)
 	}
 }
 
+// BroadcastMessageFromAPI broadcasts a message from API (not from WebSocket client)
+func (h *Hub) BroadcastMessageFromAPI(event *Event, targetUserID string) {
+	h.queue(&BroadcastMessage{
+		event:      event,
+		targetUser: targetUserID,
+		sender:     nil, // No sender client for API calls
+	})
+}
+
 // GetOnlineUserCount returns the number of currently connected users
 func (h *Hub) GetOnlineUserCount() int {
 	h.mutex.RLock()
@@ -202,17 +314,30 @@ func (h *Hub) GetOnlineUsers() []string {
 	return users
 }
 
+// GetUserSessionCount returns the number of open connections for a user
+func (h *Hub) GetUserSessionCount(userID string) int {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	return len(h.userClients[userID])
+}
+
 // GetOnlineUserDetails returns detailed information about online users
 func (h *Hub) GetOnlineUserDetails() []map[string]interface{} {
 	h.mutex.RLock()
 	defer h.mutex.RUnlock()
 
 	users := make([]map[string]interface{}, 0, len(h.userClients))
-	for userID, client := range h.userClients {
+	for userID, clients := range h.userClients {
+		var nickname string
+		for client := range clients {
+			nickname = client.GetNickname()
+			break
+		}
 		users = append(users, map[string]interface{}{
 			"user_id":   userID,
-			"nickname":  client.nickname,
+			"nickname":  nickname,
 			"connected": true,
+			"sessions":  len(clients),
 		})
 	}
 	return users
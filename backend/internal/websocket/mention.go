@@ -0,0 +1,10 @@
+package websocket
+
+import "github.com/Tomlee-abila/real_time_forum/backend/internal/models"
+
+// NotifyMentions sends each mentioned user a mention event on all of their connections
+func (h *Hub) NotifyMentions(mentions []models.Mention) {
+	for i := range mentions {
+		h.BroadcastToUsers([]string{mentions[i].UserID}, CreateMentionEvent(&mentions[i]))
+	}
+}
@@ -0,0 +1,115 @@
+package websocket
+
+import (
+	"strings"
+
+	"github.com/Tomlee-abila/real_time_forum/backend/internal/database"
+	"github.com/Tomlee-abila/real_time_forum/backend/internal/models"
+)
+
+// Moderation actions accepted in a moderate event
+const (
+	ModerateDeletePost    = "delete_post"
+	ModerateDeleteComment = "delete_comment"
+	ModerateLockPost      = "lock_post"
+	ModerateUnlockPost    = "unlock_post"
+)
+
+// SetUserRole updates the role carried by a user's connected clients
+func (h *Hub) SetUserRole(userID string, role models.Role) {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	for client := range h.userClients[userID] {
+		client.setRole(role)
+	}
+}
+
+// sendToPermission sends an event to every connected client whose role grants
+// the permission. These events are not replayed; the REST endpoints behind the
+// permission are the source of truth for anything missed.
+func (h *Hub) sendToPermission(permission models.Permission, event *Event) {
+	h.mutex.RLock()
+	clients := make([]*Client, 0)
+	for _, userClients := range h.userClients {
+		for client := range userClients {
+			if client.GetRole().Can(permission) {
+				clients = append(clients, client)
+			}
+		}
+	}
+	h.mutex.RUnlock()
+
+	for _, client := range clients {
+		h.sendToClient(client, event)
+	}
+}
+
+// BroadcastToPermission sends an event from the API to connected users whose role grants the permission
+func (h *Hub) BroadcastToPermission(event *Event, permission models.Permission) {
+	h.queue(&BroadcastMessage{
+		event:      event,
+		permission: permission,
+	})
+}
+
+// handleModerate performs a moderation action with the client's role and
+// publishes the result to feed subscribers
+func (c *Client) handleModerate(event *Event) {
+	var moderation ModerationEvent
+	if err := event.DecodeData(&moderation); err != nil || moderation.PostID == "" {
+		c.sendErrorFor(event, "Invalid moderation payload", 400)
+		return
+	}
+
+	post, err := database.GetPostByID(moderation.PostID)
+	if err != nil {
+		c.sendErrorFor(event, "Post not found", 404)
+		return
+	}
+
+	role := c.GetRole()
+	var feedEvent *Event
+	switch moderation.Action {
+	case ModerateDeletePost:
+		err = database.DeletePost(post.ID, c.userID, role)
+		feedEvent = CreatePostDeletedEvent(post.Categories, post.ID, c.userID)
+
+	case ModerateDeleteComment:
+		comment, lookupErr := database.GetCommentByID(moderation.CommentID)
+		if lookupErr != nil || comment.PostID != post.ID {
+			c.sendErrorFor(event, "Comment not found", 404)
+			return
+		}
+		err = database.DeleteComment(comment.ID, c.userID, role)
+		feedEvent = CreateCommentDeletedEvent(post.Categories, post.ID, comment.ID, c.userID)
+
+	case ModerateLockPost, ModerateUnlockPost:
+		err = database.LockPost(post.ID, c.userID, role, moderation.Action == ModerateLockPost)
+		if err == nil {
+			post.Locked = moderation.Action == ModerateLockPost
+			feedEvent = CreatePostUpdatedEvent(post)
+		}
+
+	default:
+		c.sendErrorFor(event, "Unknown moderation action", 400)
+		return
+	}
+
+	if err != nil {
+		if strings.Contains(err.Error(), "unauthorized") {
+			c.sendErrorFor(event, err.Error(), 403)
+		} else if strings.Contains(err.Error(), "not found") {
+			c.sendErrorFor(event, err.Error(), 404)
+		} else {
+			c.sendErrorFor(event, "Failed to moderate", 500)
+		}
+		return
+	}
+
+	c.hub.BroadcastMessageFromAPI(feedEvent, "")
+
+	reply := CreateEvent(EventModerated, &moderation, c.userID)
+	reply.CorrelationID = event.CorrelationID
+	c.sendEvent(reply)
+}
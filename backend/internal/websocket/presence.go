@@ -0,0 +1,125 @@
+package websocket
+
+import (
+	"log"
+	"time"
+
+	"github.com/Tomlee-abila/real_time_forum/backend/internal/database"
+	"github.com/Tomlee-abila/real_time_forum/backend/internal/models"
+)
+
+const (
+	// Minimum time between last_active writes for a single client
+	activityPersistInterval = 30 * time.Second
+
+	// How often the sweeper looks for idle users
+	presenceSweepInterval = time.Minute
+
+	// Users without activity for this many minutes are marked offline.
+	// Connected clients refresh last_active on every pong, well within this window.
+	presenceTimeoutMinutes = 3
+)
+
+// setUserOnline persists a presence transition for a user and
+// broadcasts it as a user_online or user_offline event
+func (h *Hub) setUserOnline(userID string, isOnline bool) {
+	if err := database.UpdateUserStatus(userID, isOnline); err != nil {
+		log.Printf("Error updating status for user %s: %v", userID, err)
+		return
+	}
+	h.broadcastPresence(userID, isOnline)
+}
+
+// broadcastPresence sends a user's persisted status as a user_online or
+// user_offline event to everyone outside a block with the user
+func (h *Hub) broadcastPresence(userID string, isOnline bool) {
+	status, err := database.GetUserStatus(userID)
+	if err != nil {
+		log.Printf("Error getting status for user %s: %v", userID, err)
+		return
+	}
+
+	// Users on either side of a block do not see each other's presence
+	blockedPeers, err := database.GetBlockedPeers(userID)
+	if err != nil {
+		log.Printf("Error getting blocked peers for user %s: %v", userID, err)
+		return
+	}
+
+	eventType := EventUserOffline
+	if isOnline {
+		eventType = EventUserOnline
+	}
+	h.sendToAllExcept(CreateUserStatusEvent(eventType, status), blockedPeers)
+}
+
+// sendUserList sends the current online users snapshot to a client
+func (h *Hub) sendUserList(client *Client) {
+	userList, err := onlineUserList(client.GetUserID())
+	if err != nil {
+		log.Printf("Error getting online users for user %s: %v", client.GetUserID(), err)
+		return
+	}
+	h.sendToClient(client, userList)
+}
+
+// onlineUserList builds the user_list event for a user, leaving out users on
+// either side of a block with them
+func onlineUserList(userID string) (*Event, error) {
+	statuses, err := database.GetAllOnlineUsers()
+	if err != nil {
+		return nil, err
+	}
+
+	blockedPeers, err := database.GetBlockedPeers(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	visible := make([]models.UserStatus, 0, len(statuses))
+	for _, status := range statuses {
+		if !blockedPeers[status.UserID] {
+			visible = append(visible, status)
+		}
+	}
+	return CreateUserListEvent(visible), nil
+}
+
+// persistActivity refreshes last_active for a client's user
+func (h *Hub) persistActivity(userID string) {
+	if err := database.TouchUserActivity(userID); err != nil {
+		log.Printf("Error updating activity for user %s: %v", userID, err)
+	}
+}
+
+// resetPresence marks everyone offline at startup, before any client registers,
+// clearing presence left over from a previous run
+func (h *Hub) resetPresence() {
+	if err := database.MarkAllUsersOffline(); err != nil {
+		log.Printf("Error resetting user status: %v", err)
+	}
+}
+
+// sweepPresence marks idle users offline and tells clients about it. It runs on
+// the hub goroutine, so it cannot race with clients registering.
+func (h *Hub) sweepPresence() {
+	userIDs, err := database.CleanupOfflineUsers(presenceTimeoutMinutes)
+	if err != nil {
+		log.Printf("Error cleaning up offline users: %v", err)
+		return
+	}
+
+	swept := 0
+	for _, userID := range userIDs {
+		// A connected user missed a heartbeat write; keep them online
+		if h.GetUserSessionCount(userID) > 0 {
+			h.persistActivity(userID)
+			continue
+		}
+		h.broadcastPresence(userID, false)
+		swept++
+	}
+	if swept > 0 {
+		h.broadcastUserStats()
+	}
+}
@@ -0,0 +1,158 @@
+package websocket
+
+import (
+	"log"
+	"sync"
+)
+
+// Number of sequenced events kept per user for replay after a reconnect
+const replayLogSize = 200
+
+// replayLog assigns per-user sequence numbers to outbound events and keeps
+// the most recent ones so a reconnecting client can catch up with "resume".
+// The log lives in memory and does not survive a server restart.
+//
+// Events addressed to users are sequenced. Topic deliveries are not: topics are
+// followed per connection and dropped on disconnect, so a resumed connection
+// has no subscriptions to replay them for, and clients reload feeds and posts
+// over HTTP when they subscribe again. Replies to a single connection are not
+// sequenced either, since they answer that connection's requests.
+type replayLog struct {
+	mutex sync.Mutex
+	users map[string]*userReplayLog
+}
+
+// userReplayLog holds one user's sequenced events, oldest first
+type userReplayLog struct {
+	lastSeq uint64
+	events  []*Event
+}
+
+// newReplayLog creates an empty replay log
+func newReplayLog() *replayLog {
+	return &replayLog{
+		users: make(map[string]*userReplayLog),
+	}
+}
+
+// isEphemeral reports whether an event is only meaningful live and is
+// therefore delivered without a sequence number and never replayed. Presence
+// changes are among them: they are sent to every user, so logging them would
+// push real events out of the logs, and resume sends the current presence instead.
+func isEphemeral(eventType EventType) bool {
+	switch eventType {
+	case EventTypingStart, EventTypingStop, EventUserStats, EventUserOnline, EventUserOffline:
+		return true
+	}
+	return false
+}
+
+// record stamps a copy of the event with the user's next sequence number and
+// stores it. Ephemeral events are returned unchanged.
+func (rl *replayLog) record(userID string, event *Event) *Event {
+	if isEphemeral(event.Type) {
+		return event
+	}
+
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+
+	userLog, exists := rl.users[userID]
+	if !exists {
+		userLog = &userReplayLog{}
+		rl.users[userID] = userLog
+	}
+
+	userLog.lastSeq++
+	sequenced := *event
+	sequenced.Seq = userLog.lastSeq
+
+	userLog.events = append(userLog.events, &sequenced)
+	if len(userLog.events) > replayLogSize {
+		userLog.events = userLog.events[len(userLog.events)-replayLogSize:]
+	}
+
+	return &sequenced
+}
+
+// since returns the user's events after the given sequence number. complete is
+// false when some of those events have already been evicted from the log.
+func (rl *replayLog) since(userID string, seq uint64) (events []*Event, lastSeq uint64, complete bool) {
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+
+	userLog, exists := rl.users[userID]
+	if !exists {
+		return nil, 0, seq == 0
+	}
+
+	complete = true
+	if len(userLog.events) > 0 && userLog.events[0].Seq > seq+1 {
+		complete = false
+	}
+	if seq > userLog.lastSeq {
+		// Client is ahead of us, e.g. after a server restart
+		complete = false
+	}
+
+	for _, event := range userLog.events {
+		if event.Seq > seq {
+			events = append(events, event)
+		}
+	}
+
+	return events, userLog.lastSeq, complete
+}
+
+// lastSeq returns the user's latest sequence number
+func (rl *replayLog) lastSeq(userID string) uint64 {
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+
+	if userLog, exists := rl.users[userID]; exists {
+		return userLog.lastSeq
+	}
+	return 0
+}
+
+// knownUsers returns the users that have a replay log
+func (rl *replayLog) knownUsers() []string {
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+
+	users := make([]string, 0, len(rl.users))
+	for userID := range rl.users {
+		users = append(users, userID)
+	}
+	return users
+}
+
+// handleResume replays the events a client missed since its last seen sequence number
+func (c *Client) handleResume(event *Event) {
+	var request ResumeEvent
+	if err := event.DecodeData(&request); err != nil {
+		c.sendErrorFor(event, "Invalid resume payload", 400)
+		return
+	}
+
+	events, lastSeq, complete := c.hub.replay.since(c.GetUserID(), request.LastSeq)
+	for _, missed := range events {
+		c.sendEvent(missed)
+	}
+	log.Printf("Replayed %d event(s) to user %s from seq %d", len(events), c.GetUserID(), request.LastSeq)
+
+	// Presence changes are not replayed, so send who is online now
+	if userList, err := onlineUserList(c.GetUserID()); err != nil {
+		log.Printf("Error getting online users for user %s: %v", c.GetUserID(), err)
+	} else {
+		c.sendEvent(userList)
+	}
+
+	reply := CreateEvent(EventResumed, &ResumeEvent{
+		LastSeq:  lastSeq,
+		Replayed: len(events),
+		Complete: complete,
+	}, c.GetUserID())
+	reply.CorrelationID = event.CorrelationID
+	c.sendEvent(reply)
+}
@@ -0,0 +1,197 @@
+package websocket
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+)
+
+// recordN records n new_message events for the user
+func recordN(rl *replayLog, userID string, n int) {
+	for i := 0; i < n; i++ {
+		rl.record(userID, &Event{Type: EventNewMessage})
+	}
+}
+
+func seqs(events []*Event) []uint64 {
+	var result []uint64
+	for _, event := range events {
+		result = append(result, event.Seq)
+	}
+	return result
+}
+
+func TestReplayLogRecord(t *testing.T) {
+	rl := newReplayLog()
+
+	tests := []struct {
+		name    string
+		userID  string
+		event   EventType
+		wantSeq uint64
+	}{
+		{"first event", "alice", EventNewMessage, 1},
+		{"second event", "alice", EventMessageRead, 2},
+		{"other user starts at one", "bob", EventNewMessage, 1},
+		{"typing is not sequenced", "alice", EventTypingStart, 0},
+		{"typing stop is not sequenced", "alice", EventTypingStop, 0},
+		{"stats are not sequenced", "alice", EventUserStats, 0},
+		{"online is not sequenced", "alice", EventUserOnline, 0},
+		{"offline is not sequenced", "alice", EventUserOffline, 0},
+		{"sequence continues", "alice", EventNewMessage, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := &Event{Type: tt.event}
+			recorded := rl.record(tt.userID, event)
+
+			if recorded.Seq != tt.wantSeq {
+				t.Errorf("Seq = %d, want %d", recorded.Seq, tt.wantSeq)
+			}
+			if tt.wantSeq == 0 && recorded != event {
+				t.Error("ephemeral event was copied")
+			}
+			if tt.wantSeq != 0 && (recorded == event || event.Seq != 0) {
+				// The same event is fanned out to several users, so it must not be stamped in place
+				t.Error("record modified the caller's event")
+			}
+		})
+	}
+
+	if got := rl.lastSeq("alice"); got != 3 {
+		t.Errorf("lastSeq(alice) = %d, want 3", got)
+	}
+	if got := rl.lastSeq("carol"); got != 0 {
+		t.Errorf("lastSeq(carol) = %d, want 0", got)
+	}
+	users := rl.knownUsers()
+	slices.Sort(users)
+	if !slices.Equal(users, []string{"alice", "bob"}) {
+		t.Errorf("knownUsers = %v, want [alice bob]", users)
+	}
+}
+
+func TestReplayLogSince(t *testing.T) {
+	tests := []struct {
+		name         string
+		recorded     int
+		userID       string
+		seq          uint64
+		wantSeqs     []uint64
+		wantLastSeq  uint64
+		wantComplete bool
+	}{
+		{"unknown user from start", 0, "alice", 0, nil, 0, true},
+		{"unknown user with history", 0, "alice", 5, nil, 0, false},
+		{"from start", 3, "alice", 0, []uint64{1, 2, 3}, 3, true},
+		{"partway", 3, "alice", 1, []uint64{2, 3}, 3, true},
+		{"up to date", 3, "alice", 3, nil, 3, true},
+		{"client ahead", 3, "alice", 7, nil, 3, false},
+		{"other user", 3, "bob", 0, nil, 0, true},
+		{"full log from start", replayLogSize, "alice", 0, nil, replayLogSize, true},
+		{"evicted", replayLogSize + 5, "alice", 0, nil, replayLogSize + 5, false},
+		{"evicted just before", replayLogSize + 5, "alice", 4, nil, replayLogSize + 5, false},
+		{"oldest kept", replayLogSize + 5, "alice", 5, nil, replayLogSize + 5, true},
+		{"after eviction", replayLogSize + 5, "alice", replayLogSize + 3, []uint64{replayLogSize + 4, replayLogSize + 5}, replayLogSize + 5, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rl := newReplayLog()
+			recordN(rl, "alice", tt.recorded)
+
+			events, lastSeq, complete := rl.since(tt.userID, tt.seq)
+			if lastSeq != tt.wantLastSeq {
+				t.Errorf("lastSeq = %d, want %d", lastSeq, tt.wantLastSeq)
+			}
+			if complete != tt.wantComplete {
+				t.Errorf("complete = %v, want %v", complete, tt.wantComplete)
+			}
+			if tt.wantSeqs != nil && !slices.Equal(seqs(events), tt.wantSeqs) {
+				t.Errorf("seqs = %v, want %v", seqs(events), tt.wantSeqs)
+			}
+
+			// Whatever is returned is contiguous, ends at lastSeq and never exceeds the log size
+			if len(events) > replayLogSize {
+				t.Errorf("returned %d events, log holds at most %d", len(events), replayLogSize)
+			}
+			for i, event := range events {
+				if event.Seq <= tt.seq {
+					t.Errorf("event %d has seq %d, not after %d", i, event.Seq, tt.seq)
+				}
+				if i > 0 && event.Seq != events[i-1].Seq+1 {
+					t.Errorf("gap between seq %d and %d", events[i-1].Seq, event.Seq)
+				}
+			}
+			if len(events) > 0 && events[len(events)-1].Seq != lastSeq {
+				t.Errorf("last event seq = %d, want %d", events[len(events)-1].Seq, lastSeq)
+			}
+		})
+	}
+}
+
+func TestReplayLogEviction(t *testing.T) {
+	rl := newReplayLog()
+	recordN(rl, "alice", replayLogSize*2+1)
+
+	events, lastSeq, complete := rl.since("alice", 0)
+	if complete {
+		t.Error("complete = true after eviction")
+	}
+	if len(events) != replayLogSize {
+		t.Fatalf("kept %d events, want %d", len(events), replayLogSize)
+	}
+	if first := events[0].Seq; first != lastSeq-replayLogSize+1 {
+		t.Errorf("oldest kept seq = %d, want %d", first, lastSeq-replayLogSize+1)
+	}
+	if lastSeq != replayLogSize*2+1 {
+		t.Errorf("lastSeq = %d, want %d", lastSeq, replayLogSize*2+1)
+	}
+}
+
+// connectTestClient registers a client for the user without a connection
+func connectTestClient(h *Hub, userID string) *Client {
+	client := &Client{send: make(chan []byte, 16), hub: h, userID: userID, topics: make(map[string]bool)}
+	h.clients[client] = true
+	if h.userClients[userID] == nil {
+		h.userClients[userID] = make(map[*Client]bool)
+	}
+	h.userClients[userID][client] = true
+	return client
+}
+
+func TestSendToAllSequencing(t *testing.T) {
+	tests := []struct {
+		name           string
+		event          EventType
+		wantSeq        uint64
+		wantOfflineSeq uint64
+	}{
+		{"presence reaches connected users unsequenced", EventUserOnline, 0, 1},
+		{"other events are logged for offline users too", EventNewMessage, 2, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHub()
+			alice := connectTestClient(h, "alice")
+			h.replay.record("alice", &Event{Type: EventNewMessage})
+			// carol is offline but has a replay log from an earlier connection
+			h.replay.record("carol", &Event{Type: EventNewMessage})
+
+			h.sendToAll(&Event{Type: tt.event})
+
+			var delivered Event
+			if err := json.Unmarshal(<-alice.send, &delivered); err != nil {
+				t.Fatal(err)
+			}
+			if delivered.Seq != tt.wantSeq {
+				t.Errorf("delivered seq = %d, want %d", delivered.Seq, tt.wantSeq)
+			}
+			if got := h.replay.lastSeq("carol"); got != tt.wantOfflineSeq {
+				t.Errorf("offline user's lastSeq = %d, want %d", got, tt.wantOfflineSeq)
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+package websocket
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/Tomlee-abila/real_time_forum/backend/internal/database"
+)
+
+// Topic kinds. Conversation events (messages, typing, read receipts) are not
+// topics; they are delivered to the members of the conversation.
+const (
+	// TopicFeed follows every post and comment in the forum
+	TopicFeed = "feed"
+
+	topicPostPrefix     = "post:"
+	topicCategoryPrefix = "category:"
+
+	// Maximum number of topics a single client may follow
+	maxTopicsPerClient = 100
+)
+
+// PostTopic returns the topic for a single post thread
+func PostTopic(postID string) string {
+	return topicPostPrefix + postID
+}
+
+// CategoryTopic returns the topic for a post category
+func CategoryTopic(category string) string {
+	return topicCategoryPrefix + strings.ToLower(category)
+}
+
+// authorizeTopic checks that the user may follow a topic
+func authorizeTopic(topic string) error {
+	switch {
+	case topic == TopicFeed:
+		return nil
+
+	case strings.HasPrefix(topic, topicPostPrefix):
+		postID := strings.TrimPrefix(topic, topicPostPrefix)
+		if _, err := database.GetPostByID(postID); err != nil {
+			return errors.New("post not found")
+		}
+		return nil
+
+	case strings.HasPrefix(topic, topicCategoryPrefix):
+		category := strings.TrimPrefix(topic, topicCategoryPrefix)
+		if !database.IsValidCategory(category, true) {
+			return errors.New("invalid category")
+		}
+		return nil
+	}
+
+	return errors.New("unknown topic")
+}
+
+// subscribe adds a client to a topic. It reports false if the client is gone
+// or already follows too many topics.
+func (h *Hub) subscribe(client *Client, topic string) bool {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if _, ok := h.clients[client]; !ok {
+		return false
+	}
+	if client.topics[topic] {
+		return true
+	}
+	if len(client.topics) >= maxTopicsPerClient {
+		return false
+	}
+
+	if h.topics[topic] == nil {
+		h.topics[topic] = make(map[*Client]bool)
+	}
+	h.topics[topic][client] = true
+	client.topics[topic] = true
+	return true
+}
+
+// unsubscribe removes a client from a topic
+func (h *Hub) unsubscribe(client *Client, topic string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.unsubscribeLocked(client, topic)
+}
+
+// unsubscribeLocked removes a client from a topic; the caller holds h.mutex
+func (h *Hub) unsubscribeLocked(client *Client, topic string) {
+	delete(client.topics, topic)
+	if subscribers, ok := h.topics[topic]; ok {
+		delete(subscribers, client)
+		if len(subscribers) == 0 {
+			delete(h.topics, topic)
+		}
+	}
+}
+
+// clientTopics returns the topics a client follows, sorted
+func (h *Hub) clientTopics(client *Client) []string {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	topics := make([]string, 0, len(client.topics))
+	for topic := range client.topics {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+// sendToTopics sends an event once to every client following any of the topics.
+// Topic deliveries are not sequenced; see replayLog.
+func (h *Hub) sendToTopics(topics []string, event *Event, except *Client) {
+	h.mutex.RLock()
+	seen := make(map[*Client]bool)
+	clients := make([]*Client, 0)
+	for _, topic := range topics {
+		for client := range h.topics[topic] {
+			if client != except && !seen[client] {
+				seen[client] = true
+				clients = append(clients, client)
+			}
+		}
+	}
+	h.mutex.RUnlock()
+
+	for _, client := range clients {
+		h.sendToClient(client, event)
+	}
+}
+
+// PublishFromAPI publishes an event to the given topics (not from WebSocket client)
+func (h *Hub) PublishFromAPI(event *Event, topics ...string) {
+	h.queue(&BroadcastMessage{
+		event:  event,
+		topics: topics,
+	})
+}
+
+// handleSubscribe adds the requested topics to the client's subscriptions
+func (c *Client) handleSubscribe(event *Event) {
+	var request SubscriptionEvent
+	if err := event.DecodeData(&request); err != nil || len(request.Topics) == 0 {
+		c.sendErrorFor(event, "Topics are required", 400)
+		return
+	}
+
+	for _, topic := range request.Topics {
+		topic = strings.TrimSpace(topic)
+		if err := authorizeTopic(topic); err != nil {
+			c.sendErrorFor(event, "Cannot subscribe to "+topic+": "+err.Error(), 403)
+			return
+		}
+		if !c.hub.subscribe(c, topic) {
+			c.sendErrorFor(event, "Subscription limit reached", 400)
+			return
+		}
+	}
+
+	c.sendSubscriptions(event)
+}
+
+// handleUnsubscribe removes the requested topics from the client's subscriptions
+func (c *Client) handleUnsubscribe(event *Event) {
+	var request SubscriptionEvent
+	if err := event.DecodeData(&request); err != nil {
+		c.sendErrorFor(event, "Invalid subscription payload", 400)
+		return
+	}
+
+	for _, topic := range request.Topics {
+		c.hub.unsubscribe(c, strings.TrimSpace(topic))
+	}
+
+	c.sendSubscriptions(event)
+}
+
+// sendSubscriptions replies with the client's current topic subscriptions
+func (c *Client) sendSubscriptions(request *Event) {
+	reply := CreateEvent(EventSubscriptions, &SubscriptionEvent{
+		Topics: c.hub.clientTopics(c),
+	}, c.GetUserID())
+	reply.CorrelationID = request.CorrelationID
+	c.sendEvent(reply)
+}
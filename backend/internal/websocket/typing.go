@@ -0,0 +1,141 @@
+package websocket
+
+import (
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Tomlee-abila/real_time_forum/backend/internal/database"
+)
+
+// Time after which a typing indicator expires without a refresh
+const typingTimeout = 5 * time.Second
+
+// typingKey identifies a typist and where they are typing: to a direct
+// message peer (receiverID) or in a conversation (conversationID)
+type typingKey struct {
+	senderID       string
+	receiverID     string
+	conversationID string
+}
+
+// typingTracker keeps the expiry timers of active typing indicators
+type typingTracker struct {
+	mutex  sync.Mutex
+	timers map[typingKey]*time.Timer
+	// Nicknames of active typists, used for the automatic stop event
+	nicknames map[typingKey]string
+	// Users shown each indicator, so typing_stop reaches the same users
+	targets map[typingKey][]string
+}
+
+// newTypingTracker creates an empty typing tracker
+func newTypingTracker() *typingTracker {
+	return &typingTracker{
+		timers:    make(map[typingKey]*time.Timer),
+		nicknames: make(map[typingKey]string),
+		targets:   make(map[typingKey][]string),
+	}
+}
+
+// typingTargets returns the users who should see a typing indicator: the
+// peer of a direct message, or every other member of a conversation. Users
+// on either side of a block with the typist are left out.
+func typingTargets(key typingKey) ([]string, error) {
+	if key.conversationID == "" {
+		blocked, err := database.IsBlockedBetween(key.senderID, key.receiverID)
+		if err != nil || blocked {
+			return nil, err
+		}
+		return []string{key.receiverID}, nil
+	}
+
+	memberIDs, err := database.GetConversationMemberIDs(key.conversationID)
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(memberIDs, key.senderID) {
+		return nil, nil
+	}
+	blockedPeers, err := database.GetBlockedPeers(key.senderID)
+	if err != nil {
+		return nil, err
+	}
+
+	targets := make([]string, 0, len(memberIDs))
+	for _, userID := range memberIDs {
+		if userID != key.senderID && !blockedPeers[userID] {
+			targets = append(targets, userID)
+		}
+	}
+	return targets, nil
+}
+
+// startTyping forwards a typing_start event and (re)arms the timer that sends
+// typing_stop if no refresh arrives in time. Events are queued on the hub, so
+// this is safe to call from client and timer goroutines.
+func (h *Hub) startTyping(key typingKey, nickname string) {
+	targets, err := typingTargets(key)
+	if err != nil {
+		log.Printf("Error resolving typing targets for %s: %v", key.senderID, err)
+		return
+	}
+	if len(targets) == 0 {
+		return
+	}
+
+	h.typing.mutex.Lock()
+	if timer, exists := h.typing.timers[key]; exists {
+		timer.Stop()
+	}
+	h.typing.nicknames[key] = nickname
+	h.typing.targets[key] = targets
+	h.typing.timers[key] = time.AfterFunc(typingTimeout, func() {
+		h.stopTyping(key)
+	})
+	h.typing.mutex.Unlock()
+
+	h.queue(&BroadcastMessage{
+		event:   CreateTypingEvent(EventTypingStart, key.senderID, nickname, key.receiverID, key.conversationID),
+		members: targets,
+	})
+}
+
+// stopTyping clears a typing indicator and forwards typing_stop to the users who saw it
+func (h *Hub) stopTyping(key typingKey) {
+	h.typing.mutex.Lock()
+	timer, exists := h.typing.timers[key]
+	nickname := h.typing.nicknames[key]
+	targets := h.typing.targets[key]
+	if exists {
+		timer.Stop()
+		delete(h.typing.timers, key)
+		delete(h.typing.nicknames, key)
+		delete(h.typing.targets, key)
+	}
+	h.typing.mutex.Unlock()
+
+	if exists {
+		h.queue(&BroadcastMessage{
+			event:   CreateTypingEvent(EventTypingStop, key.senderID, nickname, key.receiverID, key.conversationID),
+			members: targets,
+		})
+	}
+}
+
+// stopAllTyping clears every typing indicator started by a user
+func (h *Hub) stopAllTyping(senderID string) {
+	h.typing.mutex.Lock()
+	var keys []typingKey
+	for key := range h.typing.timers {
+		if key.senderID == senderID {
+			keys = append(keys, key)
+		}
+	}
+	h.typing.mutex.Unlock()
+
+	for _, key := range keys {
+		h.stopTyping(key)
+	}
+}
@@ -39,6 +39,8 @@ class MessagingManager {
             // Register message handlers
             this.wsClient.onMessage('new_message', (data) => this.handleNewMessage(data));
             this.wsClient.onMessage('message_read', (data) => this.handleMessageRead(data));
+            this.wsClient.onMessage('message_edited', (data) => this.handleMessageEdited(data));
+            this.wsClient.onMessage('message_deleted', (data) => this.handleMessageDeleted(data));
             this.wsClient.onMessage('user_online', (data) => this.handleUserOnline(data));
             this.wsClient.onMessage('user_offline', (data) => this.handleUserOffline(data));
             this.wsClient.onMessage('typing_start', (data) => this.handleTypingStart(data));
@@ -157,6 +159,41 @@ class MessagingManager {
         }
     }
 
+    // Handle an edited message by replacing it in the history
+    handleMessageEdited(data) {
+        if (data.data && data.data.message) {
+            const edited = data.data.message;
+            this.updateMessageInHistory(edited.id, () => edited);
+        }
+    }
+
+    // Handle a deleted message: a tombstone for everyone, or removal when deleted for me
+    handleMessageDeleted(data) {
+        if (!data.data) return;
+        const { message_id: messageId, scope } = data.data;
+        this.updateMessageInHistory(messageId, (message) =>
+            scope === 'everyone' ? { ...message, content: '', deleted: true } : null
+        );
+    }
+
+    // Replace (or remove, when update returns null) a message in the cached
+    // history and redraw the open conversation
+    updateMessageInHistory(messageId, update) {
+        for (const [userId, messages] of this.messageHistory) {
+            const index = messages.findIndex(message => message.id === messageId);
+            if (index === -1) continue;
+
+            const updated = update(messages[index]);
+            if (updated) {
+                messages[index] = updated;
+            } else {
+                messages.splice(index, 1);
+            }
+            this.displayMessages(userId);
+            return;
+        }
+    }
+
     // Handle user coming online
     handleUserOnline(data) {
         console.log('User came online:', data);
@@ -325,6 +362,8 @@ class MessagingManager {
 
                 if (data.conversations) {
                     data.conversations.forEach(conv => {
+                        // This view lists direct messages only
+                        if (conv.kind === 'group') return;
                         this.conversations.set(conv.user_id, conv);
                     });
                 }
@@ -453,11 +492,20 @@ class MessagingManager {
 
         const bubble = document.createElement('div');
         bubble.className = 'message-bubble';
-        bubble.textContent = message.content;
+        if (message.deleted) {
+            bubble.classList.add('message-deleted');
+            bubble.textContent = 'This message was deleted';
+        } else if (message.content_html) {
+            // Markdown messages come with HTML already sanitized by the server
+            bubble.innerHTML = message.content_html;
+        } else {
+            bubble.textContent = message.content;
+        }
 
         const time = document.createElement('div');
         time.className = 'message-time';
-        time.textContent = this.formatMessageTime(message.created_at);
+        time.textContent = this.formatMessageTime(message.created_at) +
+            (message.edited_at && !message.deleted ? ' (edited)' : '');
 
         messageDiv.appendChild(bubble);
         messageDiv.appendChild(time);
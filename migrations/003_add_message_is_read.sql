@@ -0,0 +1,5 @@
+-- Add the is_read flag that message queries depend on but 001_init.sql never created
+ALTER TABLE messages ADD COLUMN is_read BOOLEAN DEFAULT FALSE;
+
+-- Create index for unread message lookups
+CREATE INDEX IF NOT EXISTS idx_messages_unread ON messages(receiver_id, sender_id, is_read);
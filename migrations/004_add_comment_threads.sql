@@ -0,0 +1,7 @@
+-- Allow comments to reply to other comments
+ALTER TABLE comments ADD COLUMN parent_id TEXT REFERENCES comments(id);
+ALTER TABLE comments ADD COLUMN depth INTEGER NOT NULL DEFAULT 0;
+
+-- Create index for loading replies
+CREATE INDEX IF NOT EXISTS idx_comments_parent ON comments(parent_id);
+CREATE INDEX IF NOT EXISTS idx_comments_post_created ON comments(post_id, created_at, id);
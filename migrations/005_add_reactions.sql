@@ -0,0 +1,18 @@
+-- Add reactions (likes/dislikes and emoji) on posts and comments, one per user per target
+CREATE TABLE IF NOT EXISTS reactions (
+    user_id TEXT NOT NULL,
+    target_type TEXT NOT NULL CHECK (target_type IN ('post', 'comment')),
+    target_id TEXT NOT NULL,
+    reaction TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, target_type, target_id),
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+-- Denormalized likes minus dislikes, used to sort by score
+ALTER TABLE posts ADD COLUMN score INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE comments ADD COLUMN score INTEGER NOT NULL DEFAULT 0;
+
+-- Create indexes for reaction aggregates and score sorting
+CREATE INDEX IF NOT EXISTS idx_reactions_target ON reactions(target_type, target_id);
+CREATE INDEX IF NOT EXISTS idx_posts_score ON posts(score, created_at, id);
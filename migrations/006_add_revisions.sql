@@ -0,0 +1,18 @@
+-- Keep previous versions of edited posts and comments
+CREATE TABLE IF NOT EXISTS revisions (
+    id TEXT PRIMARY KEY,
+    target_type TEXT NOT NULL CHECK (target_type IN ('post', 'comment')),
+    target_id TEXT NOT NULL,
+    title TEXT NOT NULL DEFAULT '',
+    content TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    replaced_at TIMESTAMP NOT NULL,
+    replaced_by TEXT NOT NULL,
+    FOREIGN KEY (replaced_by) REFERENCES users(id)
+);
+
+ALTER TABLE posts ADD COLUMN edited_at TIMESTAMP;
+ALTER TABLE comments ADD COLUMN edited_at TIMESTAMP;
+
+-- Create index for listing a target's revisions
+CREATE INDEX IF NOT EXISTS idx_revisions_target ON revisions(target_type, target_id, created_at);
@@ -0,0 +1,4 @@
+-- Full-text search indexes over posts, comments and messages.
+-- The FTS5 tables and the triggers that keep them in sync are created at
+-- startup by the database package (setupSearchIndex), because they need SQLite
+-- built with FTS5 and search falls back to LIKE matching without it.
@@ -0,0 +1,32 @@
+-- Admin-managed post categories
+CREATE TABLE IF NOT EXISTS categories (
+    slug TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    sort_order INTEGER NOT NULL DEFAULT 0,
+    archived BOOLEAN NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Seed the categories that used to be hard-coded
+INSERT OR IGNORE INTO categories (slug, name, sort_order) VALUES
+    ('general', 'General', 1),
+    ('technology', 'Technology', 2),
+    ('gaming', 'Gaming', 3),
+    ('sports', 'Sports', 4),
+    ('music', 'Music', 5),
+    ('movies', 'Movies', 6),
+    ('books', 'Books', 7),
+    ('food', 'Food', 8),
+    ('travel', 'Travel', 9),
+    ('science', 'Science', 10),
+    ('other', 'Other', 11);
+
+-- Posts were validated case-insensitively, so normalize their categories
+UPDATE posts SET category = lower(category) WHERE category != lower(category);
+
+-- Administrators manage categories; the operator names them at startup
+ALTER TABLE users ADD COLUMN is_admin BOOLEAN NOT NULL DEFAULT 0;
+
+-- Create index for category listings
+CREATE INDEX IF NOT EXISTS idx_categories_sort ON categories(archived, sort_order);
@@ -0,0 +1,18 @@
+-- Posts can have several categories and free-form tags
+CREATE TABLE IF NOT EXISTS post_tags (
+    post_id TEXT NOT NULL,
+    kind TEXT NOT NULL CHECK (kind IN ('category', 'tag')),
+    tag TEXT NOT NULL,
+    position INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (post_id, kind, tag),
+    FOREIGN KEY (post_id) REFERENCES posts(id)
+);
+
+-- Move each post's single category into post_tags
+INSERT OR IGNORE INTO post_tags (post_id, kind, tag, position)
+SELECT id, 'category', lower(category), 0 FROM posts;
+
+ALTER TABLE posts DROP COLUMN category;
+
+-- Create index for filtering posts by category or tag
+CREATE INDEX IF NOT EXISTS idx_post_tags_tag ON post_tags(kind, tag, post_id);
@@ -0,0 +1,8 @@
+-- Replace the admin flag with user, moderator and admin roles
+ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'user' CHECK (role IN ('user', 'moderator', 'admin'));
+UPDATE users SET role = 'admin' WHERE is_admin = 1;
+ALTER TABLE users DROP COLUMN is_admin;
+
+-- Moderators can lock posts against new comments and edits
+ALTER TABLE posts ADD COLUMN locked_at TIMESTAMP;
+ALTER TABLE posts ADD COLUMN locked_by TEXT REFERENCES users(id);
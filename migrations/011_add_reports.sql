@@ -0,0 +1,35 @@
+-- User reports of abusive posts, comments and messages
+CREATE TABLE IF NOT EXISTS reports (
+    id TEXT PRIMARY KEY,
+    reporter_id TEXT NOT NULL,
+    target_type TEXT NOT NULL CHECK (target_type IN ('post', 'comment', 'message')),
+    target_id TEXT NOT NULL,
+    target_user_id TEXT NOT NULL,
+    target_content TEXT NOT NULL,
+    reason TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'actioned', 'dismissed')),
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    FOREIGN KEY (reporter_id) REFERENCES users(id),
+    FOREIGN KEY (target_user_id) REFERENCES users(id)
+);
+
+-- Audit trail of every status change made to a report
+CREATE TABLE IF NOT EXISTS report_actions (
+    id TEXT PRIMARY KEY,
+    report_id TEXT NOT NULL,
+    actor_id TEXT NOT NULL,
+    from_status TEXT NOT NULL DEFAULT '',
+    to_status TEXT NOT NULL,
+    note TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL,
+    FOREIGN KEY (report_id) REFERENCES reports(id),
+    FOREIGN KEY (actor_id) REFERENCES users(id)
+);
+
+-- Create indexes for the moderation queue and report history
+CREATE INDEX IF NOT EXISTS idx_reports_status ON reports(status, created_at, id);
+CREATE INDEX IF NOT EXISTS idx_report_actions_report ON report_actions(report_id, created_at);
+
+-- A user can only have one open report against the same content
+CREATE UNIQUE INDEX IF NOT EXISTS idx_reports_open_reporter ON reports(reporter_id, target_type, target_id) WHERE status = 'open';
@@ -0,0 +1,86 @@
+-- Conversations group messages between two or more members. A direct message
+-- conversation is a conversation of kind 'direct' with exactly two members.
+CREATE TABLE IF NOT EXISTS conversations (
+    id TEXT PRIMARY KEY,
+    kind TEXT NOT NULL CHECK (kind IN ('direct', 'group')),
+    name TEXT NOT NULL DEFAULT '',
+    created_by TEXT NOT NULL,
+    -- Sorted member IDs of a direct conversation, so each pair has only one
+    direct_key TEXT UNIQUE,
+    created_at TIMESTAMP NOT NULL,
+    FOREIGN KEY (created_by) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS conversation_members (
+    conversation_id TEXT NOT NULL,
+    user_id TEXT NOT NULL,
+    role TEXT NOT NULL DEFAULT 'member' CHECK (role IN ('creator', 'admin', 'member')),
+    joined_at TIMESTAMP NOT NULL,
+    -- Messages from others created after this are unread for the member
+    last_read_at TIMESTAMP,
+    PRIMARY KEY (conversation_id, user_id),
+    FOREIGN KEY (conversation_id) REFERENCES conversations(id),
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+-- Turn every existing pair of correspondents into a direct conversation
+INSERT INTO conversations (id, kind, created_by, direct_key, created_at)
+SELECT
+    lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' ||
+          substr('89ab', 1 + abs(random()) % 4, 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6))),
+    'direct',
+    (SELECT m2.sender_id FROM messages m2
+     WHERE min(m2.sender_id, m2.receiver_id) = pairs.user_a AND max(m2.sender_id, m2.receiver_id) = pairs.user_b
+     ORDER BY m2.created_at LIMIT 1),
+    pairs.user_a || ':' || pairs.user_b,
+    pairs.first_at
+FROM (
+    SELECT min(sender_id, receiver_id) AS user_a, max(sender_id, receiver_id) AS user_b, MIN(created_at) AS first_at
+    FROM messages
+    GROUP BY min(sender_id, receiver_id), max(sender_id, receiver_id)
+) AS pairs;
+
+-- Each member has read up to the latest message the other sent them that was marked read
+INSERT OR IGNORE INTO conversation_members (conversation_id, user_id, role, joined_at, last_read_at)
+SELECT c.id, members.user_id, 'member', c.created_at,
+    (SELECT MAX(m.created_at) FROM messages m
+     WHERE m.receiver_id = members.user_id AND m.sender_id = members.other_id AND m.is_read = 1)
+FROM conversations c
+JOIN (
+    SELECT direct_key,
+           substr(direct_key, 1, instr(direct_key, ':') - 1) AS user_id,
+           substr(direct_key, instr(direct_key, ':') + 1) AS other_id
+    FROM conversations
+    UNION ALL
+    SELECT direct_key,
+           substr(direct_key, instr(direct_key, ':') + 1),
+           substr(direct_key, 1, instr(direct_key, ':') - 1)
+    FROM conversations
+) AS members ON members.direct_key = c.direct_key;
+
+-- Rebuild messages around conversations. Receivers and read flags now come
+-- from conversation_members. Row IDs are kept for the search index.
+CREATE TABLE messages_new (
+    id TEXT PRIMARY KEY,
+    conversation_id TEXT NOT NULL,
+    sender_id TEXT NOT NULL,
+    content TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (conversation_id) REFERENCES conversations(id),
+    FOREIGN KEY (sender_id) REFERENCES users(id)
+);
+
+INSERT INTO messages_new (rowid, id, conversation_id, sender_id, content, created_at)
+SELECT m.rowid, m.id, c.id, m.sender_id, m.content, m.created_at
+FROM messages m
+JOIN conversations c ON c.direct_key = min(m.sender_id, m.receiver_id) || ':' || max(m.sender_id, m.receiver_id);
+
+DROP TABLE messages;
+ALTER TABLE messages_new RENAME TO messages;
+
+-- Dropping messages also dropped its search index triggers; setupSearchIndex
+-- recreates them and rebuilds the index at startup
+
+-- Create indexes for conversation listings, history and membership lookups
+CREATE INDEX IF NOT EXISTS idx_messages_conversation ON messages(conversation_id, created_at, id);
+CREATE INDEX IF NOT EXISTS idx_conversation_members_user ON conversation_members(user_id);
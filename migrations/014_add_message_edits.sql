@@ -0,0 +1,18 @@
+-- Messages can be edited by their sender and deleted for everyone, which
+-- leaves a tombstone in the conversation
+ALTER TABLE messages ADD COLUMN edited_at TIMESTAMP;
+ALTER TABLE messages ADD COLUMN deleted_at TIMESTAMP;
+
+-- Messages a member deleted only for themselves. Messages are only ever
+-- tombstoned, never removed, so every row keeps pointing at an existing message.
+CREATE TABLE IF NOT EXISTS hidden_messages (
+    message_id TEXT NOT NULL,
+    user_id TEXT NOT NULL,
+    hidden_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (message_id, user_id),
+    FOREIGN KEY (message_id) REFERENCES messages(id),
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+-- Create index for leaving out a member's hidden messages
+CREATE INDEX IF NOT EXISTS idx_hidden_messages_user ON hidden_messages(user_id);
@@ -0,0 +1,24 @@
+-- Uploaded files. An attachment belongs to its uploader until it is attached
+-- to a post or a message, after which it is visible to whoever can see that.
+CREATE TABLE IF NOT EXISTS attachments (
+    id TEXT PRIMARY KEY,
+    uploader_id TEXT NOT NULL,
+    filename TEXT NOT NULL,
+    mime_type TEXT NOT NULL,
+    size INTEGER NOT NULL,
+    width INTEGER NOT NULL DEFAULT 0,
+    height INTEGER NOT NULL DEFAULT 0,
+    storage_key TEXT NOT NULL,
+    thumbnail_key TEXT NOT NULL DEFAULT '',
+    post_id TEXT,
+    message_id TEXT,
+    created_at TIMESTAMP NOT NULL,
+    CHECK (post_id IS NULL OR message_id IS NULL),
+    FOREIGN KEY (uploader_id) REFERENCES users(id),
+    FOREIGN KEY (post_id) REFERENCES posts(id),
+    FOREIGN KEY (message_id) REFERENCES messages(id)
+);
+
+-- Create indexes for loading the attachments of posts and messages
+CREATE INDEX IF NOT EXISTS idx_attachments_post ON attachments(post_id);
+CREATE INDEX IF NOT EXISTS idx_attachments_message ON attachments(message_id);
@@ -0,0 +1,2 @@
+-- Senders can write a message in Markdown, which is rendered to sanitized HTML
+ALTER TABLE messages ADD COLUMN format TEXT NOT NULL DEFAULT 'plain' CHECK (format IN ('plain', 'markdown'));
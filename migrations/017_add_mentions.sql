@@ -0,0 +1,20 @@
+-- @nickname mentions of users in posts, comments and messages
+CREATE TABLE IF NOT EXISTS mentions (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    author_id TEXT NOT NULL,
+    target_type TEXT NOT NULL CHECK (target_type IN ('post', 'comment', 'message')),
+    post_id TEXT,
+    comment_id TEXT,
+    message_id TEXT,
+    created_at TIMESTAMP NOT NULL,
+    read_at TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    FOREIGN KEY (author_id) REFERENCES users(id),
+    FOREIGN KEY (post_id) REFERENCES posts(id),
+    FOREIGN KEY (comment_id) REFERENCES comments(id),
+    FOREIGN KEY (message_id) REFERENCES messages(id)
+);
+
+-- Create index for listing a user's unread mentions
+CREATE INDEX IF NOT EXISTS idx_mentions_user_unread ON mentions(user_id, read_at, created_at);
@@ -0,0 +1,6 @@
+-- Remove mentions left behind by posts, comments and messages deleted before
+-- their deletion also deleted their mentions
+DELETE FROM mentions
+WHERE (post_id IS NOT NULL AND post_id NOT IN (SELECT id FROM posts))
+   OR (comment_id IS NOT NULL AND comment_id NOT IN (SELECT id FROM comments))
+   OR (message_id IS NOT NULL AND message_id NOT IN (SELECT id FROM messages WHERE deleted_at IS NULL));
@@ -0,0 +1,10 @@
+// Package migrations embeds the SQL schema migrations so the server binary
+// does not depend on the working directory it is started from.
+package migrations
+
+import "embed"
+
+// FS holds every migration file, named NNN_description.sql
+//
+//go:embed *.sql
+var FS embed.FS